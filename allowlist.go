@@ -0,0 +1,153 @@
+package gemini
+
+import (
+	"context"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostAllowlist restricts the hosts that a proxying server will fetch on
+// behalf of its clients. It is used with HostAllowlistMiddleware.
+//
+// A host is allowed if it matches any of the suffixes or patterns.
+// A HostAllowlist with no suffixes and no patterns allows no hosts.
+//
+// A HostAllowlist must not be copied after first use.
+type HostAllowlist struct {
+	// Suffixes lists the allowed hostname suffixes. A suffix matches
+	// a hostname if it is equal to the hostname or if the hostname ends
+	// with "." followed by the suffix. For example, the suffix
+	// "example.com" matches both "example.com" and "gemini.example.com".
+	// Suffixes are compared case-insensitively.
+	Suffixes []string
+
+	// Patterns lists regular expressions matching allowed hostnames.
+	// Hostnames are converted to lower case before they are matched.
+	Patterns []*regexp.Regexp
+
+	// MaxTargetsPerClient, if positive, limits the number of distinct
+	// hosts each client may request within TargetWindow. Clients are
+	// identified by their IP address.
+	MaxTargetsPerClient int
+
+	// TargetWindow is the duration for which a host requested by a client
+	// counts towards MaxTargetsPerClient, starting from the last request
+	// of the client for that host. If zero, a window of one hour is used.
+	TargetWindow time.Duration
+
+	mu        sync.Mutex
+	targets   map[string]map[string]time.Time // last request time by client and host
+	lastPrune time.Time
+	now       func() time.Time // for testing
+}
+
+// Allowed reports whether the hostname matches the allowlist.
+// It does not take MaxTargetsPerClient into account.
+func (a *HostAllowlist) Allowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+	for _, suffix := range a.Suffixes {
+		suffix = strings.ToLower(strings.TrimPrefix(suffix, "."))
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	for _, re := range a.Patterns {
+		if re.MatchString(host) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowTarget reports whether the client may request the given host,
+// recording the host as one of the client's targets if so.
+func (a *HostAllowlist) allowTarget(client, host string) bool {
+	if a.MaxTargetsPerClient <= 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	if a.now != nil {
+		now = a.now()
+	}
+	window := a.TargetWindow
+	if window <= 0 {
+		window = time.Hour
+	}
+	if a.targets == nil {
+		a.targets = make(map[string]map[string]time.Time)
+	}
+	// Forget the expired targets of all clients once per window, so that
+	// the targets of clients that stopped sending requests are removed
+	if now.Sub(a.lastPrune) >= window {
+		for c, targets := range a.targets {
+			if pruneTargets(targets, now, window) {
+				delete(a.targets, c)
+			}
+		}
+		a.lastPrune = now
+	}
+
+	targets := a.targets[client]
+	pruneTargets(targets, now, window)
+	if _, ok := targets[host]; !ok && len(targets) >= a.MaxTargetsPerClient {
+		return false
+	}
+	if targets == nil {
+		targets = make(map[string]time.Time)
+		a.targets[client] = targets
+	}
+	targets[host] = now
+	return true
+}
+
+// pruneTargets removes the targets last requested before the window
+// preceding now, and reports whether no targets remain.
+func pruneTargets(targets map[string]time.Time, now time.Time, window time.Duration) bool {
+	for host, last := range targets {
+		if now.Sub(last) >= window {
+			delete(targets, host)
+		}
+	}
+	return len(targets) == 0
+}
+
+// HostAllowlistMiddleware returns a handler that wraps h and only serves
+// requests for hosts permitted by the allowlist. Other requests are
+// answered with status code 53 (Proxy request refused).
+// It is intended to wrap handlers that proxy requests to other servers.
+// Note that servers refuse proxy requests unless Server.AllowProxying
+// is set.
+func HostAllowlistMiddleware(h Handler, allow *HostAllowlist) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		host := r.URL.Hostname()
+		if !allow.Allowed(host) || !allow.allowTarget(clientIP(r), host) {
+			w.WriteHeader(StatusProxyRequestRefused, "Proxy request refused")
+			return
+		}
+		h.ServeGemini(ctx, w, r)
+	})
+}
+
+// clientIP returns the IP address of the client that sent the request,
+// or the empty string if it is unknown.
+func clientIP(r *Request) string {
+	conn := r.Conn()
+	if conn == nil {
+		return ""
+	}
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,110 @@
+package gemini
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestHostAllowlist(t *testing.T) {
+	allow := &HostAllowlist{
+		Suffixes: []string{"example.com"},
+		Patterns: []*regexp.Regexp{regexp.MustCompile(`^gemini\.[a-z]+\.org$`)},
+	}
+	tests := []struct {
+		Host    string
+		Allowed bool
+	}{
+		{"example.com", true},
+		{"EXAMPLE.com", true},
+		{"sub.example.com", true},
+		{"badexample.com", false},
+		{"example.com.evil", false},
+		{"gemini.example.org", true},
+		{"www.example.org", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if got := allow.Allowed(test.Host); got != test.Allowed {
+			t.Errorf("Allowed(%q) = %t, want %t", test.Host, got, test.Allowed)
+		}
+	}
+}
+
+func TestHostAllowlistMiddleware(t *testing.T) {
+	allow := &HostAllowlist{
+		Suffixes:            []string{"example.com"},
+		MaxTargetsPerClient: 2,
+	}
+	h := HostAllowlistMiddleware(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	}), allow)
+
+	tests := []struct {
+		URL    string
+		Status Status
+	}{
+		{"gemini://example.org/", StatusProxyRequestRefused},
+		{"gemini://a.example.com/", StatusSuccess},
+		{"gemini://b.example.com/", StatusSuccess},
+		{"gemini://a.example.com/path", StatusSuccess},
+		{"gemini://c.example.com/", StatusProxyRequestRefused},
+	}
+	for _, test := range tests {
+		req, err := NewRequest(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw := &recorder{}
+		h.ServeGemini(context.Background(), rw, req)
+		if rw.Status != test.Status {
+			t.Errorf("%s: expected status %d, got %d", test.URL, test.Status, rw.Status)
+		}
+	}
+}
+
+func TestHostAllowlistTargetWindow(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	allow := &HostAllowlist{
+		MaxTargetsPerClient: 2,
+		TargetWindow:        time.Hour,
+		now:                 func() time.Time { return now },
+	}
+	check := func(client, host string, want bool) {
+		t.Helper()
+		if got := allow.allowTarget(client, host); got != want {
+			t.Errorf("%v: allowTarget(%q, %q) = %t, want %t", now, client, host, got, want)
+		}
+	}
+
+	check("192.0.2.1", "a.example", true)
+	check("192.0.2.1", "b.example", true)
+	check("192.0.2.1", "c.example", false)
+	check("192.0.2.2", "x.example", true)
+
+	// Requesting a host again keeps it in the window
+	now = now.Add(30 * time.Minute)
+	check("192.0.2.1", "a.example", true)
+	now = now.Add(31 * time.Minute)
+	check("192.0.2.1", "c.example", true)
+	check("192.0.2.1", "d.example", false)
+
+	// The targets of idle clients are forgotten
+	allow.mu.Lock()
+	_, ok := allow.targets["192.0.2.2"]
+	allow.mu.Unlock()
+	if ok {
+		t.Error("expected the expired targets of an idle client to be removed")
+	}
+
+	now = now.Add(2 * time.Hour)
+	check("192.0.2.3", "a.example", true)
+	allow.mu.Lock()
+	n := len(allow.targets)
+	allow.mu.Unlock()
+	if n != 1 {
+		t.Errorf("expected the targets of 1 client to be kept, got %d", n)
+	}
+	check("192.0.2.1", "d.example", true)
+}
@@ -0,0 +1,172 @@
+// Package auth implements sessions for Gemini clients identified by
+// their client certificates.
+//
+// A Manager maps the fingerprints of client certificates to sessions,
+// which are kept in a Store. Sessions are created with Login, retrieved
+// with Session and removed with Logout:
+//
+//	manager := &auth.Manager{Store: auth.NewMemoryStore(), MaxAge: 24 * time.Hour}
+//
+//	mux.HandleFunc("/login", func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+//		session, err := manager.Login(r)
+//		if err == auth.ErrNoCertificate {
+//			gemini.CertificateRequired(w)
+//			return
+//		}
+//		// ...
+//	})
+//	mux.Handle("/account", manager.Require(accountHandler))
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+var (
+	// ErrNoCertificate is returned when a request was made without
+	// a client certificate.
+	ErrNoCertificate = errors.New("auth: no client certificate")
+
+	// ErrNoSession is returned when there is no session for a client
+	// certificate, or when the session has expired.
+	ErrNoSession = errors.New("auth: no session")
+)
+
+// A Session holds the data associated with a client certificate.
+type Session struct {
+	// Fingerprint is the fingerprint of the client certificate,
+	// as returned by gemini.Fingerprint.
+	Fingerprint string `json:"fingerprint"`
+
+	// Created is the time at which the session was created.
+	Created time.Time `json:"created"`
+
+	// Expires is the time at which the session expires.
+	// A zero Expires means the session does not expire.
+	Expires time.Time `json:"expires,omitempty"`
+
+	// Values holds arbitrary data associated with the session.
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// Expired reports whether the session has expired at time t.
+func (s *Session) Expired(t time.Time) bool {
+	return !s.Expires.IsZero() && !t.Before(s.Expires)
+}
+
+// A Manager manages the sessions of clients.
+// Its methods are safe for concurrent use if the Store is.
+type Manager struct {
+	// Store holds the sessions.
+	Store Store
+
+	// MaxAge is the duration for which new sessions are valid.
+	// A MaxAge of zero means sessions do not expire.
+	MaxAge time.Duration
+}
+
+// Login creates a new session for the client certificate of the request,
+// replacing any existing session, and saves it in the store.
+// It returns ErrNoCertificate if the request has no client certificate.
+func (m *Manager) Login(r *gemini.Request) (*Session, error) {
+	fp, err := fingerprint(r)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	s := &Session{
+		Fingerprint: fp,
+		Created:     now,
+		Values:      make(map[string]string),
+	}
+	if m.MaxAge != 0 {
+		s.Expires = now.Add(m.MaxAge)
+	}
+	if err := m.Store.Put(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Logout deletes the session for the client certificate of the request.
+// It returns ErrNoCertificate if the request has no client certificate.
+func (m *Manager) Logout(r *gemini.Request) error {
+	fp, err := fingerprint(r)
+	if err != nil {
+		return err
+	}
+	return m.Store.Delete(fp)
+}
+
+// Session returns the session for the client certificate of the request.
+// It returns ErrNoCertificate if the request has no client certificate,
+// and ErrNoSession if there is no session or the session has expired.
+// Expired sessions are deleted from the store.
+func (m *Manager) Session(r *gemini.Request) (*Session, error) {
+	fp, err := fingerprint(r)
+	if err != nil {
+		return nil, err
+	}
+	s, err := m.Store.Get(fp)
+	if err != nil {
+		return nil, err
+	}
+	if s.Expired(time.Now()) {
+		m.Store.Delete(fp)
+		return nil, ErrNoSession
+	}
+	return s, nil
+}
+
+// Save saves changes made to the session's values.
+func (m *Manager) Save(s *Session) error {
+	return m.Store.Put(s)
+}
+
+// sessionContextKey is the context key for the session.
+var sessionContextKey = &struct{ name string }{"auth-session"}
+
+// Require returns a handler that wraps h and only serves requests from
+// clients with a session. Requests without a client certificate are
+// answered with "60 Certificate required", and requests without a session
+// are answered with "61 Certificate not authorized". The session is
+// stored in the context provided to h and can be retrieved with
+// FromContext.
+func (m *Manager) Require(h gemini.Handler) gemini.Handler {
+	return gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		s, err := m.Session(r)
+		switch err {
+		case nil:
+		case ErrNoCertificate:
+			gemini.CertificateRequired(w)
+			return
+		case ErrNoSession:
+			gemini.CertificateNotAuthorized(w)
+			return
+		default:
+			w.WriteHeader(gemini.StatusTemporaryFailure, "Temporary failure")
+			return
+		}
+		h.ServeGemini(context.WithValue(ctx, sessionContextKey, s), w, r)
+	})
+}
+
+// FromContext returns the session stored in ctx by Manager.Require,
+// or nil if ctx contains no session.
+func FromContext(ctx context.Context) *Session {
+	s, _ := ctx.Value(sessionContextKey).(*Session)
+	return s
+}
+
+// fingerprint returns the fingerprint of the request's client certificate.
+func fingerprint(r *gemini.Request) (string, error) {
+	tls := r.TLS()
+	if tls == nil || len(tls.PeerCertificates) == 0 {
+		return "", ErrNoCertificate
+	}
+	return gemini.Fingerprint(tls.PeerCertificates[0]), nil
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+	"git.sr.ht/~adnano/go-gemini/certificate"
+)
+
+// newRequest returns a request received over a TLS connection on which
+// the client presented cert.
+func newRequest(t *testing.T, cert tls.Certificate) *gemini.Request {
+	serverCert, err := certificate.Create(certificate.CreateOptions{
+		DNSNames: []string{"example.com"},
+		Duration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqs := make(chan *gemini.Request, 1)
+	srv := &gemini.Server{
+		Handler: gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+			reqs <- r
+		}),
+	}
+	c1, c2 := net.Pipe()
+	go srv.ServeConn(context.Background(), tls.Server(c2, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequestClientCert,
+	}))
+	client := tls.Client(c1, &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{cert},
+	})
+	defer client.Close()
+	if _, err := io.WriteString(client, "gemini://example.com/\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	go io.Copy(ioutil.Discard, client)
+	return <-reqs
+}
+
+func newCertificate(t *testing.T) tls.Certificate {
+	cert, err := certificate.Create(certificate.CreateOptions{Duration: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestManager(t *testing.T) {
+	m := &Manager{Store: NewMemoryStore()}
+	anonymous, err := gemini.NewRequest("gemini://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Login(anonymous); err != ErrNoCertificate {
+		t.Errorf("expected err = %v without a certificate, got %v", ErrNoCertificate, err)
+	}
+	if _, err := m.Session(anonymous); err != ErrNoCertificate {
+		t.Errorf("expected err = %v without a certificate, got %v", ErrNoCertificate, err)
+	}
+
+	cert := newCertificate(t)
+	req := newRequest(t, cert)
+	if _, err := m.Session(req); err != ErrNoSession {
+		t.Errorf("expected err = %v before login, got %v", ErrNoSession, err)
+	}
+	s, err := m.Login(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := gemini.Fingerprint(cert.Leaf); s.Fingerprint != want {
+		t.Errorf("expected fingerprint %q, got %q", want, s.Fingerprint)
+	}
+	if !s.Expires.IsZero() {
+		t.Errorf("expected session without expiry, got %v", s.Expires)
+	}
+	s.Values["name"] = "alice"
+	if err := m.Save(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sessions are found for later requests with the same certificate
+	got, err := m.Session(newRequest(t, cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Fingerprint != s.Fingerprint || got.Values["name"] != "alice" {
+		t.Errorf("expected session %+v, got %+v", s, got)
+	}
+	if _, err := m.Session(newRequest(t, newCertificate(t))); err != ErrNoSession {
+		t.Errorf("expected err = %v for another certificate, got %v", ErrNoSession, err)
+	}
+
+	if err := m.Logout(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Session(req); err != ErrNoSession {
+		t.Errorf("expected err = %v after logout, got %v", ErrNoSession, err)
+	}
+}
+
+func TestManagerExpiry(t *testing.T) {
+	store := NewMemoryStore()
+	m := &Manager{Store: store, MaxAge: time.Hour}
+	req := newRequest(t, newCertificate(t))
+	s, err := m.Login(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := s.Expires.Sub(s.Created); d != time.Hour {
+		t.Errorf("expected session to expire after %v, got %v", time.Hour, d)
+	}
+	if s.Expired(s.Created) || !s.Expired(s.Expires) {
+		t.Errorf("expected session to expire at %v", s.Expires)
+	}
+	if _, err := m.Session(req); err != nil {
+		t.Errorf("expected valid session, got %v", err)
+	}
+
+	s.Expires = time.Now().Add(-time.Second)
+	if err := m.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Session(req); err != ErrNoSession {
+		t.Errorf("expected err = %v for expired session, got %v", ErrNoSession, err)
+	}
+	if _, err := store.Get(s.Fingerprint); err != ErrNoSession {
+		t.Errorf("expected expired session to be deleted, got %v", err)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	m := &Manager{Store: NewMemoryStore()}
+	var session *Session
+	h := m.Require(gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		session = FromContext(ctx)
+		w.WriteHeader(gemini.StatusSuccess, "text/gemini")
+	}))
+	serve := func(r *gemini.Request) gemini.Status {
+		w := &recorder{}
+		h.ServeGemini(context.Background(), w, r)
+		return w.status
+	}
+
+	anonymous, err := gemini.NewRequest("gemini://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := serve(anonymous); status != gemini.StatusCertificateRequired {
+		t.Errorf("expected status %d without a certificate, got %d", gemini.StatusCertificateRequired, status)
+	}
+	req := newRequest(t, newCertificate(t))
+	if status := serve(req); status != gemini.StatusCertificateNotAuthorized {
+		t.Errorf("expected status %d without a session, got %d", gemini.StatusCertificateNotAuthorized, status)
+	}
+	s, err := m.Login(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := serve(req); status != gemini.StatusSuccess {
+		t.Errorf("expected status %d with a session, got %d", gemini.StatusSuccess, status)
+	}
+	if session == nil || session.Fingerprint != s.Fingerprint {
+		t.Errorf("expected session %+v in the context, got %+v", s, session)
+	}
+}
+
+type recorder struct {
+	status gemini.Status
+}
+
+func (r *recorder) SetMediaType(mediatype string) {}
+func (r *recorder) Write(b []byte) (int, error)   { return len(b), nil }
+func (r *recorder) WriteHeader(status gemini.Status, meta string) {
+	r.status = status
+}
+func (r *recorder) Flush() error  { return nil }
+func (r *recorder) Written() bool { return r.status != 0 }
+func (r *recorder) Close() error  { return nil }
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// A Store stores sessions. Implementations must be safe for concurrent
+// use by multiple goroutines.
+type Store interface {
+	// Get returns the session for the given fingerprint.
+	// It returns ErrNoSession if there is no such session.
+	Get(fingerprint string) (*Session, error)
+
+	// Put stores the session, replacing any existing session
+	// with the same fingerprint.
+	Put(s *Session) error
+
+	// Delete deletes the session for the given fingerprint.
+	// Deleting a session that does not exist is not an error.
+	Delete(fingerprint string) error
+}
+
+// MemoryStore is a Store that keeps sessions in memory.
+type MemoryStore struct {
+	sessions map[string]Session
+	mu       sync.RWMutex
+}
+
+// NewMemoryStore returns a new, empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]Session)}
+}
+
+// Get returns a copy of the session for the given fingerprint.
+func (m *MemoryStore) Get(fingerprint string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	s, ok := m.sessions[fingerprint]
+	if !ok {
+		return nil, ErrNoSession
+	}
+	s.Values = copyValues(s.Values)
+	return &s, nil
+}
+
+// Put stores a copy of the session.
+func (m *MemoryStore) Put(s *Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c := *s
+	c.Values = copyValues(s.Values)
+	m.sessions[s.Fingerprint] = c
+	return nil
+}
+
+// Delete deletes the session for the given fingerprint.
+func (m *MemoryStore) Delete(fingerprint string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.sessions, fingerprint)
+	return nil
+}
+
+func copyValues(values map[string]string) map[string]string {
+	c := make(map[string]string, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
+
+// FileStore is a Store that keeps each session in a JSON file named
+// after its fingerprint in the directory Dir.
+type FileStore struct {
+	Dir string
+}
+
+func (f *FileStore) path(fingerprint string) string {
+	// Fingerprints are hexadecimal, but make sure that they
+	// cannot refer to files outside of Dir.
+	return filepath.Join(f.Dir, filepath.Base(fingerprint)+".json")
+}
+
+// Get reads the session for the given fingerprint.
+func (f *FileStore) Get(fingerprint string) (*Session, error) {
+	b, err := ioutil.ReadFile(f.path(fingerprint))
+	if os.IsNotExist(err) {
+		return nil, ErrNoSession
+	} else if err != nil {
+		return nil, err
+	}
+	s := &Session{}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	// Empty values are omitted from the file
+	if s.Values == nil {
+		s.Values = make(map[string]string)
+	}
+	return s, nil
+}
+
+// Put writes the session to its file, creating Dir if necessary.
+// The file is replaced atomically.
+func (f *FileStore) Put(s *Session) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.Dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(f.Dir, ".session-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(s.Fingerprint))
+}
+
+// Delete removes the file of the session for the given fingerprint.
+func (f *FileStore) Delete(fingerprint string) error {
+	err := os.Remove(f.path(fingerprint))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreCopies(t *testing.T) {
+	store := NewMemoryStore()
+	s := &Session{Fingerprint: "abc", Values: map[string]string{"k": "v"}}
+	if err := store.Put(s); err != nil {
+		t.Fatal(err)
+	}
+	s.Values["k"] = "changed"
+
+	got, err := store.Get("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Values["k"] != "v" {
+		t.Errorf("expected stored value %q, got %q", "v", got.Values["k"])
+	}
+	got.Values["k"] = "changed"
+	got.Values["new"] = "value"
+
+	again, err := store.Get("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Values["k"] != "v" || len(again.Values) != 1 {
+		t.Errorf("expected the stored session to be unmodified, got %v", again.Values)
+	}
+
+	if err := store.Delete("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("abc"); err != ErrNoSession {
+		t.Errorf("expected err = %v after delete, got %v", ErrNoSession, err)
+	}
+	if err := store.Delete("abc"); err != nil {
+		t.Errorf("expected deleting a missing session to succeed, got %v", err)
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "sessions")
+	store := &FileStore{Dir: dir}
+	if _, err := store.Get("abc"); err != ErrNoSession {
+		t.Errorf("expected err = %v for a missing session, got %v", ErrNoSession, err)
+	}
+
+	created := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := &Session{
+		Fingerprint: "abc",
+		Created:     created,
+		Expires:     created.Add(time.Hour),
+		Values:      map[string]string{"name": "alice"},
+	}
+	if err := store.Put(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// A new store for the same directory reads the saved session
+	got, err := (&FileStore{Dir: dir}).Get("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Fingerprint != s.Fingerprint || !got.Created.Equal(s.Created) ||
+		!got.Expires.Equal(s.Expires) || got.Values["name"] != "alice" {
+		t.Errorf("expected session %+v, got %+v", s, got)
+	}
+
+	// Sessions without values can have values set after a round trip
+	if err := store.Put(&Session{Fingerprint: "empty", Values: make(map[string]string)}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = store.Get("empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Values["name"] = "bob"
+	if err := store.Put(got); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Get("empty"); err != nil || got.Values["name"] != "bob" {
+		t.Errorf("expected stored value %q, got %+v (err = %v)", "bob", got, err)
+	}
+
+	if err := store.Delete("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("abc"); err != ErrNoSession {
+		t.Errorf("expected err = %v after delete, got %v", ErrNoSession, err)
+	}
+	if err := store.Delete("abc"); err != nil {
+		t.Errorf("expected deleting a missing session to succeed, got %v", err)
+	}
+}
+
+func TestFileStorePath(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "sessions")
+	store := &FileStore{Dir: dir}
+	if err := store.Put(&Session{Fingerprint: "../evil"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "evil.json")); !os.IsNotExist(err) {
+		t.Errorf("expected no session file outside of Dir, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.json")); err != nil {
+		t.Errorf("expected session file in Dir, got %v", err)
+	}
+	if _, err := store.Get("../../sessions/evil"); err != nil {
+		t.Errorf("expected the key to refer to the file in Dir, got %v", err)
+	}
+}
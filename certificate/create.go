@@ -11,9 +11,11 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"io/ioutil"
 	"math/big"
 	"net"
 	"os"
+	"path/filepath"
 	"time"
 )
 
@@ -116,27 +118,48 @@ func newX509KeyPair(options CreateOptions) (*x509.Certificate, crypto.PrivateKey
 
 // Write writes the provided certificate and its private key
 // to certPath and keyPath respectively.
+//
+// The files are written atomically, so that readers never observe
+// partially written certificates or keys.
 func Write(cert tls.Certificate, certPath, keyPath string) error {
-	certOut, err := os.OpenFile(certPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	certPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: cert.Leaf.Raw,
+	})
+	privBytes, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
 	if err != nil {
 		return err
 	}
-	defer certOut.Close()
-	if err := pem.Encode(certOut, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: cert.Leaf.Raw,
-	}); err != nil {
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
+
+	// Write the key first so that a reader that sees the new
+	// certificate also sees its private key.
+	if err := writeFile(keyPath, keyPEM); err != nil {
 		return err
 	}
+	return writeFile(certPath, certPEM)
+}
 
-	keyOut, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+// writeFile atomically writes data to the named file by writing
+// to a temporary file in the same directory and renaming it.
+func writeFile(name string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
 	if err != nil {
 		return err
 	}
-	defer keyOut.Close()
-	privBytes, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
-	if err != nil {
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
 		return err
 	}
-	return pem.Encode(keyOut, &pem.Block{Type: "PRIVATE KEY", Bytes: privBytes})
+	return nil
 }
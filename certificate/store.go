@@ -121,6 +121,12 @@ func (s *Store) Get(hostname string) (*tls.Certificate, error) {
 
 	// If the certificate is empty or expired, generate a new one.
 	if cert.Leaf == nil || cert.Leaf.NotAfter.Before(time.Now()) {
+		// Another process sharing the certificate directory
+		// may have already created a new certificate.
+		if loaded, ok := s.reload(hostname); ok {
+			return &loaded, nil
+		}
+
 		var err error
 		cert, err = s.createCertificate(hostname)
 		if err != nil {
@@ -134,6 +140,36 @@ func (s *Store) Get(hostname string) (*tls.Certificate, error) {
 	return &cert, nil
 }
 
+// reload loads the certificate for the given scope from the store's path
+// and adds it to the store if it is valid and has not expired.
+func (s *Store) reload(scope string) (tls.Certificate, bool) {
+	s.mu.RLock()
+	path := s.path
+	s.mu.RUnlock()
+	if path == "" {
+		return tls.Certificate{}, false
+	}
+
+	certPath := filepath.Join(path, scope+".crt")
+	keyPath := filepath.Join(path, scope+".key")
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return tls.Certificate{}, false
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	if err != nil || cert.Leaf.NotAfter.Before(time.Now()) {
+		return tls.Certificate{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.certs == nil {
+		s.certs = make(map[string]tls.Certificate)
+	}
+	s.certs[scope] = cert
+	return cert, true
+}
+
 // Lookup returns the certificate for the provided scope.
 func (s *Store) Lookup(scope string) (tls.Certificate, bool) {
 	s.mu.RLock()
@@ -160,6 +196,11 @@ func (s *Store) createCertificate(scope string) (tls.Certificate, error) {
 // The path should lead to a directory containing certificates
 // and private keys named "scope.crt" and "scope.key" respectively,
 // where "scope" is the scope of the certificate.
+//
+// Multiple processes, such as servers listening on the same port with
+// SO_REUSEPORT, may load the same path. Before creating a missing or
+// expired certificate, Get checks whether another process has already
+// written a valid one to the path and uses it instead.
 func (s *Store) Load(path string) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
 		return err
@@ -188,6 +229,20 @@ func (s *Store) Load(path string) error {
 	return nil
 }
 
+// Reload loads certificates from the path provided to Load or SetPath,
+// replacing existing certificates with the same scopes. It can be used
+// to pick up certificates that were renewed by another program.
+// Reload returns an error if no path has been set.
+func (s *Store) Reload() error {
+	s.mu.RLock()
+	path := s.path
+	s.mu.RUnlock()
+	if path == "" {
+		return errors.New("certificate: no path set")
+	}
+	return s.Load(path)
+}
+
 // Entries returns a map of scopes to certificates.
 func (s *Store) Entries() map[string]tls.Certificate {
 	s.mu.RLock()
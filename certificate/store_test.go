@@ -0,0 +1,94 @@
+package certificate
+
+import (
+	"bytes"
+	"crypto/tls"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newCertificate(t *testing.T, scope string, d time.Duration) tls.Certificate {
+	t.Helper()
+	cert, err := Create(CreateOptions{DNSNames: []string{scope}, Duration: d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestStoreReload(t *testing.T) {
+	var s Store
+	if err := s.Reload(); err == nil {
+		t.Error("expected an error without a path")
+	}
+
+	dir := t.TempDir()
+	if err := s.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	old := newCertificate(t, "example.com", time.Hour)
+	if err := s.Add("example.com", old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another program renews the certificate
+	renewed := newCertificate(t, "example.com", time.Hour)
+	err := Write(renewed, filepath.Join(dir, "example.com.crt"), filepath.Join(dir, "example.com.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert, _ := s.Lookup("example.com"); !bytes.Equal(cert.Certificate[0], old.Certificate[0]) {
+		t.Fatal("expected the old certificate before Reload")
+	}
+	if err := s.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	cert, ok := s.Lookup("example.com")
+	if !ok || !bytes.Equal(cert.Certificate[0], renewed.Certificate[0]) {
+		t.Error("expected the renewed certificate after Reload")
+	}
+	if cert.Leaf == nil {
+		t.Error("expected the reloaded certificate to be parsed")
+	}
+}
+
+func TestStoreGetShared(t *testing.T) {
+	dir := t.TempDir()
+	var a, b Store
+	for _, s := range []*Store{&a, &b} {
+		s.Register("example.com")
+		if err := s.Load(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.Add("example.com", newCertificate(t, "example.com", -time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Load(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first store replaces the expired certificate
+	created, err := a.Get("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Leaf.NotAfter.Before(time.Now()) {
+		t.Fatal("expected a new certificate")
+	}
+
+	// The second store uses the certificate written by the first
+	// instead of creating another one
+	b.CreateCertificate = func(scope string) (tls.Certificate, error) {
+		t.Error("unexpected call to CreateCertificate")
+		return Create(CreateOptions{DNSNames: []string{scope}, Duration: time.Hour})
+	}
+	got, err := b.Get("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Certificate[0], created.Certificate[0]) {
+		t.Error("expected the certificate created by the other store")
+	}
+}
@@ -0,0 +1,213 @@
+// Package cgi implements CGI (Common Gateway Interface) for Gemini servers.
+//
+// The Handler executes an external program for each request. Information
+// about the request is passed to the program in environment variables such
+// as GEMINI_URL, PATH_INFO, QUERY_STRING and TLS_CLIENT_HASH. The program
+// must write a complete Gemini response, including the response header,
+// to its standard output.
+//
+// Executables can be used with gemini.FileServerOptions to run the
+// executable files served by a file server.
+package cgi
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// Handler runs an executable in a subprocess with a CGI environment.
+type Handler struct {
+	// Path is the path to the CGI executable.
+	Path string
+
+	// Root is the root URL path prefix of the handler; empty means "/".
+	// The part of the request path following Root is passed to the
+	// program in the PATH_INFO environment variable. Root only matches
+	// whole path segments, so that a Root of "/cgi" does not match the
+	// path "/cgibin".
+	Root string
+
+	// Dir specifies the working directory of the program.
+	// If Dir is empty, the base directory of Path is used.
+	Dir string
+
+	// Env specifies extra environment variables to set, in the
+	// form "key=value".
+	Env []string
+
+	// Args specifies optional arguments to pass to the program.
+	Args []string
+
+	// ErrorLog specifies an optional logger for errors running the
+	// program. If nil, logging is done via the log package's
+	// standard logger.
+	ErrorLog interface {
+		Printf(format string, v ...interface{})
+	}
+}
+
+// ServeGemini runs the program and relays its response to w.
+// The body of Titan upload requests is passed to the program on its
+// standard input. If the program fails to run or writes an invalid response header,
+// the handler responds with "42 CGI error".
+func (h *Handler) ServeGemini(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	dir := h.Dir
+	if dir == "" {
+		dir = filepath.Dir(h.Path)
+	}
+
+	cmd := exec.CommandContext(ctx, h.Path, h.Args...)
+	cmd.Dir = dir
+	cmd.Env = Environ(r, h.Root)
+	if path := os.Getenv("PATH"); path != "" {
+		cmd.Env = append(cmd.Env, "PATH="+path)
+	}
+	cmd.Env = append(cmd.Env, h.Env...)
+	if r.Body != nil && r.Titan != nil {
+		cmd.Stdin = io.LimitReader(r.Body, r.Titan.Size)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		h.logf("cgi: %v", err)
+		w.WriteHeader(gemini.StatusCGIError, "CGI error")
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		h.logf("cgi: failed to start %s: %v", h.Path, err)
+		w.WriteHeader(gemini.StatusCGIError, "CGI error")
+		return
+	}
+	defer func() {
+		if err := cmd.Wait(); err != nil {
+			h.logf("cgi: %s: %v", h.Path, err)
+		}
+	}()
+
+	resp, err := gemini.ReadResponse(stdout)
+	if err != nil {
+		h.logf("cgi: %s: invalid response: %v", h.Path, err)
+		w.WriteHeader(gemini.StatusCGIError, "CGI error")
+		return
+	}
+	defer resp.Body.Close()
+
+	w.WriteHeader(resp.Status, resp.Meta)
+	if _, err := copyFlush(w, resp.Body); err != nil {
+		h.logf("cgi: %s: %v", h.Path, err)
+	}
+}
+
+// copyFlush copies from src to w, flushing after each read so that
+// output is streamed to the client as the program produces it.
+func copyFlush(w gemini.ResponseWriter, src io.Reader) (int64, error) {
+	var written int64
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			m, werr := w.Write(buf[:n])
+			written += int64(m)
+			if werr != nil {
+				return written, werr
+			}
+			if werr := w.Flush(); werr != nil {
+				return written, werr
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return written, nil
+			}
+			return written, err
+		}
+	}
+}
+
+// Environ returns the CGI environment variables for the request r,
+// in the form "key=value". root is the root URL path prefix of the
+// handler as described in Handler; empty means "/". For Titan upload
+// requests, the size and media type of the body are passed in
+// CONTENT_LENGTH and CONTENT_TYPE.
+//
+// Environ can be used to implement other gateway interfaces, such as
+// SCGI, that use the same variables.
+func Environ(r *gemini.Request, root string) []string {
+	if root == "" {
+		root = "/"
+	}
+	root = strings.TrimSuffix(root, "/")
+	pathInfo := r.URL.Path
+	if rest := strings.TrimPrefix(pathInfo, root); rest != pathInfo && (rest == "" || rest[0] == '/') {
+		pathInfo = rest
+	}
+
+	env := []string{
+		"GATEWAY_INTERFACE=CGI/1.1",
+		"SERVER_PROTOCOL=GEMINI",
+		"SERVER_SOFTWARE=go-gemini",
+		"GEMINI_URL=" + r.URL.String(),
+		"SCRIPT_NAME=" + root,
+		"PATH_INFO=" + pathInfo,
+		"QUERY_STRING=" + r.URL.RawQuery,
+	}
+	if r.Titan != nil {
+		env = append(env,
+			"CONTENT_LENGTH="+strconv.FormatInt(r.Titan.Size, 10),
+			"CONTENT_TYPE="+r.Titan.MediaType,
+		)
+	}
+	if name := r.ServerName(); name != "" {
+		env = append(env, "SERVER_NAME="+name)
+	} else {
+		env = append(env, "SERVER_NAME="+r.URL.Hostname())
+	}
+	if port := r.URL.Port(); port != "" {
+		env = append(env, "SERVER_PORT="+port)
+	} else {
+		env = append(env, "SERVER_PORT=1965")
+	}
+
+	if conn := r.Conn(); conn != nil {
+		if host, port, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+			env = append(env, "REMOTE_ADDR="+host, "REMOTE_HOST="+host, "REMOTE_PORT="+port)
+		}
+	}
+
+	if tls := r.TLS(); tls != nil {
+		if len(tls.PeerCertificates) > 0 {
+			cert := tls.PeerCertificates[0]
+			hash, _ := gemini.FingerprintOptions{Format: gemini.FingerprintHexUpper}.Fingerprint(cert)
+			env = append(env,
+				"AUTH_TYPE=CERTIFICATE",
+				"REMOTE_USER="+cert.Subject.CommonName,
+				"TLS_CLIENT_HASH=SHA256:"+hash,
+				"TLS_CLIENT_SUBJECT="+cert.Subject.String(),
+				"TLS_CLIENT_ISSUER="+cert.Issuer.String(),
+				"TLS_CLIENT_NOT_BEFORE="+cert.NotBefore.UTC().Format(time.RFC3339),
+				"TLS_CLIENT_NOT_AFTER="+cert.NotAfter.UTC().Format(time.RFC3339),
+				"TLS_CLIENT_SERIAL_NUMBER="+cert.SerialNumber.String(),
+			)
+		}
+	}
+	return env
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
@@ -0,0 +1,109 @@
+package cgi
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+func lookupEnv(env []string, key string) (string, bool) {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			return strings.TrimPrefix(kv, key+"="), true
+		}
+	}
+	return "", false
+}
+
+func TestEnviron(t *testing.T) {
+	tests := []struct {
+		Root       string
+		Path       string
+		ScriptName string
+		PathInfo   string
+	}{
+		{"", "/a/b", "", "/a/b"},
+		{"/", "/a/b", "", "/a/b"},
+		{"/cgi", "/cgi", "/cgi", ""},
+		{"/cgi/", "/cgi", "/cgi", ""},
+		{"/cgi", "/cgi/", "/cgi", "/"},
+		{"/cgi", "/cgi/bin/x", "/cgi", "/bin/x"},
+		{"/cgi/", "/cgi/bin/x", "/cgi", "/bin/x"},
+		{"/cgi", "/cgibin/x", "/cgi", "/cgibin/x"},
+		{"/cgi", "/other", "/cgi", "/other"},
+	}
+	for _, test := range tests {
+		req, err := gemini.NewRequest("gemini://example.com" + test.Path + "?q")
+		if err != nil {
+			t.Fatal(err)
+		}
+		env := Environ(req, test.Root)
+		if got, _ := lookupEnv(env, "SCRIPT_NAME"); got != test.ScriptName {
+			t.Errorf("%q %q: expected SCRIPT_NAME=%q, got %q", test.Root, test.Path, test.ScriptName, got)
+		}
+		if got, _ := lookupEnv(env, "PATH_INFO"); got != test.PathInfo {
+			t.Errorf("%q %q: expected PATH_INFO=%q, got %q", test.Root, test.Path, test.PathInfo, got)
+		}
+		if got, _ := lookupEnv(env, "QUERY_STRING"); got != "q" {
+			t.Errorf("%q %q: expected QUERY_STRING=%q, got %q", test.Root, test.Path, "q", got)
+		}
+		if _, ok := lookupEnv(env, "CONTENT_LENGTH"); ok {
+			t.Errorf("%q %q: unexpected CONTENT_LENGTH for a Gemini request", test.Root, test.Path)
+		}
+	}
+}
+
+type recorder struct {
+	status gemini.Status
+	meta   string
+	body   bytes.Buffer
+}
+
+func (r *recorder) SetMediaType(mediatype string) {}
+func (r *recorder) Write(b []byte) (int, error)   { return r.body.Write(b) }
+func (r *recorder) WriteHeader(status gemini.Status, meta string) {
+	r.status, r.meta = status, meta
+}
+func (r *recorder) Flush() error  { return nil }
+func (r *recorder) Written() bool { return r.status != 0 }
+func (r *recorder) Close() error  { return nil }
+
+func TestHandlerTitan(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+	script := filepath.Join(t.TempDir(), "upload.sh")
+	const program = "printf '20 text/plain\\r\\n'\n" +
+		"echo \"$CONTENT_LENGTH $CONTENT_TYPE $PATH_INFO\"\n" +
+		"cat\n"
+	if err := ioutil.WriteFile(script, []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse("titan://example.com/cgi/upload.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &gemini.Request{
+		URL:   u,
+		Titan: &gemini.TitanParameters{Size: 5, MediaType: "text/plain"},
+		Body:  strings.NewReader("hello, and more"),
+	}
+	h := &Handler{Path: sh, Args: []string{script}, Root: "/cgi"}
+	w := &recorder{}
+	h.ServeGemini(context.Background(), w, req)
+	if w.status != gemini.StatusSuccess || w.meta != "text/plain" {
+		t.Errorf("expected 20 text/plain, got %d %s", w.status, w.meta)
+	}
+	if want := "5 text/plain /upload.txt\nhello"; w.body.String() != want {
+		t.Errorf("expected body %q, got %q", want, w.body.String())
+	}
+}
@@ -0,0 +1,47 @@
+// +build go1.16
+
+package cgi
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"path/filepath"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// Executables returns a function for use as the CGI field of
+// gemini.FileServerOptions that runs executable files as CGI programs.
+// dir is the directory in the operating system's file system that the
+// file server serves, typically with os.DirFS(dir).
+//
+// Files are run if they have any of the executable permission bits set,
+// or if their name has one of the provided extensions, such as ".cgi".
+// The program is run as described in Handler, with the request path as
+// the root URL path prefix.
+func Executables(dir string, extensions ...string) func(name string, info fs.FileInfo) gemini.Handler {
+	return func(name string, info fs.FileInfo) gemini.Handler {
+		if !isExecutable(name, info, extensions) {
+			return nil
+		}
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		return gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+			h := &Handler{Path: file, Root: r.URL.Path}
+			h.ServeGemini(ctx, w, r)
+		})
+	}
+}
+
+func isExecutable(name string, info fs.FileInfo, extensions []string) bool {
+	if info.Mode().Perm()&0111 != 0 {
+		return true
+	}
+	ext := path.Ext(name)
+	for _, e := range extensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
@@ -12,6 +12,13 @@ import (
 )
 
 // A Client is a Gemini client. Its zero value is a usable client.
+//
+// A Client is safe for concurrent use by multiple goroutines.
+// Each request uses a snapshot of the Client's fields taken when the
+// request is made, so modifying the fields does not affect requests
+// that are already in progress. Functions provided in the fields, such
+// as TrustCertificate, may be called concurrently and must therefore be
+// safe for concurrent use.
 type Client struct {
 	// TrustCertificate is called to determine whether the client should
 	// trust the certificate provided by the server.
@@ -25,6 +32,13 @@ type Client struct {
 	// DialContext specifies the dial function for creating TCP connections.
 	// If DialContext is nil, the client dials using package net.
 	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Decompress specifies whether the client should transparently
+	// decompress successful responses whose media type has a "+gzip"
+	// suffix, such as "text/gemini+gzip". If true, the suffix is removed
+	// from the response meta and the response body is decompressed
+	// as it is read.
+	Decompress bool
 }
 
 // Get sends a Gemini request for the given URL.
@@ -60,6 +74,10 @@ func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
 		panic("nil context")
 	}
 
+	// Use a snapshot of the client's configuration for this request
+	config := *c
+	c = &config
+
 	// Punycode request URL host
 	host, port := splitHostPort(req.URL.Host)
 	punycode, err := punycodeHostname(host)
@@ -166,6 +184,13 @@ func (c *Client) do(ctx context.Context, conn net.Conn, req *Request) (*Response
 	}
 	resp.conn = conn
 
+	if c.Decompress {
+		if err := decompressResponse(resp); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+
 	return resp, nil
 }
 
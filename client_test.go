@@ -0,0 +1,156 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
+	"git.sr.ht/~adnano/go-gemini/geminitest"
+)
+
+func TestClientConcurrent(t *testing.T) {
+	cert, err := certificate.Create(certificate.CreateOptions{
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		Duration:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			fmt.Fprint(w, r.URL.Path)
+		}),
+		GetCertificate: func(string) (*tls.Certificate, error) {
+			return &cert, nil
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(context.Background(), l)
+	defer srv.Close()
+
+	var mu sync.Mutex
+	trusted := map[string]int{}
+	client := &Client{
+		TrustCertificate: func(hostname string, cert *x509.Certificate) error {
+			mu.Lock()
+			defer mu.Unlock()
+			trusted[hostname]++
+			return nil
+		},
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			path := fmt.Sprintf("/%d", i)
+			resp, err := client.Get(context.Background(), "gemini://"+l.Addr().String()+path)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if string(body) != path {
+				errs <- fmt.Errorf("expected body %q, got %q", path, body)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if trusted["127.0.0.1"] != n {
+		t.Errorf("expected %d calls to TrustCertificate, got %d", n, trusted["127.0.0.1"])
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	cert, err := certificate.Create(certificate.CreateOptions{
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		Duration:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var conns int
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			mu.Lock()
+			conns++
+			n := conns
+			mu.Unlock()
+			fmt.Fprintf(w, "# Connection %d\n", n)
+		}),
+		GetCertificate: func(string) (*tls.Certificate, error) {
+			return &cert, nil
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(context.Background(), l)
+	defer srv.Close()
+
+	errStop := errors.New("stop")
+	var lines []Line
+	client := &Client{}
+	err = client.Stream(context.Background(), "gemini://"+l.Addr().String(), func(line Line) error {
+		lines = append(lines, line)
+		if len(lines) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("expected err = %v, got %v", errStop, err)
+	}
+	want := []Line{LineHeading1("Connection 1"), LineHeading1("Connection 2")}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("expected lines %v, got %v", want, lines)
+	}
+}
+
+func TestClientMalformedResponse(t *testing.T) {
+	srv := geminitest.NewTranscriptServer(
+		[]byte("20text/gemini\r\n"),
+		[]byte("2 text/gemini\r\n"),
+		[]byte("20 text/gemini\n"),
+		[]byte("20 text/gemini"),
+	)
+	defer srv.Close()
+
+	client := &Client{}
+	for i := 0; i < 4; i++ {
+		resp, err := client.Get(context.Background(), srv.URL)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("transcript %d: expected error, got status %d", i, resp.Status)
+		}
+	}
+	if n := len(srv.Requests()); n != 4 {
+		t.Errorf("expected 4 requests, got %d", n)
+	}
+}
@@ -0,0 +1,71 @@
+package gemini
+
+import (
+	"compress/gzip"
+	"io"
+	"strings"
+)
+
+// gzipSuffix is the media type suffix of gzip-compressed responses.
+const gzipSuffix = "+gzip"
+
+// addMediaTypeSuffix adds the provided suffix to the subtype of mediatype,
+// preserving any parameters.
+func addMediaTypeSuffix(mediatype, suffix string) string {
+	base, params := splitMediaType(mediatype)
+	return base + suffix + params
+}
+
+// trimMediaTypeSuffix removes the provided suffix from the subtype of
+// mediatype, preserving any parameters. It reports whether the suffix
+// was present.
+func trimMediaTypeSuffix(mediatype, suffix string) (string, bool) {
+	base, params := splitMediaType(mediatype)
+	if !strings.HasSuffix(base, suffix) {
+		return mediatype, false
+	}
+	return strings.TrimSuffix(base, suffix) + params, true
+}
+
+// splitMediaType splits mediatype into the media type itself and
+// its parameters, if any.
+func splitMediaType(mediatype string) (base, params string) {
+	if i := strings.IndexByte(mediatype, ';'); i != -1 {
+		return strings.TrimSpace(mediatype[:i]), mediatype[i:]
+	}
+	return mediatype, ""
+}
+
+// decompressResponse replaces the body of resp with a decompressing reader
+// if its media type has a "+gzip" suffix, and removes the suffix from the
+// response meta.
+func decompressResponse(resp *Response) error {
+	if !resp.Status.Success() {
+		return nil
+	}
+	meta, ok := trimMediaTypeSuffix(resp.Meta, gzipSuffix)
+	if !ok {
+		return nil
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Meta = meta
+	resp.Body = &gzipReadCloser{zr, resp.Body}
+	return nil
+}
+
+type gzipReadCloser struct {
+	zr *gzip.Reader
+	rc io.ReadCloser
+}
+
+func (r *gzipReadCloser) Read(p []byte) (int, error) {
+	return r.zr.Read(p)
+}
+
+func (r *gzipReadCloser) Close() error {
+	r.zr.Close()
+	return r.rc.Close()
+}
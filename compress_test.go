@@ -0,0 +1,55 @@
+package gemini
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDecompressResponse(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte("# Hello, world!\n"))
+	zw.Close()
+
+	raw := "20 text/gemini+gzip; lang=en\r\n" + buf.String()
+	resp, err := ReadResponse(ioutil.NopCloser(bytes.NewReader([]byte(raw))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decompressResponse(resp); err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if want := "text/gemini; lang=en"; resp.Meta != want {
+		t.Errorf("expected meta %q, got %q", want, resp.Meta)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# Hello, world!\n"; string(body) != want {
+		t.Errorf("expected body %q, got %q", want, body)
+	}
+}
+
+func TestMediaTypeSuffix(t *testing.T) {
+	tests := []struct {
+		MediaType string
+		Suffixed  string
+	}{
+		{"text/gemini", "text/gemini+gzip"},
+		{"text/plain; charset=utf-8", "text/plain+gzip; charset=utf-8"},
+	}
+	for _, test := range tests {
+		if got := addMediaTypeSuffix(test.MediaType, gzipSuffix); got != test.Suffixed {
+			t.Errorf("expected %q, got %q", test.Suffixed, got)
+		}
+		got, ok := trimMediaTypeSuffix(test.Suffixed, gzipSuffix)
+		if !ok || got != test.MediaType {
+			t.Errorf("expected %q, got %q", test.MediaType, got)
+		}
+	}
+}
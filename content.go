@@ -0,0 +1,69 @@
+package gemini
+
+import (
+	"context"
+	"io"
+	"mime"
+	"os"
+	"path"
+)
+
+// ServeContent responds to the request with the provided content. The
+// media type of the response is detected from the extension of name.
+//
+// The content is streamed to the client without being buffered in
+// memory. If content implements a Stat method, such as an fs.File or an
+// *os.File, or an io.Seeker, its size is determined beforehand, and
+// errors copying it, including short copies, are logged by the server
+// serving the request, if any, together with the name and the size.
+func ServeContent(ctx context.Context, w ResponseWriter, r *Request, name string, content io.Reader) {
+	ServeReader(ctx, w, r, mime.TypeByExtension(path.Ext(name)), name, content)
+}
+
+// ServeReader is like ServeContent, but responds with the provided media
+// type. name is used only for logging and may be empty. If mediatype is
+// empty, the default media type of the ResponseWriter is used.
+func ServeReader(ctx context.Context, w ResponseWriter, r *Request, mediatype, name string, content io.Reader) {
+	size := contentSize(content)
+	w.SetMediaType(mediatype)
+	n, err := copyBody(w, content)
+	if err == nil && size >= 0 && n != size {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		if srv := ServerFromContext(ctx); srv != nil {
+			srv.logError("error serving content", "url", r.URL, "name", name, "size", size, "written", n, "err", err)
+		}
+	}
+}
+
+// contentSize returns the size in bytes of the remaining content, or -1
+// if it is unknown.
+func contentSize(content io.Reader) int64 {
+	switch c := content.(type) {
+	case interface{ Stat() (os.FileInfo, error) }:
+		if info, err := c.Stat(); err == nil && info.Mode().IsRegular() {
+			if s, ok := content.(io.Seeker); ok {
+				// Account for content that has already been read
+				if offset, err := s.Seek(0, io.SeekCurrent); err == nil {
+					return info.Size() - offset
+				}
+			}
+			return info.Size()
+		}
+	case io.Seeker:
+		offset, err := c.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := c.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		if _, err := c.Seek(offset, io.SeekStart); err != nil {
+			return -1
+		}
+		return end - offset
+	}
+	return -1
+}
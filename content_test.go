@@ -0,0 +1,97 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestServeContent(t *testing.T) {
+	req, err := NewRequest("gemini://example.com/page.gmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &recorder{}
+	ServeContent(context.Background(), w, req, "page.gmi", strings.NewReader("# Page\n"))
+	if w.Status != StatusSuccess || w.mediatype != "text/gemini; charset=utf-8" || w.Body.String() != "# Page\n" {
+		t.Errorf("unexpected response %d %q %q", w.Status, w.mediatype, w.Body.String())
+	}
+
+	w = &recorder{}
+	ServeReader(context.Background(), w, req, "text/plain", "", strings.NewReader("text"))
+	if w.mediatype != "text/plain" || w.Body.String() != "text" {
+		t.Errorf("unexpected response %q %q", w.mediatype, w.Body.String())
+	}
+}
+
+func TestServeContentShortWrite(t *testing.T) {
+	var logs []string
+	srv := &Server{ErrorLog: logFunc(func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})}
+	ctx := context.WithValue(context.Background(), serverContextKey, srv)
+	req, err := NewRequest("gemini://example.com/page.gmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The underlying content is larger than what can be read
+	content := &limitedSeeker{strings.NewReader("0123456789"), 4}
+	ServeContent(ctx, &recorder{}, req, "page.gmi", content)
+	if len(logs) != 1 || !strings.Contains(logs[0], "size=10") || !strings.Contains(logs[0], "written=4") {
+		t.Errorf("expected short write to be logged, got %q", logs)
+	}
+}
+
+type logFunc func(format string, args ...interface{})
+
+func (f logFunc) Printf(format string, args ...interface{}) {
+	f(format, args...)
+}
+
+// limitedSeeker reads at most n bytes from r, but seeks in all of r.
+type limitedSeeker struct {
+	r *strings.Reader
+	n int64
+}
+
+func (r *limitedSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.r.Seek(offset, whence)
+}
+
+func (r *limitedSeeker) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n -= int64(n)
+	return n, err
+}
+
+func TestContentSize(t *testing.T) {
+	r := strings.NewReader("0123456789")
+	r.Read(make([]byte, 3))
+	if size := contentSize(r); size != 7 {
+		t.Errorf("expected size 7 of seeker, got %d", size)
+	}
+	if size := contentSize(ioutil.NopCloser(r)); size != -1 {
+		t.Errorf("expected unknown size of reader, got %d", size)
+	}
+
+	f, err := ioutil.TempFile(t.TempDir(), "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString("0123456789")
+	f.Seek(2, io.SeekStart)
+	if size := contentSize(f); size != 8 {
+		t.Errorf("expected size 8 of file, got %d", size)
+	}
+}
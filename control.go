@@ -0,0 +1,133 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// ServeControl serves a line-based control protocol on the listener l,
+// allowing operators to manage a running server. l is typically a Unix
+// socket that is only accessible to the operator, for example:
+//
+//	l, err := net.Listen("unix", "/run/gemini/control.sock")
+//	if err != nil {
+//		// handle error
+//	}
+//	go server.ServeControl(ctx, l)
+//
+// The client sends one command per line. The server responds with zero or
+// more lines of output followed by a line containing "OK" if the command
+// succeeded, or "ERR" and a description of the error otherwise.
+// The following commands are supported:
+//
+//	help      list the supported commands
+//	reload    reload certificates from the path of the Certificates store
+//	routes    list the patterns registered with the server's Mux
+//	conns     list the remote addresses of active connections
+//	shutdown  gracefully shut down the server (see Shutdown)
+//
+// The control protocol provides no authentication. Access should be
+// restricted with file system permissions or similar means.
+//
+// ServeControl always closes l and returns a non-nil error.
+// If the provided context expires, the returned error is the context's error.
+func (srv *Server) ServeControl(ctx context.Context, l net.Listener) error {
+	defer l.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go srv.serveControlConn(ctx, conn)
+	}
+}
+
+func (srv *Server) serveControlConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	w := bufio.NewWriter(conn)
+	for scanner.Scan() {
+		cmd := strings.TrimSpace(scanner.Text())
+		if cmd == "" {
+			continue
+		}
+		if err := srv.controlCommand(w, cmd); err != nil {
+			fmt.Fprintf(w, "ERR %s\n", err)
+		} else {
+			fmt.Fprintln(w, "OK")
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// controlCommand runs the given control command, writing its output to w.
+func (srv *Server) controlCommand(w io.Writer, cmd string) error {
+	switch cmd {
+	case "help":
+		fmt.Fprintln(w, "help reload routes conns shutdown")
+	case "reload":
+		if srv.Certificates == nil {
+			return errors.New("no certificate store")
+		}
+		if err := srv.Certificates.Reload(); err != nil {
+			return err
+		}
+	case "routes":
+		mux, ok := srv.Handler.(*Mux)
+		if !ok {
+			return errors.New("handler is not a *Mux")
+		}
+		for _, pattern := range mux.Patterns() {
+			fmt.Fprintln(w, pattern)
+		}
+	case "conns":
+		for _, addr := range srv.remoteAddrs() {
+			fmt.Fprintln(w, addr)
+		}
+	case "shutdown":
+		go srv.Shutdown(context.Background())
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	return nil
+}
+
+// remoteAddrs returns the remote addresses of the active connections.
+func (srv *Server) remoteAddrs() []net.Addr {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	addrs := make([]net.Addr, 0, len(srv.conns))
+	for conn := range srv.conns {
+		addrs = append(addrs, (*conn).RemoteAddr())
+	}
+	return addrs
+}
@@ -0,0 +1,64 @@
+package gemini
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestServerControl(t *testing.T) {
+	mux := &Mux{}
+	mux.Handle("example.com/", &nopHandler{})
+	mux.Handle("/about", &nopHandler{})
+	srv := &Server{Handler: mux}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() {
+		errch <- srv.ServeControl(ctx, l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	command := func(cmd string) []string {
+		fmt.Fprintln(conn, cmd)
+		var lines []string
+		for scanner.Scan() {
+			line := scanner.Text()
+			lines = append(lines, line)
+			if line == "OK" || strings.HasPrefix(line, "ERR ") {
+				break
+			}
+		}
+		return lines
+	}
+
+	if got, want := strings.Join(command("routes"), "\n"), "/about\nexample.com/\nOK"; got != want {
+		t.Errorf("routes: expected %q, got %q", want, got)
+	}
+	if got, want := strings.Join(command("conns"), "\n"), "OK"; got != want {
+		t.Errorf("conns: expected %q, got %q", want, got)
+	}
+	if got := command("reload"); len(got) != 1 || !strings.HasPrefix(got[0], "ERR ") {
+		t.Errorf("reload: expected error, got %q", got)
+	}
+	if got := command("bogus"); len(got) != 1 || !strings.HasPrefix(got[0], "ERR ") {
+		t.Errorf("bogus: expected error, got %q", got)
+	}
+
+	cancel()
+	if err := <-errch; err != context.Canceled {
+		t.Errorf("expected error %v, got %v", context.Canceled, err)
+	}
+}
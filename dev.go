@@ -0,0 +1,80 @@
+package gemini
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
+	"git.sr.ht/~adnano/go-gemini/tofu"
+)
+
+// DevServer returns a server for local development that serves h on
+// "localhost:1965". The server uses a newly created certificate for
+// localhost which is discarded when the program exits. The fingerprint
+// of the certificate is logged to the log package's standard logger.
+//
+// If knownHostsPath is not empty, the certificate is also added to the
+// known hosts file at that path, so that clients using the file trust the
+// server without prompting. Any existing entry for localhost in the file
+// is replaced. See the tofu submodule for details.
+//
+// The returned server must not be used in production.
+func DevServer(h Handler, knownHostsPath string) (*Server, error) {
+	const hostname = "localhost"
+	cert, err := certificate.Create(certificate.CreateOptions{
+		DNSNames:    []string{hostname},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		Subject: pkix.Name{
+			CommonName: hostname,
+		},
+		Duration: 30 * 24 * time.Hour,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	host := tofu.NewHost(hostname, cert.Leaf.Raw)
+	log.Printf("gemini: development certificate fingerprint: %s %s", host.Algorithm, host.Fingerprint)
+
+	if knownHostsPath != "" {
+		if err := replaceKnownHost(knownHostsPath, host); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Server{
+		Addr:    net.JoinHostPort(hostname, "1965"),
+		Handler: h,
+		GetCertificate: func(string) (*tls.Certificate, error) {
+			return &cert, nil
+		},
+	}, nil
+}
+
+// replaceKnownHost writes host to the known hosts file at path, replacing
+// the entries for the same hostname. Other lines are kept as is.
+func replaceKnownHost(path string, host tofu.Host) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var buf bytes.Buffer
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if h, err := tofu.ParseHost(bytes.TrimSpace(line)); err == nil && h.Hostname == host.Hostname {
+			continue
+		}
+		buf.Write(line)
+	}
+	if n := buf.Len(); n > 0 && buf.Bytes()[n-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(host.String())
+	buf.WriteByte('\n')
+	return ioutil.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,61 @@
+package gemini
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"git.sr.ht/~adnano/go-gemini/tofu"
+)
+
+func TestDevServer(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	const other = "example.com sha256 AAAA\n"
+	if err := ioutil.WriteFile(path, []byte(other+"localhost sha256 stale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var srv *Server
+	for i := 0; i < 2; i++ {
+		var err error
+		srv, err = DevServer(&nopHandler{}, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if srv.Addr != "localhost:1965" {
+		t.Errorf("expected address %q, got %q", "localhost:1965", srv.Addr)
+	}
+	cert, err := srv.GetCertificate("localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each run replaces the entry for localhost
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := other + tofu.NewHost("localhost", cert.Leaf.Raw).String() + "\n"
+	if string(b) != want {
+		t.Errorf("expected known hosts %q, got %q", want, b)
+	}
+
+	// The known hosts file is created if it does not exist
+	path = filepath.Join(t.TempDir(), "new_hosts")
+	if _, err := DevServer(&nopHandler{}, path); err != nil {
+		t.Fatal(err)
+	}
+	var hosts tofu.KnownHosts
+	if err := hosts.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hosts.Lookup("localhost"); !ok || len(hosts.Entries()) != 1 {
+		t.Errorf("expected a single entry for localhost, got %v", hosts.Entries())
+	}
+}
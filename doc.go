@@ -51,5 +51,15 @@ To start the server, call ListenAndServe:
 	if err != nil {
 		// handle error
 	}
+
+ListenAndServe and ServeTLS serve Gemini over TLS. When TLS is terminated
+by a fronting proxy, serve the plaintext connections from the proxy with
+Serve instead:
+
+	l, err := net.Listen("tcp", "localhost:1966")
+	if err != nil {
+		// handle error
+	}
+	err = server.Serve(ctx, l)
 */
 package gemini
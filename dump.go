@@ -0,0 +1,43 @@
+package gemini
+
+import (
+	"bytes"
+	"io/ioutil"
+)
+
+// DumpRequest returns the wire representation of the request r,
+// exactly as it would be sent by the client.
+// It is intended for debugging; use the %q verb of package fmt to make
+// the terminating CRLF visible.
+func DumpRequest(r *Request) ([]byte, error) {
+	var b bytes.Buffer
+	if _, err := r.WriteTo(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// DumpResponse is like DumpRequest but dumps a response.
+// If body is true, DumpResponse also returns the response body.
+// To do so, it reads the body into memory and replaces resp.Body with
+// an in-memory io.ReadCloser that yields the same bytes.
+func DumpResponse(resp *Response, body bool) ([]byte, error) {
+	var b bytes.Buffer
+	r := &Response{
+		Status: resp.Status,
+		Meta:   resp.Meta,
+	}
+	if body && resp.Body != nil {
+		content, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(content))
+		r.Body = ioutil.NopCloser(bytes.NewReader(content))
+	}
+	if _, err := r.WriteTo(&b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
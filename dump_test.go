@@ -0,0 +1,41 @@
+package gemini
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDumpResponse(t *testing.T) {
+	const raw = "20 text/gemini\r\n# Hello\n"
+	resp, err := ReadResponse(ioutil.NopCloser(strings.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := DumpResponse(resp, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != raw {
+		t.Errorf("expected dump %q, got %q", raw, b)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "# Hello\n"; string(body) != want {
+		t.Errorf("expected body %q to be preserved, got %q", want, body)
+	}
+
+	req, err := NewRequest("gemini://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = DumpRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "gemini://example.com/\r\n"; string(b) != want {
+		t.Errorf("expected dump %q, got %q", want, b)
+	}
+}
@@ -0,0 +1,61 @@
+package gemini
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// escapeChars are the characters that can start a line with a special
+// meaning in Gemini text: links, headings, list items, quotes and
+// preformatting toggles.
+const escapeChars = "=#*>`"
+
+// EscapeText escapes untrusted text, such as user input, for inclusion
+// in Gemini text, so that each of its lines is parsed as a text line.
+// Lines that start with a character that could begin a link, heading,
+// list item, quote or preformatting toggle are prefixed with a space.
+// The result is also safe to include in a preformatted block, since it
+// cannot close the block.
+func EscapeText(s string) string {
+	var b strings.Builder
+	w := NewEscapeWriter(&b)
+	io.WriteString(w, s)
+	return b.String()
+}
+
+// NewEscapeWriter returns a writer that escapes the text written to it
+// like EscapeText and writes the result to w. The first byte written is
+// treated as the start of a line.
+func NewEscapeWriter(w io.Writer) io.Writer {
+	return &escapeWriter{w: w, lineStart: true}
+}
+
+type escapeWriter struct {
+	w         io.Writer
+	lineStart bool
+}
+
+func (e *escapeWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		if e.lineStart && strings.IndexByte(escapeChars, p[0]) != -1 {
+			if _, err := io.WriteString(e.w, " "); err != nil {
+				return n, err
+			}
+		}
+		// Write up to and including the next newline
+		i := bytes.IndexByte(p, '\n') + 1
+		e.lineStart = i > 0
+		if i == 0 {
+			i = len(p)
+		}
+		m, err := e.w.Write(p[:i])
+		n += m
+		if err != nil {
+			return n, err
+		}
+		p = p[i:]
+	}
+	return n, nil
+}
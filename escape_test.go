@@ -0,0 +1,50 @@
+package gemini
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEscapeText(t *testing.T) {
+	tests := []struct {
+		Text string
+		Want string
+	}{
+		{"Hello, world!", "Hello, world!"},
+		{"=> gemini://evil.example Click", " => gemini://evil.example Click"},
+		{"# Heading\n## Heading\n", " # Heading\n ## Heading\n"},
+		{"a\n* item\n> quote\n```\nb", "a\n * item\n > quote\n ```\nb"},
+		{"\r\n=>x", "\r\n =>x"},
+		{"1 => 2", "1 => 2"},
+	}
+	for _, test := range tests {
+		got := EscapeText(test.Text)
+		if got != test.Want {
+			t.Errorf("%q: expected %q, got %q", test.Text, test.Want, got)
+		}
+		text, err := ParseText(strings.NewReader(got))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range text {
+			if _, ok := line.(LineText); !ok {
+				t.Errorf("%q: expected text lines, got %#v", test.Text, line)
+			}
+		}
+	}
+}
+
+func TestEscapeWriter(t *testing.T) {
+	var b strings.Builder
+	w := NewEscapeWriter(&b)
+	for _, s := range []string{"=", "> a\n", "", "#", " b\nc\n", "*"} {
+		n, err := w.Write([]byte(s))
+		if err != nil || n != len(s) {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	const want = " => a\n # b\nc\n *"
+	if got := b.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
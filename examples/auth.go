@@ -4,8 +4,6 @@ package main
 
 import (
 	"context"
-	"crypto/sha512"
-	"crypto/x509"
 	"fmt"
 	"log"
 	"time"
@@ -46,18 +44,13 @@ func main() {
 	}
 }
 
-func fingerprint(cert *x509.Certificate) string {
-	b := sha512.Sum512(cert.Raw)
-	return string(b[:])
-}
-
 func profile(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
 	tls := r.TLS()
 	if len(tls.PeerCertificates) == 0 {
 		w.WriteHeader(gemini.StatusCertificateRequired, "Certificate required")
 		return
 	}
-	fingerprint := fingerprint(tls.PeerCertificates[0])
+	fingerprint := gemini.Fingerprint(tls.PeerCertificates[0])
 	user, ok := users[fingerprint]
 	if !ok {
 		user = &User{}
@@ -79,7 +72,7 @@ func changeUsername(ctx context.Context, w gemini.ResponseWriter, r *gemini.Requ
 		w.WriteHeader(gemini.StatusInput, "Username")
 		return
 	}
-	fingerprint := fingerprint(tls.PeerCertificates[0])
+	fingerprint := gemini.Fingerprint(tls.PeerCertificates[0])
 	user, ok := users[fingerprint]
 	if !ok {
 		user = &User{}
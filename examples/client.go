@@ -101,7 +101,7 @@ func do(req *gemini.Request, via []*gemini.Request) (*gemini.Response, error) {
 	}
 
 	switch resp.Status.Class() {
-	case gemini.StatusInput:
+	case gemini.StatusClassInput:
 		input, ok := getInput(resp.Meta)
 		if !ok {
 			break
@@ -110,7 +110,7 @@ func do(req *gemini.Request, via []*gemini.Request) (*gemini.Response, error) {
 		req.URL.RawQuery = gemini.QueryEscape(input)
 		return do(req, via)
 
-	case gemini.StatusRedirect:
+	case gemini.StatusClassRedirect:
 		via = append(via, req)
 		if len(via) > 5 {
 			return resp, errors.New("too many redirects")
@@ -153,7 +153,7 @@ func main() {
 	defer resp.Body.Close()
 
 	// Handle response
-	if resp.Status.Class() == gemini.StatusSuccess {
+	if resp.Status.Success() {
 		_, err := io.Copy(os.Stdout, resp.Body)
 		if err != nil {
 			log.Fatal(err)
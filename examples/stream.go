@@ -38,6 +38,7 @@ func main() {
 }
 
 // stream writes an infinite stream to w.
+// The context is canceled when flushing finds that the client has gone away.
 func stream(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
 	for {
 		select {
@@ -0,0 +1,208 @@
+// +build go1.16
+
+package gemini
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FeedOptions configures a feed handler created with FeedHandler.
+type FeedOptions struct {
+	// Title is the title of the feed. If empty, the base name of the
+	// directory in the request path is used, or the hostname for the
+	// root directory.
+	Title string
+
+	// MaxEntries, if positive, limits the number of entries in the feed.
+	MaxEntries int
+
+	// Atom specifies whether the feed should be served as an Atom feed
+	// with the media type "application/atom+xml" instead of Gemini text.
+	Atom bool
+}
+
+// FeedHandler returns a handler that responds to each request with a feed
+// of the Gemini text files in the root directory of fsys, so that the
+// directory can be subscribed to, as described in the "Subscribing to
+// Gemini pages" companion specification.
+//
+// Each file with a ".gmi" extension, other than "index.gmi", is an entry
+// of the feed. The title of an entry is the first level 1 heading of the
+// file, or else its name without the extension, and its date is the
+// modification time of the file. Entries are listed newest first.
+//
+// Links to entries are relative to the request path, so the handler
+// should be registered for a file in the directory of the entries, such
+// as "/gemlog/feed.gmi", next to a file server for the entries:
+//
+//     fsys := os.DirFS("gemlog")
+//     mux.Handle("/gemlog/", gemini.StripPrefix("/gemlog", gemini.FileServer(fsys)))
+//     mux.Handle("/gemlog/feed.gmi", gemini.FeedHandler(fsys, gemini.FeedOptions{}))
+//     mux.Handle("/gemlog/atom.xml", gemini.FeedHandler(fsys, gemini.FeedOptions{Atom: true}))
+func FeedHandler(fsys fs.FS, opts FeedOptions) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		entries, err := readFeedEntries(fsys, opts.MaxEntries)
+		if err != nil {
+			w.WriteHeader(StatusTemporaryFailure, "Error reading directory")
+			return
+		}
+		title := opts.Title
+		if title == "" {
+			title = feedTitle(r.URL)
+		}
+		if opts.Atom {
+			w.SetMediaType("application/atom+xml")
+			writeAtomFeed(w, r.URL, title, entries)
+			return
+		}
+		w.SetMediaType("text/gemini")
+		fmt.Fprintf(w, "# %s\n\n", title)
+		for _, entry := range entries {
+			link := LineLink{
+				// String adds a "./" prefix to names such as
+				// "a:b.gmi" that would be parsed as a scheme.
+				URL:  (&url.URL{Path: entry.name}).String(),
+				Name: entry.modTime.UTC().Format("2006-01-02") + " - " + entry.title,
+			}
+			fmt.Fprintln(w, link.String())
+		}
+	})
+}
+
+// feedEntry is an entry of a feed generated by FeedHandler.
+type feedEntry struct {
+	name    string
+	title   string
+	modTime time.Time
+}
+
+// readFeedEntries returns the entries of the feed for fsys, newest first.
+func readFeedEntries(fsys fs.FS, max int) ([]feedEntry, error) {
+	dirEntries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	var entries []feedEntry
+	for _, d := range dirEntries {
+		name := d.Name()
+		if d.IsDir() || path.Ext(name) != ".gmi" || name == "index.gmi" {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, feedEntry{
+			name:    name,
+			title:   fileTitle(fsys, name),
+			modTime: info.ModTime(),
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].modTime.After(entries[j].modTime)
+	})
+	if max > 0 && len(entries) > max {
+		entries = entries[:max]
+	}
+	return entries, nil
+}
+
+// errFoundTitle stops parsing once the title of a file has been found.
+var errFoundTitle = errors.New("found title")
+
+// fileTitle returns the first level 1 heading of the named Gemini text
+// file, or its name without the extension if it has none.
+func fileTitle(fsys fs.FS, name string) string {
+	title := strings.TrimSuffix(name, path.Ext(name))
+	f, err := fsys.Open(name)
+	if err != nil {
+		return title
+	}
+	defer f.Close()
+	parseLines(f, func(line Line, offset int64) error {
+		if h, ok := line.(LineHeading1); ok && h != "" {
+			title = string(h)
+			return errFoundTitle
+		}
+		return nil
+	})
+	return title
+}
+
+// feedTitle returns the default title of a feed for the provided URL.
+func feedTitle(u *url.URL) string {
+	dir := u.Path
+	if !strings.HasSuffix(dir, "/") {
+		dir = path.Dir(dir)
+	}
+	if base := path.Base(dir); base != "/" && base != "." {
+		return base
+	}
+	return u.Hostname()
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+// writeAtomFeed writes an Atom feed of the entries to w. Links to the
+// entries are resolved against base.
+func writeAtomFeed(w io.Writer, base *url.URL, title string, entries []feedEntry) error {
+	feed := atomFeed{
+		Title: title,
+		ID:    base.String(),
+		Link:  atomLink{Href: base.String(), Rel: "self"},
+	}
+	var updated time.Time
+	for _, entry := range entries {
+		u := base.ResolveReference(&url.URL{Path: entry.name}).String()
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   entry.title,
+			ID:      u,
+			Updated: entry.modTime.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: u, Rel: "alternate"},
+		})
+		if entry.modTime.After(updated) {
+			updated = entry.modTime
+		}
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,135 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+)
+
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	ID        string     `xml:"id"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Links     []atomLink `xml:"link"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+// WriteAtom writes the feed to w as an Atom feed. The URL of the feed is
+// used as the ID of the Atom feed and as its "self" link, and the URL of
+// each entry is used as the ID of the entry and as its "alternate" link.
+// The feed is updated at the date of its most recent entry.
+func (f *Feed) WriteAtom(w io.Writer) error {
+	feed := atomFeed{
+		Title:    f.Title,
+		Subtitle: f.Subtitle,
+		ID:       f.URL,
+	}
+	if f.URL != "" {
+		feed.Links = []atomLink{{Href: f.URL, Rel: "self"}}
+	}
+	var updated time.Time
+	for _, entry := range f.Entries {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   entry.Title,
+			ID:      entry.URL,
+			Updated: entry.Published.UTC().Format(time.RFC3339),
+			Links:   []atomLink{{Href: entry.URL, Rel: "alternate"}},
+		})
+		if entry.Published.After(updated) {
+			updated = entry.Published
+		}
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(feed); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ParseAtom parses an Atom feed from r. It supports the subset of Atom
+// needed for feed readers: the title and subtitle of the feed, and the
+// title, link and date of each entry. The URL of an entry is its
+// "alternate" link, or its ID if it has none, and its date is its
+// publication date, or its update date if it has none.
+//
+// The URL of the feed is its "self" link, if any. URLs are resolved
+// against base, the URL of the feed, unless base is nil.
+func ParseAtom(r io.Reader, base *url.URL) (*Feed, error) {
+	var af atomFeed
+	if err := xml.NewDecoder(r).Decode(&af); err != nil {
+		return nil, fmt.Errorf("feed: invalid Atom feed: %w", err)
+	}
+	feed := &Feed{
+		URL:      resolve(base, findLink(af.Links, "self")),
+		Title:    af.Title,
+		Subtitle: af.Subtitle,
+	}
+	for _, ae := range af.Entries {
+		link := findLink(ae.Links, "alternate")
+		if link == "" {
+			link = ae.ID
+		}
+		date := ae.Published
+		if date == "" {
+			date = ae.Updated
+		}
+		published, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			return nil, fmt.Errorf("feed: invalid Atom entry date %q", date)
+		}
+		feed.Entries = append(feed.Entries, Entry{
+			URL:       resolve(base, link),
+			Title:     ae.Title,
+			Published: published,
+		})
+	}
+	return feed, nil
+}
+
+// findLink returns the href of the first link with the relation rel.
+// Links without a relation are "alternate" links.
+func findLink(links []atomLink, rel string) string {
+	for _, link := range links {
+		if link.Rel == rel || (link.Rel == "" && rel == "alternate") {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+// resolve resolves the URL reference against base, unless base is nil or
+// the reference is invalid.
+func resolve(base *url.URL, ref string) string {
+	if base == nil || ref == "" {
+		return ref
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(u).String()
+}
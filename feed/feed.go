@@ -0,0 +1,170 @@
+// Package feed implements Gemini feeds, as described in the "Subscribing to
+// Gemini pages" companion specification.
+//
+// A Gemini feed is an ordinary Gemini text page. Its first level 1
+// heading is the title of the feed, and each link line whose name starts
+// with a date in the form YYYY-MM-DD is an entry:
+//
+//	# My gemlog
+//	## Thoughts and notes
+//
+//	=> 2021-02-14-hello.gmi 2021-02-14 - Hello, world!
+//
+// Such pages are served by gemini.FeedHandler, and they can be parsed
+// with Parse or fetched with Fetch. Atom feeds can also be written with
+// Feed.WriteAtom and parsed with ParseAtom.
+package feed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// dateLayout is the layout of the dates of feed entries.
+const dateLayout = "2006-01-02"
+
+// Feed is a parsed Gemini feed.
+type Feed struct {
+	// URL is the URL of the feed, if known. Fetch sets it to the
+	// requested URL, and WriteAtom uses it as the ID of the Atom feed.
+	URL string
+
+	// Title is the title of the feed: the text of the first level 1
+	// heading of the page, if any.
+	Title string
+
+	// Subtitle is the text of the level 2 heading directly following
+	// the title, if any. Empty lines between the headings are ignored.
+	Subtitle string
+
+	// Entries are the entries of the feed, in the order in which they
+	// appear on the page.
+	Entries []Entry
+}
+
+// Entry is an entry of a feed.
+type Entry struct {
+	// URL is the URL of the entry. If the feed was parsed with a base
+	// URL, relative links are resolved against it.
+	URL string
+
+	// Title is the title of the entry: the name of the link following
+	// the date, without the separator between them, such as " - ".
+	Title string
+
+	// Published is the date of the entry. For Gemini feeds, it is at
+	// midnight UTC.
+	Published time.Time
+}
+
+// Parse parses a Gemini feed from r. The URLs of entries are resolved
+// against base, the URL of the feed, unless base is nil.
+// It returns an error only if the Gemini text cannot be read.
+func Parse(r io.Reader, base *url.URL) (*Feed, error) {
+	text, err := gemini.ParseText(r)
+	if err != nil {
+		return nil, err
+	}
+	return ParseText(text, base), nil
+}
+
+// ParseText is like Parse, but parses already parsed Gemini text.
+func ParseText(text gemini.Text, base *url.URL) *Feed {
+	feed := &Feed{}
+	// subtitle reports whether a level 2 heading would be the subtitle
+	var subtitle, titled bool
+	for _, line := range text {
+		switch line := line.(type) {
+		case gemini.LineHeading1:
+			if !titled {
+				feed.Title = strings.TrimSpace(string(line))
+				titled = true
+				subtitle = true
+				continue
+			}
+		case gemini.LineHeading2:
+			if subtitle {
+				feed.Subtitle = strings.TrimSpace(string(line))
+			}
+		case gemini.LineText:
+			if line == "" {
+				continue
+			}
+		case gemini.LineLink:
+			if entry, ok := parseEntry(line, base); ok {
+				feed.Entries = append(feed.Entries, entry)
+			}
+		}
+		subtitle = false
+	}
+	return feed
+}
+
+// parseEntry parses a link line as a feed entry. It reports whether the
+// link is an entry.
+func parseEntry(link gemini.LineLink, base *url.URL) (Entry, bool) {
+	if len(link.Name) < len(dateLayout) {
+		return Entry{}, false
+	}
+	published, err := time.Parse(dateLayout, link.Name[:len(dateLayout)])
+	if err != nil {
+		return Entry{}, false
+	}
+	entry := Entry{
+		URL:       link.URL,
+		Title:     strings.TrimLeft(link.Name[len(dateLayout):], " \t-:–—"),
+		Published: published,
+	}
+	if base != nil {
+		u, err := url.Parse(link.URL)
+		if err != nil {
+			return Entry{}, false
+		}
+		entry.URL = base.ResolveReference(u).String()
+	}
+	return entry, true
+}
+
+// Fetch requests the feed at the provided URL using the client and parses
+// it, either as a Gemini feed or, if the server responds with the media
+// type "application/atom+xml", as an Atom feed. The URLs of entries are
+// resolved against the URL of the feed.
+// It returns an error if the request fails, or if the server responds
+// with a status code other than success or another media type.
+func Fetch(ctx context.Context, c *gemini.Client, rawurl string) (*Feed, error) {
+	req, err := gemini.NewRequest(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !resp.Status.Success() {
+		return nil, fmt.Errorf("feed: request failed with status %d %s", resp.Status, resp.Meta)
+	}
+	var feed *Feed
+	mediatype, _, _ := mime.ParseMediaType(resp.Meta)
+	switch mediatype {
+	case "text/gemini":
+		feed, err = Parse(resp.Body, req.URL)
+	case "application/atom+xml":
+		feed, err = ParseAtom(resp.Body, req.URL)
+	default:
+		return nil, fmt.Errorf("feed: unsupported media type %q", resp.Meta)
+	}
+	if err != nil {
+		return nil, err
+	}
+	feed.URL = req.URL.String()
+	return feed, nil
+}
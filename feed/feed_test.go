@@ -0,0 +1,144 @@
+package feed
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	const text = "# My gemlog\n" +
+		"\n" +
+		"## Thoughts and notes\n" +
+		"=> about.gmi About\n" +
+		"=> 2021-02-14-hello.gmi 2021-02-14 - Hello, world!\n" +
+		"=> gemini://example.org/post 2020-12-31: Elsewhere\n" +
+		"=> nodate.gmi 2021-13-01 Invalid date\n" +
+		"## Archive\n" +
+		"=> old/ 2019-01-01\n" +
+		"# Another title\n"
+
+	base, err := url.Parse("gemini://example.com/gemlog/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := Parse(strings.NewReader(text), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Feed{
+		Title:    "My gemlog",
+		Subtitle: "Thoughts and notes",
+		Entries: []Entry{
+			{"gemini://example.com/gemlog/2021-02-14-hello.gmi", "Hello, world!", date(2021, 2, 14)},
+			{"gemini://example.org/post", "Elsewhere", date(2020, 12, 31)},
+			{"gemini://example.com/gemlog/old/", "", date(2019, 1, 1)},
+		},
+	}
+	if !reflect.DeepEqual(feed, want) {
+		t.Errorf("expected %+v, got %+v", want, feed)
+	}
+
+	// Without a base URL, links are unchanged
+	feed, err = Parse(strings.NewReader(text), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := feed.Entries[0].URL; got != "2021-02-14-hello.gmi" {
+		t.Errorf("expected relative URL, got %q", got)
+	}
+
+	// The subtitle must directly follow the title
+	feed, err = Parse(strings.NewReader("# Title\nText\n## Section\n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Subtitle != "" {
+		t.Errorf("expected no subtitle, got %q", feed.Subtitle)
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestAtom(t *testing.T) {
+	feed := &Feed{
+		URL:      "gemini://example.com/gemlog/atom.xml",
+		Title:    "My <gemlog>",
+		Subtitle: "Thoughts & notes",
+		Entries: []Entry{
+			{"gemini://example.com/gemlog/hello.gmi", "Hello, world!", date(2021, 2, 14)},
+			{"gemini://example.org/post", "Elsewhere", date(2020, 12, 31)},
+		},
+	}
+	var b strings.Builder
+	if err := feed.WriteAtom(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		`<title>My &lt;gemlog&gt;</title>`,
+		`<updated>2021-02-14T00:00:00Z</updated>`,
+		`<link href="gemini://example.com/gemlog/atom.xml" rel="self"></link>`,
+		`<id>gemini://example.org/post</id>`,
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("expected Atom feed to contain %q, got:\n%s", s, b.String())
+		}
+	}
+
+	parsed, err := ParseAtom(strings.NewReader(b.String()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, feed) {
+		t.Errorf("expected %+v, got %+v", feed, parsed)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	const atom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Example</title>
+  <link href="atom.xml" rel="self"/>
+  <entry>
+    <title>Relative</title>
+    <id>urn:uuid:1</id>
+    <link href="post.gmi"/>
+    <updated>2021-03-01T12:00:00+01:00</updated>
+  </entry>
+  <entry>
+    <title>No link</title>
+    <id>gemini://example.org/</id>
+    <published>2021-01-01T00:00:00Z</published>
+    <updated>2021-02-01T00:00:00Z</updated>
+  </entry>
+</feed>`
+	base, err := url.Parse("gemini://example.com/dir/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := ParseAtom(strings.NewReader(atom), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.URL != "gemini://example.com/dir/atom.xml" || feed.Title != "Example" {
+		t.Errorf("unexpected feed %+v", feed)
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(feed.Entries))
+	}
+	if e := feed.Entries[0]; e.URL != "gemini://example.com/dir/post.gmi" || !e.Published.Equal(time.Date(2021, 3, 1, 11, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected entry %+v", e)
+	}
+	if e := feed.Entries[1]; e.URL != "gemini://example.org/" || !e.Published.Equal(date(2021, 1, 1)) {
+		t.Errorf("unexpected entry %+v", e)
+	}
+
+	if _, err := ParseAtom(strings.NewReader("<rss></rss>"), nil); err == nil {
+		t.Error("expected error parsing RSS")
+	}
+}
@@ -0,0 +1,58 @@
+// +build go1.16
+
+package gemini
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFeedHandler(t *testing.T) {
+	day := func(d int) time.Time {
+		return time.Date(2021, 1, d, 12, 0, 0, 0, time.UTC)
+	}
+	fsys := fstest.MapFS{
+		"index.gmi":      {Data: []byte("# My gemlog\n"), ModTime: day(9)},
+		"first-post.gmi": {Data: []byte("Preamble\n# First post\n# Other heading\n"), ModTime: day(1)},
+		"second.gmi":     {Data: []byte("No heading\n"), ModTime: day(3)},
+		"third.gmi":      {Data: []byte("# Third & last\n"), ModTime: day(2)},
+		"image.png":      {Data: []byte("image"), ModTime: day(4)},
+		"drafts/a.gmi":   {Data: []byte("# Draft"), ModTime: day(5)},
+		"notes:1.gmi":    {Data: []byte("# Notes"), ModTime: day(0)},
+	}
+
+	w := serveFS(t, FeedHandler(fsys, FeedOptions{}), "gemini://example.com/gemlog/")
+	want := "# gemlog\n\n" +
+		"=> second.gmi 2021-01-03 - second\n" +
+		"=> third.gmi 2021-01-02 - Third & last\n" +
+		"=> first-post.gmi 2021-01-01 - First post\n" +
+		"=> ./notes:1.gmi 2020-12-31 - Notes\n"
+	if w.Status != StatusSuccess || w.mediatype != "text/gemini" || w.Body.String() != want {
+		t.Errorf("expected %q, got %d %q %q", want, w.Status, w.mediatype, w.Body.String())
+	}
+
+	w = serveFS(t, FeedHandler(fsys, FeedOptions{Title: "My gemlog", MaxEntries: 1}), "gemini://example.com/")
+	if want := "# My gemlog\n\n=> second.gmi 2021-01-03 - second\n"; w.Body.String() != want {
+		t.Errorf("expected %q, got %q", want, w.Body.String())
+	}
+
+	w = serveFS(t, FeedHandler(fsys, FeedOptions{Atom: true}), "gemini://example.com/gemlog/atom.xml")
+	if w.mediatype != "application/atom+xml" {
+		t.Errorf("expected Atom media type, got %q", w.mediatype)
+	}
+	atom := w.Body.String()
+	for _, s := range []string{
+		`<feed xmlns="http://www.w3.org/2005/Atom">`,
+		`<title>gemlog</title>`,
+		`<updated>2021-01-03T12:00:00Z</updated>`,
+		`<title>Third &amp; last</title>`,
+		`<link href="gemini://example.com/gemlog/first-post.gmi" rel="alternate"></link>`,
+		`<link href="gemini://example.com/gemlog/notes:1.gmi" rel="alternate"></link>`,
+	} {
+		if !strings.Contains(atom, s) {
+			t.Errorf("expected Atom feed to contain %q, got:\n%s", s, atom)
+		}
+	}
+}
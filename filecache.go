@@ -0,0 +1,128 @@
+// +build go1.16
+
+package gemini
+
+import (
+	"container/list"
+	"io"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// A FileCache caches the contents of small files served by a file server
+// in memory. It is used with the Cache field of FileServerOptions.
+//
+// Cached contents are invalidated when the modification time or size of
+// the file changes. Files are still opened and their information read
+// for each request, but the contents of cached files are not read again.
+// When the cache is full, the least recently used files are evicted.
+//
+// Files are cached by name, so a FileCache must not be shared by file
+// servers with different file systems. A FileCache is safe for
+// concurrent use by multiple goroutines.
+type FileCache struct {
+	// MaxEntrySize is the maximum size in bytes of files to cache.
+	// If zero, files of up to 64 KiB are cached.
+	MaxEntrySize int64
+
+	// MaxSize is the maximum total size in bytes of cached files.
+	// If zero, up to 16 MiB of files are cached.
+	MaxSize int64
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     list.List // of *fileCacheEntry, most recently used first
+	size    int64
+}
+
+type fileCacheEntry struct {
+	name    string
+	modTime time.Time
+	data    []byte
+}
+
+func (c *FileCache) maxEntrySize() int64 {
+	if c.MaxEntrySize == 0 {
+		return 64 << 10
+	}
+	return c.MaxEntrySize
+}
+
+func (c *FileCache) maxSize() int64 {
+	if c.MaxSize == 0 {
+		return 16 << 20
+	}
+	return c.MaxSize
+}
+
+// contents returns the contents of the named file with the provided
+// information, reading them from r if they are not cached. It returns
+// false without reading from r if the file is too large to be cached.
+func (c *FileCache) contents(name string, info fs.FileInfo, r io.Reader) ([]byte, bool, error) {
+	size := info.Size()
+	if size > c.maxEntrySize() || size > c.maxSize() {
+		return nil, false, nil
+	}
+
+	c.mu.Lock()
+	if e, ok := c.entries[name]; ok {
+		entry := e.Value.(*fileCacheEntry)
+		if entry.modTime.Equal(info.ModTime()) && int64(len(entry.data)) == size {
+			c.lru.MoveToFront(e)
+			c.mu.Unlock()
+			return entry.data, true, nil
+		}
+		c.remove(e)
+	}
+	c.mu.Unlock()
+
+	data, err := io.ReadAll(io.LimitReader(r, size+1))
+	if err != nil {
+		return nil, true, err
+	}
+	if int64(len(data)) != size {
+		// The file was modified while it was read
+		return data, true, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[name]; ok {
+		c.remove(e)
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+	}
+	c.entries[name] = c.lru.PushFront(&fileCacheEntry{
+		name:    name,
+		modTime: info.ModTime(),
+		data:    data,
+	})
+	c.size += size
+	for c.size > c.maxSize() {
+		c.remove(c.lru.Back())
+	}
+	return data, true, nil
+}
+
+// remove removes an entry from the cache. c.mu must be held.
+func (c *FileCache) remove(e *list.Element) {
+	entry := c.lru.Remove(e).(*fileCacheEntry)
+	delete(c.entries, entry.name)
+	c.size -= int64(len(entry.data))
+}
+
+// Len returns the number of cached files.
+func (c *FileCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Size returns the total size in bytes of cached files.
+func (c *FileCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
@@ -0,0 +1,92 @@
+// +build go1.16
+
+package gemini
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// readCountFS counts the reads from files in a file system.
+type readCountFS struct {
+	fs.FS
+	reads int
+}
+
+func (fsys *readCountFS) Open(name string) (fs.File, error) {
+	f, err := fsys.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return readCountFile{f, fsys}, nil
+}
+
+type readCountFile struct {
+	fs.File
+	fsys *readCountFS
+}
+
+func (f readCountFile) Read(b []byte) (int, error) {
+	f.fsys.reads++
+	return f.File.Read(b)
+}
+
+func TestFileCache(t *testing.T) {
+	mtime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	mapfs := fstest.MapFS{
+		"a.txt":     {Data: []byte("aaaa"), ModTime: mtime},
+		"b.txt":     {Data: []byte("bbbb"), ModTime: mtime},
+		"large.txt": {Data: []byte("large file"), ModTime: mtime},
+	}
+	fsys := &readCountFS{FS: mapfs}
+	cache := &FileCache{MaxEntrySize: 8, MaxSize: 8}
+	h := NewFileServer(fsys, FileServerOptions{Cache: cache})
+
+	get := func(path, want string) {
+		t.Helper()
+		w := serveFS(t, h, "gemini://example.com"+path)
+		if w.Status != StatusSuccess || w.Body.String() != want {
+			t.Errorf("%s: expected %q, got %d %q", path, want, w.Status, w.Body.String())
+		}
+	}
+
+	get("/a.txt", "aaaa")
+	reads := fsys.reads
+	get("/a.txt", "aaaa")
+	if fsys.reads != reads {
+		t.Errorf("expected cached file not to be read")
+	}
+
+	// Modified files are read again
+	mapfs["a.txt"] = &fstest.MapFile{Data: []byte("AAAA"), ModTime: mtime.Add(time.Second)}
+	get("/a.txt", "AAAA")
+	if fsys.reads == reads {
+		t.Errorf("expected modified file to be read")
+	}
+
+	// Large files are not cached
+	get("/large.txt", "large file")
+	if cache.Len() != 1 || cache.Size() != 4 {
+		t.Errorf("expected 1 cached file of 4 bytes, got %d files of %d bytes", cache.Len(), cache.Size())
+	}
+
+	// Least recently used files are evicted
+	get("/b.txt", "bbbb")
+	get("/a.txt", "AAAA")
+	mapfs["c.txt"] = &fstest.MapFile{Data: []byte("cccc"), ModTime: mtime}
+	get("/c.txt", "cccc")
+	reads = fsys.reads
+	get("/a.txt", "AAAA")
+	if fsys.reads != reads {
+		t.Errorf("expected recently used file to be cached")
+	}
+	get("/b.txt", "bbbb")
+	if fsys.reads == reads {
+		t.Errorf("expected least recently used file to be evicted")
+	}
+	if cache.Size() > 8 {
+		t.Errorf("expected cache size of at most 8 bytes, got %d", cache.Size())
+	}
+}
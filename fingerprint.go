@@ -0,0 +1,90 @@
+package gemini
+
+import (
+	"crypto"
+	_ "crypto/sha1" // register hash functions for FingerprintOptions
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Fingerprint returns the fingerprint of the certificate: the lowercase
+// hexadecimal encoding of the SHA-256 hash of its raw DER contents.
+// It is suitable for identifying client certificates.
+//
+// To use another hash function or encoding, use FingerprintOptions.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// FingerprintFormat specifies the encoding of a fingerprint.
+type FingerprintFormat int
+
+// Fingerprint formats.
+const (
+	// FingerprintHex encodes fingerprints in lowercase hexadecimal,
+	// e.g. "9f86d0...".
+	FingerprintHex FingerprintFormat = iota
+
+	// FingerprintHexUpper encodes fingerprints in uppercase hexadecimal,
+	// e.g. "9F86D0...".
+	FingerprintHexUpper
+
+	// FingerprintColonHex encodes fingerprints in uppercase hexadecimal
+	// with bytes separated by colons, e.g. "9F:86:D0:...".
+	FingerprintColonHex
+
+	// FingerprintBase64 encodes fingerprints in standard base64.
+	FingerprintBase64
+)
+
+// FingerprintOptions specifies how a fingerprint is computed.
+// The zero value computes the same fingerprint as Fingerprint.
+type FingerprintOptions struct {
+	// Hash is the hash function to use.
+	// If zero, crypto.SHA256 is used.
+	Hash crypto.Hash
+
+	// Format is the encoding of the hash.
+	Format FingerprintFormat
+}
+
+// Fingerprint returns the fingerprint of the certificate computed using
+// the options. It returns an error if the hash function is not available
+// or the format is unknown.
+func (o FingerprintOptions) Fingerprint(cert *x509.Certificate) (string, error) {
+	hash := o.Hash
+	if hash == 0 {
+		hash = crypto.SHA256
+	}
+	if !hash.Available() {
+		return "", errors.New("gemini: fingerprint hash function unavailable")
+	}
+	h := hash.New()
+	h.Write(cert.Raw)
+	sum := h.Sum(nil)
+
+	switch o.Format {
+	case FingerprintHex:
+		return hex.EncodeToString(sum), nil
+	case FingerprintHexUpper:
+		return strings.ToUpper(hex.EncodeToString(sum)), nil
+	case FingerprintColonHex:
+		var b strings.Builder
+		for i, c := range sum {
+			if i > 0 {
+				b.WriteByte(':')
+			}
+			b.WriteString(strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+		return b.String(), nil
+	case FingerprintBase64:
+		return base64.StdEncoding.EncodeToString(sum), nil
+	}
+	return "", errors.New("gemini: unknown fingerprint format")
+}
@@ -0,0 +1,57 @@
+package gemini
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("certificate")}
+	sum256 := sha256.Sum256(cert.Raw)
+	sum512 := sha512.Sum512(cert.Raw)
+	hex256 := hex.EncodeToString(sum256[:])
+
+	if got := Fingerprint(cert); got != hex256 {
+		t.Errorf("Fingerprint: expected %q, got %q", hex256, got)
+	}
+
+	tests := []struct {
+		Options FingerprintOptions
+		Want    string
+	}{
+		{FingerprintOptions{}, hex256},
+		{FingerprintOptions{Format: FingerprintHexUpper}, strings.ToUpper(hex256)},
+		{FingerprintOptions{Format: FingerprintColonHex}, strings.ToUpper(hex256[:2] + ":" + hex256[2:4] + ":")},
+		{FingerprintOptions{Format: FingerprintBase64}, base64.StdEncoding.EncodeToString(sum256[:])},
+		{FingerprintOptions{Hash: crypto.SHA512}, hex.EncodeToString(sum512[:])},
+	}
+	for _, test := range tests {
+		got, err := test.Options.Fingerprint(cert)
+		if err != nil {
+			t.Errorf("%+v: unexpected error: %v", test.Options, err)
+			continue
+		}
+		if test.Options.Format == FingerprintColonHex {
+			if !strings.HasPrefix(got, test.Want) || len(got) != 3*sha256.Size-1 {
+				t.Errorf("%+v: expected prefix %q, got %q", test.Options, test.Want, got)
+			}
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("%+v: expected %q, got %q", test.Options, test.Want, got)
+		}
+	}
+
+	if _, err := (FingerprintOptions{Format: -1}).Fingerprint(cert); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, err := (FingerprintOptions{Hash: crypto.MD4}).Fingerprint(cert); err == nil {
+		t.Error("expected error for unavailable hash")
+	}
+}
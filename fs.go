@@ -3,6 +3,7 @@
 package gemini
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"fmt"
@@ -22,81 +23,687 @@ import (
 //
 //     gemini.FileServer(os.DirFS("/tmp"))
 func FileServer(fsys fs.FS) Handler {
-	return fileServer{fsys}
+	return NewFileServer(fsys, FileServerOptions{})
+}
+
+// FileServerOptions configures a file server created with NewFileServer.
+type FileServerOptions struct {
+	// Gzip specifies whether files with a ".gz" extension should be
+	// served with the media type of the uncompressed file and a "+gzip"
+	// suffix. For example, "index.gmi.gz" is served with the media type
+	// "text/gemini+gzip". Clients can decompress such responses
+	// transparently; see the Decompress field of Client.
+	Gzip bool
+
+	// DirDetails specifies whether directory listings should include
+	// the modification time and size of each entry in its link name.
+	DirDetails bool
+
+	// DirSort specifies the order of entries in directory listings.
+	// By default, entries are sorted by name.
+	DirSort DirSort
+
+	// DirHeader and DirFooter optionally specify Gemini text to write
+	// before and after the entries of directory listings.
+	DirHeader string
+	DirFooter string
+
+	// DirLink optionally specifies a function that formats the link
+	// line for an entry in a directory listing. It is called with the
+	// entry and the default link, and returns the link to write.
+	// If nil, the default link is used.
+	DirLink func(entry fs.DirEntry, link LineLink) LineLink
+
+	// HideDotfiles specifies whether files and directories whose names
+	// begin with a dot should be hidden. Requests for hidden files, or
+	// for files in hidden directories, are answered with "51 Not found",
+	// and hidden files are omitted from directory listings.
+	HideDotfiles bool
+
+	// Exclude optionally specifies patterns, in the syntax of path.Match,
+	// of files to hide as with HideDotfiles. Patterns without a slash,
+	// such as "*.key", are matched against each element of the file's
+	// path. Other patterns are matched against the path relative to the
+	// root of the file system. Patterns with a trailing slash, such as
+	// ".git/", match only directories. Malformed patterns match nothing.
+	Exclude []string
+
+	// Symlinks specifies how symbolic links in the file system are
+	// treated. By default, symbolic links are followed.
+	Symlinks SymlinkPolicy
+
+	// MetaFiles specifies whether ".meta" files should be read to
+	// configure the responses for files in their directory, in the
+	// style of the Molly Brown server. Each line of a .meta file has
+	// the form "pattern: value", where pattern is matched against file
+	// names in the syntax of path.Match, and value is one of:
+	//
+	//   - a media type, used instead of the one detected from the file
+	//     extension, such as "text/plain; charset=iso-8859-1";
+	//   - media type parameters starting with ";", such as ";lang=fr",
+	//     which are added to the media type;
+	//   - a status code and meta, such as "31 new.gmi" or "52 Gone",
+	//     which are sent instead of the file. Redirect targets may be
+	//     relative to the request URL, in which case they are resolved
+	//     by the client.
+	//
+	// Empty lines and lines starting with "#" are ignored, and later
+	// lines take precedence. The .meta files themselves are hidden.
+	MetaFiles bool
+
+	// Error optionally specifies a function that responds to requests
+	// the file server cannot serve, such as requests for files that do
+	// not exist or are hidden ("51 Not found") and requests that fail
+	// with an I/O error ("40 Temporary failure"). It is called with the
+	// status code and meta that would otherwise be sent, and can be
+	// used to respond with a custom page or to delegate the request to
+	// a fallback handler. If nil, the status code and meta are sent.
+	Error func(ctx context.Context, w ResponseWriter, r *Request, status Status, meta string)
+
+	// CleanURLs specifies whether requests for files that do not exist
+	// should be served from the file with the same name and a ".gmi"
+	// extension, if any, so that "/about" is served from "about.gmi".
+	// Directory listings then link to such files without the extension.
+	CleanURLs bool
+
+	// Cache optionally specifies a cache for the contents of small
+	// files. See FileCache.
+	Cache *FileCache
+
+	// CGI optionally specifies a function that returns a handler for
+	// the named regular file, such as a CGI handler that executes it.
+	// If it returns a non-nil handler, requests for the file are served
+	// by that handler instead of the contents of the file. See the
+	// Executables function of the cgi package.
+	CGI func(name string, info fs.FileInfo) Handler
+
+	// AuthorizedCerts specifies whether ".authorized_certs" files
+	// restrict access to the directories containing them and their
+	// subdirectories. Each line of an .authorized_certs file holds the
+	// fingerprint of an authorized client certificate, as returned by
+	// Fingerprint, optionally followed by a comment. Colons in the
+	// fingerprint are ignored. Empty lines and lines starting with "#"
+	// are ignored.
+	//
+	// Requests for files in restricted directories without a client
+	// certificate are answered with "60 Certificate required", and
+	// requests with a certificate that is not listed in the
+	// .authorized_certs files of all of the enclosing directories are
+	// answered with "61 Certificate not authorized". The
+	// .authorized_certs files themselves are hidden.
+	//
+	// Symbolic links are not resolved with the default SymlinksFollow
+	// policy, so a link outside of a restricted directory gives access
+	// to the files it points to in that directory. Use AuthorizedCerts
+	// with SymlinksWithinRoot, which also checks the directories of link
+	// targets, or with SymlinksDeny.
+	AuthorizedCerts bool
+
+	// MIMEResolver optionally specifies a function that returns the
+	// media type for the named file, which is a slash-separated path
+	// relative to the root of the file system. If MIMEResolver is nil or
+	// returns the empty string, the media type is detected from the file
+	// extension using the mime package.
+	MIMEResolver func(name string) string
+
+	// MediaTypes optionally maps file extensions, such as ".gmi", to the
+	// media types, including any parameters, of the files with those
+	// extensions, for example "text/gemini; charset=utf-8; lang=de".
+	// Extensions that are not in the map are looked up in the mime
+	// package. MIMEResolver takes precedence over MediaTypes.
+	MediaTypes map[string]string
+
+	// Redirects optionally maps request paths, such as "/old/page.gmi",
+	// to redirects. Requests for those paths are redirected before the
+	// file system is accessed. Paths are compared after cleaning them
+	// with path.Clean. See ReadRedirects.
+	Redirects map[string]RedirectRule
+
+	// Observe optionally specifies a function that is called after each
+	// request has been served, with a description of the response.
+	// It can be used to collect statistics about served files.
+	Observe func(r *Request, f ServedFile)
+}
+
+// ServedFile describes a response of a file server.
+// See the Observe field of FileServerOptions.
+type ServedFile struct {
+	// Path is the request path.
+	Path string
+
+	// Name is the name of the file or directory that the request path
+	// resolved to, relative to the root of the file system. It is empty
+	// if the request was answered before the path was resolved, for
+	// example with a redirect. Name may refer to a file that does not
+	// exist if the response is an error.
+	Name string
+
+	// Status is the status code of the response.
+	Status Status
+
+	// Written is the number of bytes of the response body written.
+	Written int64
+}
+
+// observeWriter records the status and size of a response.
+type observeWriter struct {
+	rw      ResponseWriter
+	status  Status
+	written int64
+}
+
+func (w *observeWriter) SetMediaType(mediatype string) {
+	w.rw.SetMediaType(mediatype)
+}
+
+func (w *observeWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = StatusSuccess
+	}
+	n, err := w.rw.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// ReadFrom implements io.ReaderFrom so that copies to the wrapped
+// ResponseWriter can use its ReadFrom method, if any.
+func (w *observeWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 {
+		w.status = StatusSuccess
+	}
+	n, err := copyBody(w.rw, r)
+	w.written += n
+	return n, err
+}
+
+func (w *observeWriter) WriteHeader(status Status, meta string) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.rw.WriteHeader(status, meta)
+}
+
+func (w *observeWriter) Flush() error {
+	return w.rw.Flush()
+}
+
+func (w *observeWriter) Written() bool {
+	return w.rw.Written()
+}
+
+func (w *observeWriter) Close() error {
+	return w.rw.Close()
+}
+
+// A RedirectRule describes a redirect served by a file server.
+type RedirectRule struct {
+	// Target is the target of the redirect. It may be relative to the
+	// request URL, in which case it is resolved by the client.
+	Target string
+
+	// Permanent specifies whether the redirect is permanent
+	// ("31 Permanent redirect") or temporary ("30 Redirect").
+	Permanent bool
+}
+
+// ReadRedirects reads a redirect map for use with the Redirects field of
+// FileServerOptions. Each line of the map has the form
+//
+//     path target [status]
+//
+// where status is either 30 or 31. If the status is omitted, the redirect
+// is permanent. Empty lines and lines starting with "#" are ignored.
+func ReadRedirects(r io.Reader) (map[string]RedirectRule, error) {
+	redirects := make(map[string]RedirectRule)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("gemini: redirect map line %d: invalid number of fields", n)
+		}
+		rule := RedirectRule{Target: fields[1], Permanent: true}
+		if len(fields) == 3 {
+			switch fields[2] {
+			case "30":
+				rule.Permanent = false
+			case "31":
+			default:
+				return nil, fmt.Errorf("gemini: redirect map line %d: invalid status %q", n, fields[2])
+			}
+		}
+		redirects[path.Clean("/"+fields[0])] = rule
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return redirects, nil
+}
+
+// SymlinkPolicy specifies how a file server treats symbolic links.
+//
+// Detecting symbolic links requires a file system that reports them in
+// directory entries, such as the one returned by os.DirFS. Resolving them
+// with SymlinksWithinRoot additionally requires the file system to
+// implement ReadLink and Lstat methods like those of io/fs.ReadLinkFS.
+type SymlinkPolicy int
+
+const (
+	// SymlinksFollow follows all symbolic links. Links are followed by
+	// the file system without being resolved by the file server, so
+	// the restrictions of AuthorizedCerts apply to the link rather than
+	// its target.
+	SymlinksFollow SymlinkPolicy = iota
+
+	// SymlinksWithinRoot follows symbolic links whose targets are
+	// within the root of the file system. Links with absolute targets,
+	// links that cannot be resolved and requests for other links are
+	// answered with "51 Not found".
+	SymlinksWithinRoot
+
+	// SymlinksDeny answers requests for symbolic links, and for files
+	// in linked directories, with "51 Not found".
+	SymlinksDeny
+)
+
+// maxSymlinks is the maximum number of symbolic links resolved for a
+// single path.
+const maxSymlinks = 40
+
+// readLinkFS is implemented by file systems that can read symbolic
+// links. It has the same method set as io/fs.ReadLinkFS.
+type readLinkFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// allows reports whether the named file may be served according to the
+// policy. name is a slash-separated path relative to the root of fsys.
+func (p SymlinkPolicy) allows(fsys fs.FS, name string) bool {
+	_, ok := p.resolve(fsys, name)
+	return ok
+}
+
+// resolve is like allows, but also returns the path of the named file
+// with the symbolic links followed by the policy resolved. Links are not
+// resolved with SymlinksFollow.
+func (p SymlinkPolicy) resolve(fsys fs.FS, name string) (string, bool) {
+	if p == SymlinksFollow || name == "." {
+		return name, true
+	}
+	links := 0
+	elems := strings.Split(name, "/")
+	for i := 0; i < len(elems); i++ {
+		prefix := strings.Join(elems[:i+1], "/")
+		if !isSymlink(fsys, prefix) {
+			continue
+		}
+		links++
+		rfs, ok := fsys.(readLinkFS)
+		if p == SymlinksDeny || !ok || links > maxSymlinks {
+			return "", false
+		}
+		target, err := rfs.ReadLink(prefix)
+		if err != nil || path.IsAbs(target) {
+			return "", false
+		}
+		target = path.Join(path.Dir(prefix), target)
+		if target == ".." || strings.HasPrefix(target, "../") {
+			return "", false
+		}
+		// Check the resolved path from the start, since the link
+		// target may itself contain links
+		elems = append(strings.Split(target, "/"), elems[i+1:]...)
+		i = -1
+	}
+	return path.Clean(strings.Join(elems, "/")), true
+}
+
+// isSymlink reports whether the named file is a symbolic link.
+func isSymlink(fsys fs.FS, name string) bool {
+	if fsys, ok := fsys.(readLinkFS); ok {
+		info, err := fsys.Lstat(name)
+		return err == nil && info.Mode()&fs.ModeSymlink != 0
+	}
+	entries, err := fs.ReadDir(fsys, path.Dir(name))
+	if err != nil {
+		return false
+	}
+	base := path.Base(name)
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].Name() >= base
+	})
+	return i < len(entries) && entries[i].Name() == base && entries[i].Type()&fs.ModeSymlink != 0
+}
+
+// hidden reports whether the named file should be hidden according to
+// HideDotfiles and Exclude. name is a slash-separated path relative to
+// the root of the file system.
+func (opts FileServerOptions) hidden(name string, isDir bool) bool {
+	if name == "." || !opts.HideDotfiles && !opts.MetaFiles && !opts.AuthorizedCerts && len(opts.Exclude) == 0 {
+		return false
+	}
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		if opts.HideDotfiles && strings.HasPrefix(elem, ".") {
+			return true
+		}
+		if opts.MetaFiles && elem == metaFile && i == len(elems)-1 && !isDir {
+			return true
+		}
+		if opts.AuthorizedCerts && elem == authorizedCertsFile && i == len(elems)-1 && !isDir {
+			return true
+		}
+		dir := isDir || i < len(elems)-1
+		for _, pattern := range opts.Exclude {
+			if strings.HasSuffix(pattern, "/") {
+				if !dir {
+					continue
+				}
+				pattern = strings.TrimSuffix(pattern, "/")
+			}
+			target := elem
+			if strings.Contains(pattern, "/") {
+				target = strings.Join(elems[:i+1], "/")
+				pattern = strings.TrimPrefix(pattern, "/")
+			}
+			if ok, _ := path.Match(pattern, target); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DirSort specifies the order of entries in directory listings.
+type DirSort int
+
+const (
+	// SortByName sorts entries by name.
+	SortByName DirSort = iota
+
+	// SortByModTime sorts entries by modification time, newest first.
+	SortByModTime
+
+	// SortBySize sorts entries by size, largest first.
+	SortBySize
+)
+
+// NewFileServer is like FileServer but uses the provided options.
+func NewFileServer(fsys fs.FS, options FileServerOptions) Handler {
+	return fileServer{fsys, options}
 }
 
 type fileServer struct {
 	fs.FS
+	opts FileServerOptions
 }
 
 func (fsys fileServer) ServeGemini(ctx context.Context, w ResponseWriter, r *Request) {
+	if fsys.opts.Observe == nil {
+		fsys.serve(ctx, w, r)
+		return
+	}
+	ow := &observeWriter{rw: w}
+	name := fsys.serve(ctx, ow, r)
+	fsys.opts.Observe(r, ServedFile{
+		Path:    r.URL.Path,
+		Name:    name,
+		Status:  ow.status,
+		Written: ow.written,
+	})
+}
+
+// serve serves the request and returns the name of the file or
+// directory that was served, if any.
+func (fsys fileServer) serve(ctx context.Context, w ResponseWriter, r *Request) (name string) {
 	const indexPage = "/index.gmi"
 
-	url := path.Clean(r.URL.Path)
+	cpath := path.Clean(r.URL.Path)
+
+	if rule, ok := fsys.opts.Redirects[cpath]; ok {
+		// Relative targets are sent as is, so that they are resolved
+		// against the URL requested by the client even when the file
+		// server is mounted under a prefix.
+		status := StatusRedirect
+		if rule.Permanent {
+			status = StatusPermanentRedirect
+		}
+		w.WriteHeader(status, rule.Target)
+		return
+	}
 
 	// Redirect .../index.gmi to .../
-	if strings.HasSuffix(url, indexPage) {
-		w.WriteHeader(StatusPermanentRedirect, strings.TrimSuffix(url, "index.gmi"))
+	if strings.HasSuffix(cpath, indexPage) {
+		target := strings.TrimSuffix(cpath, "index.gmi")
+		if r.URL.Path == cpath {
+			target = "./"
+		}
+		w.WriteHeader(StatusPermanentRedirect, target)
 		return
 	}
 
-	name := url
+	name = cpath
 	if name == "/" {
 		name = "."
 	} else {
 		name = strings.TrimPrefix(name, "/")
 	}
+	if fsys.opts.CleanURLs {
+		name = cleanURLName(fsys.FS, name)
+	}
+	if fsys.opts.AuthorizedCerts {
+		if !fsys.authorize(w, r, name) {
+			return
+		}
+		// Files reached through symbolic links are also restricted
+		// by the directories of their targets
+		if target, ok := fsys.opts.Symlinks.resolve(fsys.FS, name); ok && target != name && !fsys.authorize(w, r, target) {
+			return
+		}
+	}
+
+	if fsys.opts.MetaFiles {
+		if m := readMeta(fsys.FS, name); m.status != 0 {
+			// Redirect targets are sent as is, like redirect rules.
+			w.WriteHeader(m.status, m.meta)
+			return
+		}
+	}
+
+	if !fsys.opts.Symlinks.allows(fsys.FS, name) {
+		fsys.error(ctx, w, r, StatusNotFound, "Not found")
+		return
+	}
 
 	f, err := fsys.Open(name)
 	if err != nil {
-		w.WriteHeader(toGeminiError(err))
+		status, meta := toGeminiError(err)
+		fsys.error(ctx, w, r, status, meta)
 		return
 	}
 	defer f.Close()
 
 	stat, err := f.Stat()
 	if err != nil {
-		w.WriteHeader(toGeminiError(err))
+		status, meta := toGeminiError(err)
+		fsys.error(ctx, w, r, status, meta)
+		return
+	}
+	if fsys.opts.hidden(name, stat.IsDir()) {
+		fsys.error(ctx, w, r, StatusNotFound, "Not found")
 		return
 	}
 
-	// Redirect to canonical path
+	// Redirect to canonical path.
+	// Relative references are used where possible so that redirects
+	// work when the file server is mounted under a prefix.
 	if len(r.URL.Path) != 0 {
 		if stat.IsDir() {
-			target := url
+			target := cpath
 			if target != "/" {
 				target += "/"
 			}
 			if len(r.URL.Path) != len(target) || r.URL.Path != target {
+				if r.URL.Path == cpath {
+					// Add trailing slash
+					target = relativeRef(path.Base(cpath) + "/")
+				}
 				w.WriteHeader(StatusPermanentRedirect, target)
 				return
 			}
 		} else if r.URL.Path[len(r.URL.Path)-1] == '/' {
 			// Remove trailing slash
-			w.WriteHeader(StatusPermanentRedirect, url)
+			target := cpath
+			if r.URL.Path == cpath+"/" {
+				target = "." + relativeRef(path.Base(cpath))
+			}
+			w.WriteHeader(StatusPermanentRedirect, target)
+			return
+		}
+	}
+
+	if fsys.opts.CGI != nil && stat.Mode().IsRegular() {
+		if h := fsys.opts.CGI(name, stat); h != nil {
+			h.ServeGemini(ctx, w, r)
 			return
 		}
 	}
 
 	if stat.IsDir() {
 		// Use contents of index.gmi if present
+		dir := name
 		name = path.Join(name, indexPage)
 		index, err := fsys.Open(name)
-		if err == nil {
+		if err == nil && !fsys.opts.hidden(name, false) && fsys.opts.Symlinks.allows(fsys.FS, name) {
 			defer index.Close()
 			f = index
 		} else {
+			if err == nil {
+				index.Close()
+			}
 			// Failed to find index file
-			dirList(w, f)
+			name = dir
+			if err := dirList(w, fsys.FS, f, dir, fsys.opts); err != nil {
+				fsys.error(ctx, w, r, StatusTemporaryFailure, "Error reading directory")
+			}
 			return
 		}
 	}
 
+	mediatype := fsys.mediaType(name)
+	if fsys.opts.MetaFiles {
+		mediatype = readMeta(fsys.FS, name).mediaTypeFor(mediatype)
+	}
+	if fsys.opts.Cache != nil {
+		if info, err := f.Stat(); err == nil {
+			data, ok, err := fsys.opts.Cache.contents(name, info, f)
+			if err != nil {
+				status, meta := toGeminiError(err)
+				fsys.error(ctx, w, r, status, meta)
+				return
+			}
+			if ok {
+				w.SetMediaType(mediatype)
+				w.Write(data)
+				return
+			}
+		}
+	}
+	w.SetMediaType(mediatype)
+	copyBody(w, f)
+	return
+}
+
+// error responds to a request that cannot be served.
+func (fsys fileServer) error(ctx context.Context, w ResponseWriter, r *Request, status Status, meta string) {
+	if fsys.opts.Error != nil {
+		fsys.opts.Error(ctx, w, r, status, meta)
+		return
+	}
+	w.WriteHeader(status, meta)
+}
+
+// cleanURLName returns the name of the file that serves the named file
+// with FileServerOptions.CleanURLs.
+func cleanURLName(fsys fs.FS, name string) string {
+	if name == "." {
+		return name
+	}
+	if _, err := fs.Stat(fsys, name); !errors.Is(err, fs.ErrNotExist) {
+		return name
+	}
+	if _, err := fs.Stat(fsys, name+".gmi"); err == nil {
+		return name + ".gmi"
+	}
+	return name
+}
+
+// mediaType returns the media type for the named file.
+func (fsys fileServer) mediaType(name string) string {
+	if fsys.opts.MIMEResolver != nil {
+		if mimetype := fsys.opts.MIMEResolver(name); mimetype != "" {
+			return mimetype
+		}
+	}
+	if fsys.opts.Gzip && path.Ext(name) == ".gz" {
+		ext := path.Ext(strings.TrimSuffix(name, ".gz"))
+		if mimetype := fsys.typeByExtension(ext); mimetype != "" {
+			return addMediaTypeSuffix(mimetype, gzipSuffix)
+		}
+	}
 	// Detect mimetype from file extension
 	ext := path.Ext(name)
-	mimetype := mime.TypeByExtension(ext)
-	w.SetMediaType(mimetype)
-	io.Copy(w, f)
+	return fsys.typeByExtension(ext)
+}
+
+// typeByExtension returns the media type for the file extension ext.
+func (fsys fileServer) typeByExtension(ext string) string {
+	if mimetype, ok := fsys.opts.MediaTypes[ext]; ok {
+		return mimetype
+	}
+	if mimetype, ok := fsys.opts.MediaTypes[strings.ToLower(ext)]; ok {
+		return mimetype
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// HandleFS registers a file server for the given pattern that serves
+// the contents of the provided file system. If the pattern names a
+// subtree, such as "/static/", the subtree root is stripped from request
+// paths, so that a request for "/static/a.gmi" is served from the file
+// named "a.gmi" in fsys. For subtrees with wildcard segments, such as
+// "/users/*/files/", the path matched by the pattern is stripped, so that
+// a request for "/users/alice/files/a.gmi" is also served from "a.gmi".
+// Otherwise the request path is used as is.
+func (mux *Mux) HandleFS(pattern string, fsys fs.FS) {
+	h := FileServer(fsys)
+	if i := strings.Index(pattern, "/"); i != -1 && strings.HasSuffix(pattern, "/") {
+		prefix := strings.TrimSuffix(pattern[i:], "/")
+		if hasWildcardSegment(prefix) {
+			h = stripMatchedPrefix(h)
+		} else {
+			h = StripPrefix(prefix, h)
+		}
+	}
+	mux.Handle(pattern, h)
+}
+
+// stripMatchedPrefix returns a handler that strips the path matched by a
+// subtree pattern with wildcard segments from the request path and
+// invokes h.
+func stripMatchedPrefix(h Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		matches := MatchesFromContext(ctx)
+		if len(matches) == 0 {
+			w.WriteHeader(StatusNotFound, "Not found")
+			return
+		}
+		StripPrefix(strings.TrimSuffix(matches[0], "/"), h).ServeGemini(ctx, w, r)
+	})
 }
 
 // ServeFile responds to the request with the contents of the named file
@@ -127,6 +734,7 @@ func ServeFile(w ResponseWriter, fsys fs.FS, name string) {
 
 	if stat.IsDir() {
 		// Use contents of index file if present
+		dir := name
 		name = path.Join(name, indexPage)
 		index, err := fsys.Open(name)
 		if err == nil {
@@ -134,7 +742,9 @@ func ServeFile(w ResponseWriter, fsys fs.FS, name string) {
 			f = index
 		} else {
 			// Failed to find index file
-			dirList(w, f)
+			if err := dirList(w, fsys, f, dir, FileServerOptions{}); err != nil {
+				w.WriteHeader(StatusTemporaryFailure, "Error reading directory")
+			}
 			return
 		}
 	}
@@ -143,36 +753,160 @@ func ServeFile(w ResponseWriter, fsys fs.FS, name string) {
 	ext := path.Ext(name)
 	mimetype := mime.TypeByExtension(ext)
 	w.SetMediaType(mimetype)
-	io.Copy(w, f)
+	copyBody(w, f)
 }
 
-func dirList(w ResponseWriter, f fs.File) {
-	var entries []fs.DirEntry
-	var err error
+// FileHandler returns a request handler that responds to each request
+// with the contents of the named file in fsys, regardless of the request
+// path. It is useful for serving single files such as "robots.txt":
+//
+//     mux.Handle("/robots.txt", gemini.FileHandler(fsys, "robots.txt"))
+//
+// See ServeFile.
+func FileHandler(fsys fs.FS, name string) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		ServeFile(w, fsys, name)
+	})
+}
+
+// relativeRef returns an escaped relative reference to the named file
+// in the current directory.
+func relativeRef(name string) string {
+	return (&url.URL{Path: "./" + name}).EscapedPath()
+}
+
+// dirList writes a listing of the directory f with the provided name
+// in fsys. If the directory cannot be read, dirList returns an error
+// without writing to w.
+func dirList(w ResponseWriter, fsys fs.FS, f fs.File, name string, opts FileServerOptions) error {
 	d, ok := f.(fs.ReadDirFile)
-	if ok {
-		entries, err = d.ReadDir(-1)
+	if !ok {
+		return errors.New("gemini: not a directory")
 	}
-	if !ok || err != nil {
-		w.WriteHeader(StatusTemporaryFailure, "Error reading directory")
-		return
+	entries, err := d.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+
+	visible := entries[:0]
+	for _, entry := range entries {
+		ename := path.Join(name, entry.Name())
+		if opts.hidden(ename, entry.IsDir()) {
+			continue
+		}
+		if entry.Type()&fs.ModeSymlink != 0 && !opts.Symlinks.allows(fsys, ename) {
+			continue
+		}
+		visible = append(visible, entry)
+	}
+	entries = visible
+
+	var names map[string]bool
+	if opts.CleanURLs {
+		names = make(map[string]bool, len(entries))
+		for _, entry := range entries {
+			names[entry.Name()] = true
+		}
 	}
 
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Name() < entries[j].Name()
+	var infos []fs.FileInfo
+	if opts.DirDetails || opts.DirSort != SortByName {
+		infos = make([]fs.FileInfo, len(entries))
+		for i, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			infos[i] = info
+		}
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if opts.DirSort == SortByModTime {
+			ta, tb := infos[a].ModTime(), infos[b].ModTime()
+			if !ta.Equal(tb) {
+				return ta.After(tb)
+			}
+		}
+		if opts.DirSort == SortBySize {
+			sa, sb := infos[a].Size(), infos[b].Size()
+			if sa != sb {
+				return sa > sb
+			}
+		}
+		return entries[a].Name() < entries[b].Name()
 	})
 
-	for _, entry := range entries {
+	writeText(w, opts.DirHeader)
+	for _, i := range order {
+		entry := entries[i]
 		name := entry.Name()
 		if entry.IsDir() {
 			name += "/"
 		}
+		target := name
+		if opts.CleanURLs && !entry.IsDir() && path.Ext(name) == ".gmi" {
+			// Link without the extension unless another file
+			// would be served instead
+			if trimmed := strings.TrimSuffix(name, ".gmi"); !names[trimmed] {
+				target = trimmed
+			}
+		}
 		link := LineLink{
 			Name: name,
-			URL:  (&url.URL{Path: name}).EscapedPath(),
+			URL:  (&url.URL{Path: target}).EscapedPath(),
+		}
+		if opts.DirDetails {
+			link.Name += " " + fileDetails(infos[i])
+		}
+		if opts.DirLink != nil {
+			link = opts.DirLink(entry, link)
 		}
 		fmt.Fprintln(w, link.String())
 	}
+	writeText(w, opts.DirFooter)
+	return nil
+}
+
+// writeText writes Gemini text to w, terminating it with a newline
+// if necessary.
+func writeText(w io.Writer, text string) {
+	if text == "" {
+		return
+	}
+	io.WriteString(w, text)
+	if !strings.HasSuffix(text, "\n") {
+		io.WriteString(w, "\n")
+	}
+}
+
+// fileDetails returns a description of the modification time and size
+// of a file for use in directory listings.
+func fileDetails(info fs.FileInfo) string {
+	date := info.ModTime().UTC().Format("2006-01-02 15:04")
+	if info.IsDir() {
+		return "(" + date + ")"
+	}
+	return "(" + date + ", " + formatSize(info.Size()) + ")"
+}
+
+// formatSize formats a size in bytes using binary prefixes.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
 func toGeminiError(err error) (status Status, meta string) {
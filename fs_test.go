@@ -0,0 +1,693 @@
+// +build go1.16
+
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func serveFS(t *testing.T, h Handler, rawurl string) *recorder {
+	t.Helper()
+	req, err := NewRequest(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &recorder{}
+	h.ServeGemini(context.Background(), w, req)
+	return w
+}
+
+func TestFileServerDirList(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/a.txt": {Data: []byte("a"), ModTime: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"dir/b.txt": {Data: make([]byte, 2048), ModTime: time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC)},
+		"dir/c.txt": {Data: []byte("c"), ModTime: time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		Options FileServerOptions
+		Body    string
+	}{
+		{
+			Body: "=> a.txt a.txt\n=> b.txt b.txt\n=> c.txt c.txt\n",
+		},
+		{
+			Options: FileServerOptions{DirSort: SortByModTime},
+			Body:    "=> b.txt b.txt\n=> c.txt c.txt\n=> a.txt a.txt\n",
+		},
+		{
+			Options: FileServerOptions{DirSort: SortBySize},
+			Body:    "=> b.txt b.txt\n=> a.txt a.txt\n=> c.txt c.txt\n",
+		},
+		{
+			Options: FileServerOptions{DirDetails: true},
+			Body: "=> a.txt a.txt (2021-01-01 00:00, 1 B)\n" +
+				"=> b.txt b.txt (2021-01-03 00:00, 2.0 KiB)\n" +
+				"=> c.txt c.txt (2021-01-02 00:00, 1 B)\n",
+		},
+		{
+			Options: FileServerOptions{
+				DirHeader: "# Index",
+				DirFooter: "Generated by go-gemini\n",
+				DirLink: func(entry fs.DirEntry, link LineLink) LineLink {
+					link.Name = strings.ToUpper(entry.Name())
+					return link
+				},
+			},
+			Body: "# Index\n=> a.txt A.TXT\n=> b.txt B.TXT\n=> c.txt C.TXT\nGenerated by go-gemini\n",
+		},
+	}
+
+	for _, test := range tests {
+		w := serveFS(t, NewFileServer(fsys, test.Options), "gemini://example.com/dir/")
+		if w.Status != StatusSuccess {
+			t.Errorf("expected status %d, got %d", StatusSuccess, w.Status)
+		}
+		if got := w.Body.String(); got != test.Body {
+			t.Errorf("expected body %q, got %q", test.Body, got)
+		}
+	}
+}
+
+func TestMuxHandleFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.gmi":     {Data: []byte("a")},
+		"dir/b.gmi": {Data: []byte("b")},
+	}
+	mux := &Mux{}
+	mux.HandleFS("/static/", fsys)
+	mux.HandleFS("/users/*/files/", fsys)
+	mux.HandleStatus("/old", StatusPermanentRedirect, "/static/")
+
+	tests := []struct {
+		URL    string
+		Status Status
+		Meta   string
+		Body   string
+	}{
+		{"gemini://example.com/static/a.gmi", StatusSuccess, "text/gemini; charset=utf-8", "a"},
+		{"gemini://example.com/static/dir/b.gmi", StatusSuccess, "text/gemini; charset=utf-8", "b"},
+		{"gemini://example.com/static/dir", StatusPermanentRedirect, "./dir/", ""},
+		{"gemini://example.com/static/a.gmi/", StatusPermanentRedirect, "../a.gmi", ""},
+		{"gemini://example.com/old", StatusPermanentRedirect, "/static/", ""},
+		{"gemini://example.com/users/alice/files/a.gmi", StatusSuccess, "text/gemini; charset=utf-8", "a"},
+		{"gemini://example.com/users/a%20b/files/dir/b.gmi", StatusSuccess, "text/gemini; charset=utf-8", "b"},
+		{"gemini://example.com/users/alice/files/dir", StatusPermanentRedirect, "./dir/", ""},
+	}
+	for _, test := range tests {
+		w := serveFS(t, mux, test.URL)
+		if w.Status != test.Status || w.Meta != test.Meta || w.Body.String() != test.Body {
+			t.Errorf("%s: expected %d %q %q, got %d %q %q", test.URL,
+				test.Status, test.Meta, test.Body, w.Status, w.Meta, w.Body.String())
+		}
+	}
+}
+
+func TestFileServerHidden(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.txt":         {Data: []byte("index")},
+		".env":              {Data: []byte("secret")},
+		"server.key":        {Data: []byte("secret")},
+		".git/config":       {Data: []byte("secret")},
+		"repo/.git/HEAD":    {Data: []byte("secret")},
+		"private/notes.gmi": {Data: []byte("secret")},
+		"public/private":    {Data: []byte("public")},
+	}
+	h := NewFileServer(fsys, FileServerOptions{
+		HideDotfiles: true,
+		Exclude:      []string{"*.key", "private/"},
+	})
+
+	tests := []struct {
+		Path   string
+		Status Status
+	}{
+		{"/index.txt", StatusSuccess},
+		{"/.env", StatusNotFound},
+		{"/server.key", StatusNotFound},
+		{"/.git/", StatusNotFound},
+		{"/.git/config", StatusNotFound},
+		{"/repo/.git/HEAD", StatusNotFound},
+		{"/private/", StatusNotFound},
+		{"/private/notes.gmi", StatusNotFound},
+		{"/public/private", StatusSuccess},
+	}
+	for _, test := range tests {
+		w := serveFS(t, h, "gemini://example.com"+test.Path)
+		if w.Status != test.Status {
+			t.Errorf("%s: expected status %d, got %d", test.Path, test.Status, w.Status)
+		}
+	}
+
+	w := serveFS(t, h, "gemini://example.com/")
+	if want := "=> index.txt index.txt\n=> public/ public/\n=> repo/ repo/\n"; w.Body.String() != want {
+		t.Errorf("expected listing %q, got %q", want, w.Body.String())
+	}
+
+	// Patterns with a slash are matched against the full path
+	h = NewFileServer(fsys, FileServerOptions{Exclude: []string{"public/*"}})
+	if w := serveFS(t, h, "gemini://example.com/public/private"); w.Status != StatusNotFound {
+		t.Errorf("expected status %d, got %d", StatusNotFound, w.Status)
+	}
+	if w := serveFS(t, h, "gemini://example.com/private/notes.gmi"); w.Status != StatusSuccess {
+		t.Errorf("expected status %d, got %d", StatusSuccess, w.Status)
+	}
+}
+
+func TestFileServerSymlinks(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for name, data := range map[string]string{
+		filepath.Join(root, "file.txt"):      "inside",
+		filepath.Join(root, "dir", "a.txt"):  "inside",
+		filepath.Join(outside, "secret.txt"): "outside",
+	} {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"inside.txt": "file.txt",
+		"dir/up.txt": "../file.txt",
+		"linkdir":    "dir",
+		"secret.txt": filepath.Join(outside, "secret.txt"),
+		"escape":     "../" + filepath.Base(outside),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skip("symbolic links not supported:", err)
+		}
+	}
+	fsys := os.DirFS(root)
+	_, canReadLink := fsys.(readLinkFS)
+
+	tests := []struct {
+		Path       string
+		Follow     Status
+		WithinRoot Status
+		Deny       Status
+	}{
+		{"/file.txt", StatusSuccess, StatusSuccess, StatusSuccess},
+		{"/inside.txt", StatusSuccess, StatusSuccess, StatusNotFound},
+		{"/dir/up.txt", StatusSuccess, StatusSuccess, StatusNotFound},
+		{"/linkdir/a.txt", StatusSuccess, StatusSuccess, StatusNotFound},
+		{"/secret.txt", StatusSuccess, StatusNotFound, StatusNotFound},
+		{"/escape/secret.txt", StatusSuccess, StatusNotFound, StatusNotFound},
+	}
+	for _, test := range tests {
+		for policy, status := range map[SymlinkPolicy]Status{
+			SymlinksFollow:     test.Follow,
+			SymlinksWithinRoot: test.WithinRoot,
+			SymlinksDeny:       test.Deny,
+		} {
+			if policy == SymlinksWithinRoot && !canReadLink && status == StatusSuccess {
+				// Links cannot be resolved
+				status = StatusNotFound
+			}
+			h := NewFileServer(fsys, FileServerOptions{Symlinks: policy})
+			w := serveFS(t, h, "gemini://example.com"+test.Path)
+			if w.Status != status {
+				t.Errorf("%s (policy %d): expected status %d, got %d", test.Path, policy, status, w.Status)
+			}
+		}
+	}
+
+	h := NewFileServer(fsys, FileServerOptions{Symlinks: SymlinksDeny})
+	w := serveFS(t, h, "gemini://example.com/")
+	if want := "=> dir/ dir/\n=> file.txt file.txt\n"; w.Body.String() != want {
+		t.Errorf("expected listing %q, got %q", want, w.Body.String())
+	}
+}
+
+func TestFileServerMetaFiles(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.gmi": {Data: []byte("index")},
+		"notes.txt": {Data: []byte("notes")},
+		"data.bin":  {Data: []byte("data")},
+		"fr/a.gmi":  {Data: []byte("bonjour")},
+		".meta": {Data: []byte(
+			"# Response parameters\n" +
+				"notes.txt: text/plain; charset=iso-8859-1\n" +
+				"data.bin: application/x-custom\n" +
+				"old.gmi: 31 index.gmi\n" +
+				"gone.gmi: 52 This page has been removed\n" +
+				"moved: 30 /fr/a.gmi\n")},
+		"fr/.meta": {Data: []byte("*.gmi: ;lang=fr\n")},
+	}
+	h := NewFileServer(fsys, FileServerOptions{MetaFiles: true})
+
+	tests := []struct {
+		Path   string
+		Status Status
+		Meta   string
+	}{
+		{"/index.gmi", StatusPermanentRedirect, "./"},
+		{"/notes.txt", StatusSuccess, "text/plain; charset=iso-8859-1"},
+		{"/data.bin", StatusSuccess, "application/x-custom"},
+		{"/old.gmi", StatusPermanentRedirect, "index.gmi"},
+		{"/gone.gmi", StatusGone, "This page has been removed"},
+		{"/moved", StatusRedirect, "/fr/a.gmi"},
+		{"/fr/a.gmi", StatusSuccess, "text/gemini; charset=utf-8; lang=fr"},
+		{"/.meta", StatusNotFound, "Not found"},
+		{"/fr/.meta", StatusNotFound, "Not found"},
+	}
+	for _, test := range tests {
+		w := serveFS(t, h, "gemini://example.com"+test.Path)
+		meta := w.Meta
+		if w.Status == StatusSuccess {
+			meta = w.mediatype
+		}
+		if w.Status != test.Status || meta != test.Meta {
+			t.Errorf("%s: expected %d %q, got %d %q", test.Path, test.Status, test.Meta, w.Status, meta)
+		}
+	}
+
+	w := serveFS(t, h, "gemini://example.com/fr/")
+	if want := "=> a.gmi a.gmi\n"; w.Body.String() != want {
+		t.Errorf("expected listing %q, got %q", want, w.Body.String())
+	}
+
+	// Relative targets are resolved against the URL of the request,
+	// including the prefix stripped from it
+	h = StripPrefix("/files", h)
+	w = serveFS(t, h, "gemini://example.com/files/old.gmi")
+	if w.Status != StatusPermanentRedirect {
+		t.Fatalf("expected status %d, got %d %q", StatusPermanentRedirect, w.Status, w.Meta)
+	}
+	base, _ := url.Parse("gemini://example.com/files/old.gmi")
+	ref, _ := url.Parse(w.Meta)
+	if got, want := base.ResolveReference(ref).String(), "gemini://example.com/files/index.gmi"; got != want {
+		t.Errorf("expected redirect to %q, got %q", want, got)
+	}
+}
+
+func TestFileServerError(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.gmi": {Data: []byte("index")},
+		".secret":   {Data: []byte("secret")},
+	}
+	fallback := TextHandler("# Not here\n")
+	h := NewFileServer(fsys, FileServerOptions{
+		HideDotfiles: true,
+		Error: func(ctx context.Context, w ResponseWriter, r *Request, status Status, meta string) {
+			if status == StatusNotFound {
+				fallback.ServeGemini(ctx, w, r)
+				return
+			}
+			w.WriteHeader(status, meta)
+		},
+	})
+
+	for _, path := range []string{"/missing.gmi", "/.secret"} {
+		w := serveFS(t, h, "gemini://example.com"+path)
+		if w.Status != StatusSuccess || w.Body.String() != "# Not here\n" {
+			t.Errorf("%s: expected fallback page, got %d %q", path, w.Status, w.Body.String())
+		}
+	}
+	w := serveFS(t, h, "gemini://example.com/")
+	if w.Status != StatusSuccess || w.Body.String() != "index" {
+		t.Errorf("expected index page, got %d %q", w.Status, w.Body.String())
+	}
+}
+
+func TestFileServerCleanURLs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"about.gmi":     {Data: []byte("about")},
+		"notes.gmi":     {Data: []byte("notes")},
+		"notes":         {Data: []byte("plain notes")},
+		"dir/index.gmi": {Data: []byte("index")},
+		"photo.jpg":     {Data: []byte("photo")},
+	}
+	h := NewFileServer(fsys, FileServerOptions{CleanURLs: true})
+
+	tests := []struct {
+		Path   string
+		Status Status
+		Body   string
+	}{
+		{"/about", StatusSuccess, "about"},
+		{"/about.gmi", StatusSuccess, "about"},
+		{"/notes", StatusSuccess, "plain notes"},
+		{"/photo", StatusNotFound, ""},
+		{"/dir/", StatusSuccess, "index"},
+	}
+	for _, test := range tests {
+		w := serveFS(t, h, "gemini://example.com"+test.Path)
+		if w.Status != test.Status || w.Body.String() != test.Body {
+			t.Errorf("%s: expected %d %q, got %d %q", test.Path, test.Status, test.Body, w.Status, w.Body.String())
+		}
+	}
+	if w := serveFS(t, h, "gemini://example.com/about"); w.mediatype != "text/gemini; charset=utf-8" {
+		t.Errorf("expected media type of about.gmi, got %q", w.mediatype)
+	}
+
+	w := serveFS(t, h, "gemini://example.com/")
+	want := "=> about about.gmi\n=> dir/ dir/\n=> notes notes\n=> notes.gmi notes.gmi\n=> photo.jpg photo.jpg\n"
+	if w.Body.String() != want {
+		t.Errorf("expected listing %q, got %q", want, w.Body.String())
+	}
+}
+
+func TestFileServerCGI(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.gmi":   {Data: []byte("page")},
+		"script.cgi": {Data: []byte("#!/bin/sh"), Mode: 0755},
+	}
+	var names []string
+	h := NewFileServer(fsys, FileServerOptions{
+		CGI: func(name string, info fs.FileInfo) Handler {
+			names = append(names, name)
+			if info.Mode()&0111 == 0 {
+				return nil
+			}
+			return StatusHandler(StatusSuccess, "text/x-cgi")
+		},
+	})
+
+	if w := serveFS(t, h, "gemini://example.com/page.gmi"); w.Body.String() != "page" {
+		t.Errorf("expected file contents, got %d %q", w.Status, w.Body.String())
+	}
+	if w := serveFS(t, h, "gemini://example.com/script.cgi"); w.Meta != "text/x-cgi" || w.Body.Len() != 0 {
+		t.Errorf("expected CGI handler response, got %d %q %q", w.Status, w.Meta, w.Body.String())
+	}
+	if w := serveFS(t, h, "gemini://example.com/"); w.Status != StatusSuccess {
+		t.Errorf("expected directory listing, got %d", w.Status)
+	}
+	if len(names) != 2 || names[0] != "page.gmi" || names[1] != "script.cgi" {
+		t.Errorf("expected CGI function to be called for regular files, got %q", names)
+	}
+}
+
+func TestFileServerAuthorizedCerts(t *testing.T) {
+	alice := &x509.Certificate{Raw: []byte("alice")}
+	bob := &x509.Certificate{Raw: []byte("bob")}
+	fsys := fstest.MapFS{
+		"public.gmi":                {Data: []byte("public")},
+		"private/.authorized_certs": {Data: []byte("# Authorized users\n" + Fingerprint(alice) + " alice\n" + Fingerprint(bob) + " bob\n")},
+		"private/notes.gmi":         {Data: []byte("notes")},
+		"private/alice/.authorized_certs": {Data: []byte(
+			strings.ToUpper(Fingerprint(alice)) + "\n")},
+		"private/alice/diary.gmi": {Data: []byte("diary")},
+	}
+	h := NewFileServer(fsys, FileServerOptions{AuthorizedCerts: true})
+
+	tests := []struct {
+		Path   string
+		Cert   *x509.Certificate
+		Status Status
+	}{
+		{"/public.gmi", nil, StatusSuccess},
+		{"/private/notes.gmi", nil, StatusCertificateRequired},
+		{"/private/notes.gmi", alice, StatusSuccess},
+		{"/private/notes.gmi", bob, StatusSuccess},
+		{"/private/", nil, StatusCertificateRequired},
+		{"/private/missing.gmi", nil, StatusCertificateRequired},
+		{"/private/alice/diary.gmi", alice, StatusSuccess},
+		{"/private/alice/diary.gmi", bob, StatusCertificateNotAuthorized},
+		{"/private/alice/", bob, StatusCertificateNotAuthorized},
+		{"/private/.authorized_certs", alice, StatusNotFound},
+	}
+	for _, test := range tests {
+		req, err := NewRequest("gemini://example.com" + test.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.Cert != nil {
+			req.tls = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{test.Cert}}
+		}
+		w := &recorder{}
+		h.ServeGemini(context.Background(), w, req)
+		if w.Status != test.Status {
+			t.Errorf("%s: expected status %d, got %d", test.Path, test.Status, w.Status)
+		}
+	}
+}
+
+func TestFileServerAuthorizedCertsSymlinks(t *testing.T) {
+	alice := &x509.Certificate{Raw: []byte("alice")}
+	root := t.TempDir()
+	for name, data := range map[string]string{
+		"private/.authorized_certs": Fingerprint(alice) + "\n",
+		"private/notes.gmi":         "notes",
+		"public/index.gmi":          "public",
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range map[string]string{
+		"public/notes.gmi": "../private/notes.gmi",
+		"linkdir":          "private",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skip("symbolic links not supported:", err)
+		}
+	}
+	fsys := os.DirFS(root)
+	if _, ok := fsys.(readLinkFS); !ok {
+		t.Skip("symbolic links cannot be resolved")
+	}
+
+	tests := []struct {
+		Path   string
+		Cert   *x509.Certificate
+		Policy SymlinkPolicy
+		Status Status
+	}{
+		{"/public/notes.gmi", nil, SymlinksWithinRoot, StatusCertificateRequired},
+		{"/public/notes.gmi", alice, SymlinksWithinRoot, StatusSuccess},
+		{"/linkdir/notes.gmi", nil, SymlinksWithinRoot, StatusCertificateRequired},
+		{"/linkdir/", nil, SymlinksWithinRoot, StatusCertificateRequired},
+		{"/public/", nil, SymlinksWithinRoot, StatusSuccess},
+		{"/public/notes.gmi", nil, SymlinksDeny, StatusNotFound},
+		// Links are not resolved with SymlinksFollow
+		{"/public/notes.gmi", nil, SymlinksFollow, StatusSuccess},
+	}
+	for _, test := range tests {
+		h := NewFileServer(fsys, FileServerOptions{AuthorizedCerts: true, Symlinks: test.Policy})
+		req, err := NewRequest("gemini://example.com" + test.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.Cert != nil {
+			req.tls = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{test.Cert}}
+		}
+		w := &recorder{}
+		h.ServeGemini(context.Background(), w, req)
+		if w.Status != test.Status {
+			t.Errorf("%s (policy %d): expected status %d, got %d", test.Path, test.Policy, test.Status, w.Status)
+		}
+	}
+}
+
+func TestFileServerMIMEResolver(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.gmi":      {Data: []byte("page")},
+		"feed.xml":      {Data: []byte("feed")},
+		"docs/README":   {Data: []byte("readme")},
+		"docs/page.gmi": {Data: []byte("page")},
+	}
+	h := NewFileServer(fsys, FileServerOptions{
+		MIMEResolver: func(name string) string {
+			switch {
+			case path.Ext(name) == ".xml":
+				return "application/atom+xml"
+			case strings.HasPrefix(name, "docs/"):
+				return "text/plain"
+			}
+			return ""
+		},
+	})
+
+	tests := []struct {
+		Path      string
+		MediaType string
+	}{
+		{"/page.gmi", "text/gemini; charset=utf-8"},
+		{"/feed.xml", "application/atom+xml"},
+		{"/docs/README", "text/plain"},
+		{"/docs/page.gmi", "text/plain"},
+	}
+	for _, test := range tests {
+		w := serveFS(t, h, "gemini://example.com"+test.Path)
+		if w.mediatype != test.MediaType {
+			t.Errorf("%s: expected media type %q, got %q", test.Path, test.MediaType, w.mediatype)
+		}
+	}
+}
+
+func BenchmarkFileServer(b *testing.B) {
+	for _, size := range []int{4 << 10, 1 << 20} {
+		fsys := fstest.MapFS{"file.bin": {Data: make([]byte, size)}}
+		h := FileServer(fsys)
+		req, err := NewRequest("gemini://example.com/file.bin")
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(formatSize(int64(size)), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w := newResponseWriter(io.Discard)
+				h.ServeGemini(context.Background(), w, req)
+				if err := w.Flush(); err != nil {
+					b.Fatal(err)
+				}
+				w.release()
+			}
+		})
+	}
+}
+
+func TestFileServerMediaTypes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.gmi":  {Data: []byte("index")},
+		"PAGE.GMI":   {Data: []byte("page")},
+		"style.css":  {Data: []byte("style")},
+		"old.gmi.gz": {Data: []byte("compressed")},
+	}
+	h := NewFileServer(fsys, FileServerOptions{
+		Gzip: true,
+		MediaTypes: map[string]string{
+			".gmi": "text/gemini; charset=utf-8; lang=de",
+		},
+	})
+
+	tests := []struct {
+		Path      string
+		MediaType string
+	}{
+		{"/", "text/gemini; charset=utf-8; lang=de"},
+		{"/PAGE.GMI", "text/gemini; charset=utf-8; lang=de"},
+		{"/style.css", "text/css; charset=utf-8"},
+		{"/old.gmi.gz", "text/gemini+gzip; charset=utf-8; lang=de"},
+	}
+	for _, test := range tests {
+		w := serveFS(t, h, "gemini://example.com"+test.Path)
+		if w.mediatype != test.MediaType {
+			t.Errorf("%s: expected media type %q, got %q", test.Path, test.MediaType, w.mediatype)
+		}
+	}
+}
+
+func TestFileServerRedirects(t *testing.T) {
+	redirects, err := ReadRedirects(strings.NewReader(
+		"# Moved pages\n" +
+			"/old.gmi /new.gmi\n" +
+			"/tmp/  gemini://example.org/  30\n" +
+			"\n" +
+			"archive/2020.gmi 2020/\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"new.gmi": {Data: []byte("new")}}
+	h := NewFileServer(fsys, FileServerOptions{Redirects: redirects})
+
+	tests := []struct {
+		Path   string
+		Status Status
+		Meta   string
+	}{
+		{"/old.gmi", StatusPermanentRedirect, "/new.gmi"},
+		{"/tmp", StatusRedirect, "gemini://example.org/"},
+		{"/archive/./2020.gmi", StatusPermanentRedirect, "2020/"},
+		{"/new.gmi", StatusSuccess, ""},
+	}
+	for _, test := range tests {
+		w := serveFS(t, h, "gemini://example.com"+test.Path)
+		if w.Status != test.Status || w.Meta != test.Meta && test.Meta != "" {
+			t.Errorf("%s: expected %d %q, got %d %q", test.Path, test.Status, test.Meta, w.Status, w.Meta)
+		}
+	}
+
+	// Relative targets are resolved against the URL of the request,
+	// including the prefix stripped from it
+	redirects, err = ReadRedirects(strings.NewReader("/docs/old.gmi new.gmi\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = StripPrefix("/files", NewFileServer(fstest.MapFS{}, FileServerOptions{Redirects: redirects}))
+	w := serveFS(t, h, "gemini://example.com/files/docs/old.gmi")
+	if w.Status != StatusPermanentRedirect {
+		t.Fatalf("expected status %d, got %d %q", StatusPermanentRedirect, w.Status, w.Meta)
+	}
+	base, _ := url.Parse("gemini://example.com/files/docs/old.gmi")
+	ref, _ := url.Parse(w.Meta)
+	if got, want := base.ResolveReference(ref).String(), "gemini://example.com/files/docs/new.gmi"; got != want {
+		t.Errorf("expected redirect to %q, got %q", want, got)
+	}
+
+	for _, invalid := range []string{"/a", "/a /b 32", "/a /b 31 extra"} {
+		if _, err := ReadRedirects(strings.NewReader(invalid)); err == nil {
+			t.Errorf("%q: expected error", invalid)
+		}
+	}
+}
+
+func TestFileHandler(t *testing.T) {
+	fsys := fstest.MapFS{"static/robots.txt": {Data: []byte("User-agent: *\n")}}
+	h := FileHandler(fsys, "static/robots.txt")
+	for _, path := range []string{"/robots.txt", "/other"} {
+		w := serveFS(t, h, "gemini://example.com"+path)
+		if w.Status != StatusSuccess || w.Body.String() != "User-agent: *\n" {
+			t.Errorf("%s: unexpected response %d %q", path, w.Status, w.Body.String())
+		}
+	}
+	if w := serveFS(t, FileHandler(fsys, "missing.txt"), "gemini://example.com/"); w.Status != StatusNotFound {
+		t.Errorf("expected status %d, got %d", StatusNotFound, w.Status)
+	}
+}
+
+func TestFileServerObserve(t *testing.T) {
+	fsys := fstest.MapFS{
+		"dir/index.gmi": {Data: []byte("index")},
+		"dir/a.txt":     {Data: []byte("a")},
+		"list/b.txt":    {Data: []byte("b")},
+	}
+	var served []ServedFile
+	h := NewFileServer(fsys, FileServerOptions{
+		Observe: func(r *Request, f ServedFile) {
+			served = append(served, f)
+		},
+	})
+
+	tests := []struct {
+		Path string
+		Want ServedFile
+	}{
+		{"/dir/", ServedFile{"/dir/", "dir/index.gmi", StatusSuccess, 5}},
+		{"/dir/a.txt", ServedFile{"/dir/a.txt", "dir/a.txt", StatusSuccess, 1}},
+		{"/list/", ServedFile{"/list/", "list", StatusSuccess, 15}},
+		{"/missing", ServedFile{"/missing", "missing", StatusNotFound, 0}},
+		{"/dir/index.gmi", ServedFile{"/dir/index.gmi", "", StatusPermanentRedirect, 0}},
+	}
+	for _, test := range tests {
+		served = nil
+		w := serveFS(t, h, "gemini://example.com"+test.Path)
+		if len(served) != 1 || served[0] != test.Want {
+			t.Errorf("%s: expected %+v, got %+v", test.Path, test.Want, served)
+		}
+		if w.Status != test.Want.Status || int64(w.Body.Len()) != test.Want.Written {
+			t.Errorf("%s: unexpected response %d %q", test.Path, w.Status, w.Body.String())
+		}
+	}
+}
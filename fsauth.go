@@ -0,0 +1,75 @@
+// +build go1.16
+
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// authorizedCertsFile is the name of the files that restrict access to
+// the directories containing them. See FileServerOptions.AuthorizedCerts.
+const authorizedCertsFile = ".authorized_certs"
+
+// authorize checks the client certificate of the request for the named
+// file against the .authorized_certs files of the file and its parent
+// directories. If access is denied, authorize writes a response header
+// and returns false.
+func (fsys fileServer) authorize(w ResponseWriter, r *Request, name string) bool {
+	dirs := []string{"."}
+	if name != "." {
+		elems := strings.Split(name, "/")
+		for i := range elems[:len(elems)-1] {
+			dirs = append(dirs, strings.Join(elems[:i+1], "/"))
+		}
+		if stat, err := fs.Stat(fsys.FS, name); err == nil && stat.IsDir() {
+			dirs = append(dirs, name)
+		}
+	}
+
+	var fingerprint string
+	for _, dir := range dirs {
+		b, err := fs.ReadFile(fsys.FS, path.Join(dir, authorizedCertsFile))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			w.WriteHeader(toGeminiError(err))
+			return false
+		}
+		if fingerprint == "" {
+			tls := r.TLS()
+			if tls == nil || len(tls.PeerCertificates) == 0 {
+				CertificateRequired(w)
+				return false
+			}
+			fingerprint = Fingerprint(tls.PeerCertificates[0])
+		}
+		if !containsFingerprint(b, fingerprint) {
+			CertificateNotAuthorized(w)
+			return false
+		}
+	}
+	return true
+}
+
+// containsFingerprint reports whether the contents of an .authorized_certs
+// file list the provided fingerprint.
+func containsFingerprint(b []byte, fingerprint string) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		f := strings.ToLower(strings.ReplaceAll(fields[0], ":", ""))
+		if f == fingerprint {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+// +build go1.16
+
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// metaFile is the name of the files that define response parameters
+// for the files in their directory. See FileServerOptions.MetaFiles.
+const metaFile = ".meta"
+
+// fileMeta holds the response parameters defined for a file.
+type fileMeta struct {
+	status    Status // response status, or zero to serve the file
+	meta      string // response meta for status
+	mediatype string // media type override, if any
+	params    string // media type parameters to add, if any
+}
+
+// readMeta returns the response parameters defined for the named file
+// by the .meta file in its directory, if any. See the MetaFiles field of
+// FileServerOptions for the format. Malformed lines are ignored.
+func readMeta(fsys fs.FS, name string) fileMeta {
+	var m fileMeta
+	base := path.Base(name)
+	if base == "." || base == "/" {
+		return m
+	}
+	b, err := fs.ReadFile(fsys, path.Join(path.Dir(name), metaFile))
+	if err != nil {
+		return m
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i == -1 {
+			continue
+		}
+		pattern := strings.TrimSpace(line[:i])
+		value := strings.TrimSpace(line[i+1:])
+		if ok, _ := path.Match(pattern, base); !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(value, ";"):
+			params := strings.TrimSpace(value[1:])
+			if m.params != "" {
+				params = m.params + "; " + params
+			}
+			m.params = params
+		case len(value) >= 3 && value[2] == ' ' && isDigits(value[:2]):
+			code, _ := strconv.Atoi(value[:2])
+			m.status = Status(code)
+			m.meta = strings.TrimSpace(value[3:])
+		default:
+			m.mediatype = value
+		}
+	}
+	return m
+}
+
+// mediaTypeFor returns the media type for a file whose media type is
+// otherwise detected as mediatype.
+func (m fileMeta) mediaTypeFor(mediatype string) string {
+	if m.mediatype != "" {
+		mediatype = m.mediatype
+	}
+	if m.params != "" {
+		if mediatype == "" {
+			mediatype = "text/gemini"
+		}
+		mediatype += "; " + m.params
+	}
+	return mediatype
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -2,6 +2,7 @@ package gemini
 
 import (
 	"errors"
+	"fmt"
 	"mime"
 )
 
@@ -18,9 +19,36 @@ var (
 
 	// ErrBodyNotAllowed is returned by ResponseWriter.Write calls
 	// when the response status code does not permit a body.
+	// Write may return a *BodyNotAllowedError instead, which
+	// matches ErrBodyNotAllowed when compared using errors.Is.
 	ErrBodyNotAllowed = errors.New("gemini: response status code does not allow body")
+
+	// ErrHijacked is returned by ResponseWriter.Write and Flush calls
+	// when the underlying connection has been hijacked using the
+	// Hijacker interface.
+	ErrHijacked = errors.New("gemini: connection has been hijacked")
+
+	// ErrResponseClosed is returned by ResponseWriter.Write calls
+	// after the response has been closed with ResponseWriter.Close.
+	ErrResponseClosed = errors.New("gemini: response has been closed")
 )
 
+// BodyNotAllowedError is returned by ResponseWriter.Write calls when the
+// status code of the response does not permit a body.
+type BodyNotAllowedError struct {
+	// Status is the status code of the response.
+	Status Status
+}
+
+func (e *BodyNotAllowedError) Error() string {
+	return fmt.Sprintf("gemini: response status code %d does not allow body", e.Status)
+}
+
+// Is reports whether target is ErrBodyNotAllowed.
+func (e *BodyNotAllowedError) Is(target error) bool {
+	return target == ErrBodyNotAllowed
+}
+
 var crlf = []byte("\r\n")
 
 func trimCRLF(b []byte) ([]byte, bool) {
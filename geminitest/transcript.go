@@ -0,0 +1,139 @@
+// Package geminitest provides utilities for testing Gemini clients.
+package geminitest
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
+)
+
+// A TranscriptServer is a Gemini server listening on a loopback address
+// that replies to each connection with a recorded transcript.
+//
+// Transcripts are written to connections as raw bytes, bypassing the
+// checks performed by gemini.ResponseWriter. This makes it possible to
+// simulate servers that send malformed headers, truncated bodies and
+// other protocol errors, in order to test the robustness of clients.
+type TranscriptServer struct {
+	// URL is the base URL of the server, of the form
+	// "gemini://127.0.0.1:port/".
+	URL string
+
+	// Listener is the underlying listener.
+	Listener net.Listener
+
+	// Certificate is the self-signed certificate of the server.
+	Certificate tls.Certificate
+
+	transcripts [][]byte
+	requests    []string
+	conns       map[net.Conn]struct{}
+	n           int
+	mu          sync.Mutex
+	wg          sync.WaitGroup
+}
+
+// NewTranscriptServer starts and returns a new TranscriptServer.
+// The nth connection is answered with transcripts[n % len(transcripts)].
+// The caller should call Close when finished, to shut it down.
+//
+// NewTranscriptServer panics if no transcripts are provided or if the
+// server cannot be started.
+func NewTranscriptServer(transcripts ...[]byte) *TranscriptServer {
+	if len(transcripts) == 0 {
+		panic("geminitest: no transcripts")
+	}
+	cert, err := certificate.Create(certificate.CreateOptions{
+		DNSNames:    []string{"localhost"},
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		Duration:    time.Hour,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("geminitest: failed to create certificate: %v", err))
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(fmt.Sprintf("geminitest: failed to listen: %v", err))
+	}
+
+	s := &TranscriptServer{
+		URL:         "gemini://" + l.Addr().String() + "/",
+		Certificate: cert,
+		transcripts: transcripts,
+		conns:       make(map[net.Conn]struct{}),
+	}
+	s.Listener = tls.NewListener(l, &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequestClientCert,
+		MinVersion:   tls.VersionTLS12,
+	})
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+func (s *TranscriptServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.Listener.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		transcript := s.transcripts[s.n%len(s.transcripts)]
+		s.n++
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn, transcript)
+		}()
+	}
+}
+
+func (s *TranscriptServer) serveConn(conn net.Conn, transcript []byte) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	// Read the request line, accepting malformed requests.
+	br := bufio.NewReaderSize(conn, 1026)
+	line, err := br.ReadSlice('\n')
+	if err != nil && err != bufio.ErrBufferFull {
+		return
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, string(line))
+	s.mu.Unlock()
+
+	conn.Write(transcript)
+}
+
+// Requests returns the raw requests received by the server so far,
+// in the order in which they were received.
+func (s *TranscriptServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Close shuts down the server, closing any active connections.
+func (s *TranscriptServer) Close() {
+	s.Listener.Close()
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
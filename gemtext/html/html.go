@@ -0,0 +1,211 @@
+// Package html converts Gemini text to HTML.
+//
+// A Writer writes Gemini text lines as HTML elements, and Convert
+// converts a complete Gemini text document:
+//
+//	err := html.Convert(w, resp.Body, html.Options{Document: true})
+//
+// All text is escaped, and links with schemes that can execute code in
+// a browser, such as "javascript:", are neutralized, so that untrusted
+// Gemini text can be converted safely.
+package html
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// Options configures the HTML written by a Writer.
+type Options struct {
+	// Document specifies whether the HTML should be a complete document,
+	// starting with a doctype and a character set declaration.
+	// Otherwise, only the elements for the lines are written.
+	Document bool
+
+	// Classes optionally specifies CSS classes for the elements written
+	// for each kind of line.
+	Classes Classes
+
+	// HeadingOffset is added to the level of headings, so that with an
+	// offset of 1, level 1 headings are written as <h2> elements.
+	// Levels are limited to 6.
+	HeadingOffset int
+
+	// RewriteURL optionally specifies a function that rewrites the URLs
+	// of links, for example to refer to an HTTP gateway.
+	RewriteURL func(url string) string
+}
+
+// Classes specifies the CSS classes of the HTML elements written for
+// each kind of line. Empty classes are omitted.
+type Classes struct {
+	Link         string // <p> elements containing links
+	Preformatted string // <pre> elements
+	Heading      string // <h1> to <h6> elements
+	List         string // <ul> elements
+	ListItem     string // <li> elements
+	Quote        string // <blockquote> elements
+	Text         string // <p> elements
+}
+
+// A Writer writes Gemini text lines as HTML.
+// It implements gemini.Renderer, so that it can be used with gemini.Render
+// to convert Gemini text as it is read.
+type Writer struct {
+	w       io.Writer
+	opts    Options
+	started bool
+	pre     bool
+	list    bool
+	err     error
+}
+
+// NewWriter returns a new Writer that writes HTML to w.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	return &Writer{w: w, opts: opts}
+}
+
+// Convert converts the Gemini text read from r into HTML and writes it
+// to w.
+func Convert(w io.Writer, r io.Reader, opts Options) error {
+	hw := NewWriter(w, opts)
+	if err := gemini.Render(r, hw); err != nil {
+		return err
+	}
+	return hw.Close()
+}
+
+// RenderLine writes the line as HTML. It implements gemini.Renderer.
+func (w *Writer) RenderLine(line gemini.Line, offset int64) error {
+	return w.WriteLine(line)
+}
+
+// WriteLine writes the line as HTML. It returns the first error
+// encountered writing to the underlying io.Writer, if any.
+func (w *Writer) WriteLine(line gemini.Line) error {
+	w.start()
+	if _, ok := line.(gemini.LineListItem); ok {
+		if !w.list {
+			w.list = true
+			w.printf("<ul%s>\n", class(w.opts.Classes.List))
+		}
+	} else if w.list {
+		w.list = false
+		w.printf("</ul>\n")
+	}
+	switch line := line.(type) {
+	case gemini.LineLink:
+		url := line.URL
+		if w.opts.RewriteURL != nil {
+			url = w.opts.RewriteURL(url)
+		}
+		url = html.EscapeString(safeURL(url))
+		name := html.EscapeString(line.Name)
+		if name == "" {
+			name = url
+		}
+		w.printf("<p%s><a href=\"%s\">%s</a></p>\n", class(w.opts.Classes.Link), url, name)
+	case gemini.LinePreformattingToggle:
+		w.pre = !w.pre
+		if w.pre {
+			w.printf("<pre%s>\n", class(w.opts.Classes.Preformatted))
+		} else {
+			w.printf("</pre>\n")
+		}
+	case gemini.LinePreformattedText:
+		w.printf("%s\n", html.EscapeString(string(line)))
+	case gemini.LineHeading1:
+		w.heading(1, string(line))
+	case gemini.LineHeading2:
+		w.heading(2, string(line))
+	case gemini.LineHeading3:
+		w.heading(3, string(line))
+	case gemini.LineListItem:
+		w.printf("<li%s>%s</li>\n", class(w.opts.Classes.ListItem), html.EscapeString(string(line)))
+	case gemini.LineQuote:
+		w.printf("<blockquote%s>%s</blockquote>\n", class(w.opts.Classes.Quote), html.EscapeString(string(line)))
+	case gemini.LineText:
+		if line == "" {
+			w.printf("<br>\n")
+		} else {
+			w.printf("<p%s>%s</p>\n", class(w.opts.Classes.Text), html.EscapeString(string(line)))
+		}
+	}
+	return w.err
+}
+
+// Close closes any open elements. It does not close the underlying
+// io.Writer.
+func (w *Writer) Close() error {
+	w.start()
+	if w.pre {
+		w.pre = false
+		w.printf("</pre>\n")
+	}
+	if w.list {
+		w.list = false
+		w.printf("</ul>\n")
+	}
+	return w.err
+}
+
+// start writes the start of the document, if necessary.
+func (w *Writer) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	if w.opts.Document {
+		w.printf("<!DOCTYPE html>\n<meta charset=\"utf-8\">\n")
+	}
+}
+
+func (w *Writer) heading(level int, text string) {
+	level += w.opts.HeadingOffset
+	if level < 1 {
+		level = 1
+	} else if level > 6 {
+		level = 6
+	}
+	w.printf("<h%d%s>%s</h%d>\n", level, class(w.opts.Classes.Heading), html.EscapeString(text), level)
+}
+
+func (w *Writer) printf(format string, args ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = fmt.Fprintf(w.w, format, args...)
+}
+
+// class returns the class attribute for the provided class, if any.
+func class(name string) string {
+	if name == "" {
+		return ""
+	}
+	return " class=\"" + html.EscapeString(name) + "\""
+}
+
+// safeURL returns "#" in place of URLs with schemes that can execute
+// code in a browser.
+func safeURL(url string) string {
+	i := strings.IndexByte(url, ':')
+	if i == -1 {
+		return url
+	}
+	// Browsers ignore whitespace and control characters in schemes
+	scheme := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, url[:i])
+	switch strings.ToLower(scheme) {
+	case "javascript", "vbscript", "data":
+		return "#"
+	}
+	return url
+}
@@ -0,0 +1,89 @@
+package html
+
+import (
+	"strings"
+	"testing"
+)
+
+const text = `# Title
+Some <text> & more
+
+=> gemini://example.com/ Example
+=> /relative
+=> javascript:alert(1) Script
+=> JavaScript:alert(1) Upper script
+* one
+* two
+> quote
+## Subheading
+### Section
+=> java` + "\x01" + `script:alert(1) Control script
+` + "```alt\n<pre>\n```\n"
+
+func TestConvert(t *testing.T) {
+	want := `<h1>Title</h1>
+<p>Some &lt;text&gt; &amp; more</p>
+<br>
+<p><a href="gemini://example.com/">Example</a></p>
+<p><a href="/relative">/relative</a></p>
+<p><a href="#">Script</a></p>
+<p><a href="#">Upper script</a></p>
+<ul>
+<li>one</li>
+<li>two</li>
+</ul>
+<blockquote>quote</blockquote>
+<h2>Subheading</h2>
+<h3>Section</h3>
+<p><a href="#">Control script</a></p>
+<pre>
+&lt;pre&gt;
+</pre>
+`
+	var b strings.Builder
+	if err := Convert(&b, strings.NewReader(text), Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, b.String())
+	}
+}
+
+func TestConvertOptions(t *testing.T) {
+	text := "# Title\n### Section\n=> gemini://example.com/page Page\n* item\nText\n```\nunterminated"
+	want := `<!DOCTYPE html>
+<meta charset="utf-8">
+<h2 class="h">Title</h2>
+<h4 class="h">Section</h4>
+<p class="link"><a href="https://example.com/page">Page</a></p>
+<ul class="list">
+<li class="item">item</li>
+</ul>
+<p class="&#34;text&#34;">Text</p>
+<pre class="pre">
+unterminated
+</pre>
+`
+	opts := Options{
+		Document:      true,
+		HeadingOffset: 1,
+		Classes: Classes{
+			Heading:      "h",
+			Link:         "link",
+			List:         "list",
+			ListItem:     "item",
+			Text:         `"text"`,
+			Preformatted: "pre",
+		},
+		RewriteURL: func(url string) string {
+			return strings.Replace(url, "gemini://", "https://", 1)
+		},
+	}
+	var b strings.Builder
+	if err := Convert(&b, strings.NewReader(text), opts); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, b.String())
+	}
+}
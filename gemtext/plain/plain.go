@@ -0,0 +1,190 @@
+// Package plain converts Gemini text to wrapped plain text, for display
+// in terminals or inclusion in e-mail messages.
+//
+// Lines are wrapped at word boundaries to the configured width. List
+// items and quotes are prefixed with a bullet and a quote marker, and
+// continuation lines are indented accordingly. Preformatted text is
+// written as is. Links are written with their URL, either inline or as
+// numbered footnotes at the end of the text:
+//
+//	err := plain.Convert(os.Stdout, resp.Body, plain.Options{Footnotes: true})
+package plain
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// Options configures the plain text written by a Writer.
+type Options struct {
+	// Width is the maximum width of lines in characters. If zero, lines
+	// are wrapped at 80 characters. If negative, lines are not wrapped.
+	// Words longer than the width are not broken.
+	Width int
+
+	// Bullet is the prefix of list items. If empty, "* " is used.
+	Bullet string
+
+	// Quote is the prefix of quote lines. If empty, "> " is used.
+	Quote string
+
+	// Footnotes specifies whether the URLs of links should be written
+	// as numbered footnotes at the end of the text, rather than after
+	// the name of each link.
+	Footnotes bool
+}
+
+// A Writer writes Gemini text lines as plain text.
+// It implements gemini.Renderer, so that it can be used with gemini.Render
+// to convert Gemini text as it is read.
+type Writer struct {
+	w     io.Writer
+	opts  Options
+	links []string // URLs of footnoted links
+	err   error
+}
+
+// NewWriter returns a new Writer that writes plain text to w.
+func NewWriter(w io.Writer, opts Options) *Writer {
+	if opts.Width == 0 {
+		opts.Width = 80
+	}
+	if opts.Bullet == "" {
+		opts.Bullet = "* "
+	}
+	if opts.Quote == "" {
+		opts.Quote = "> "
+	}
+	return &Writer{w: w, opts: opts}
+}
+
+// Convert converts the Gemini text read from r into plain text and
+// writes it to w.
+func Convert(w io.Writer, r io.Reader, opts Options) error {
+	pw := NewWriter(w, opts)
+	if err := gemini.Render(r, pw); err != nil {
+		return err
+	}
+	return pw.Close()
+}
+
+// RenderLine writes the line as plain text. It implements
+// gemini.Renderer.
+func (w *Writer) RenderLine(line gemini.Line, offset int64) error {
+	return w.WriteLine(line)
+}
+
+// WriteLine writes the line as plain text. It returns the first error
+// encountered writing to the underlying io.Writer, if any.
+func (w *Writer) WriteLine(line gemini.Line) error {
+	switch line := line.(type) {
+	case gemini.LineLink:
+		name := line.Name
+		if name == "" {
+			name = line.URL
+		}
+		if w.opts.Footnotes {
+			w.links = append(w.links, line.URL)
+			w.wrap(fmt.Sprintf("%s [%d]", name, len(w.links)), "", "")
+		} else if name != line.URL {
+			w.wrap(name+" <"+line.URL+">", "", "")
+		} else {
+			w.wrap(name, "", "")
+		}
+	case gemini.LinePreformattingToggle:
+		// Preformatted text is written without markers
+	case gemini.LinePreformattedText:
+		w.writeLine(string(line))
+	case gemini.LineHeading1:
+		w.heading(string(line), '=')
+	case gemini.LineHeading2:
+		w.heading(string(line), '-')
+	case gemini.LineHeading3:
+		w.wrap(string(line), "", "")
+	case gemini.LineListItem:
+		w.wrap(string(line), w.opts.Bullet, strings.Repeat(" ", utf8.RuneCountInString(w.opts.Bullet)))
+	case gemini.LineQuote:
+		w.wrap(string(line), w.opts.Quote, w.opts.Quote)
+	case gemini.LineText:
+		w.wrap(string(line), "", "")
+	}
+	return w.err
+}
+
+// Close writes the footnotes of the text, if any. It does not close the
+// underlying io.Writer.
+func (w *Writer) Close() error {
+	if len(w.links) == 0 {
+		return w.err
+	}
+	w.writeLine("")
+	for i, url := range w.links {
+		w.writeLine(fmt.Sprintf("[%d] %s", i+1, url))
+	}
+	w.links = nil
+	return w.err
+}
+
+// heading writes a heading underlined with the provided character.
+func (w *Writer) heading(text string, underline rune) {
+	width := 0
+	for _, line := range w.wrapLines(text, "", "") {
+		w.writeLine(line)
+		if n := utf8.RuneCountInString(line); n > width {
+			width = n
+		}
+	}
+	if width > 0 {
+		w.writeLine(strings.Repeat(string(underline), width))
+	}
+}
+
+// wrap writes the text wrapped to the width of the Writer. The first
+// line is prefixed with first and the others with rest.
+func (w *Writer) wrap(text, first, rest string) {
+	for _, line := range w.wrapLines(text, first, rest) {
+		w.writeLine(line)
+	}
+}
+
+// wrapLines returns the text wrapped to the width of the Writer.
+func (w *Writer) wrapLines(text, first, rest string) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 || w.opts.Width < 0 {
+		return []string{strings.TrimRight(first+text, " ")}
+	}
+	var lines []string
+	var b strings.Builder
+	b.WriteString(first)
+	width := utf8.RuneCountInString(first)
+	empty := true
+	for _, word := range words {
+		n := utf8.RuneCountInString(word)
+		if !empty && width+1+n > w.opts.Width {
+			lines = append(lines, b.String())
+			b.Reset()
+			b.WriteString(rest)
+			width = utf8.RuneCountInString(rest)
+			empty = true
+		}
+		if !empty {
+			b.WriteByte(' ')
+			width++
+		}
+		b.WriteString(word)
+		width += n
+		empty = false
+	}
+	return append(lines, b.String())
+}
+
+func (w *Writer) writeLine(line string) {
+	if w.err != nil {
+		return
+	}
+	_, w.err = io.WriteString(w.w, line+"\n")
+}
@@ -0,0 +1,69 @@
+package plain
+
+import (
+	"strings"
+	"testing"
+)
+
+const text = `# A title
+Lorem ipsum dolor sit amet, consectetur adipiscing elit.
+
+=> gemini://example.com/ Example link
+=> gemini://example.org/
+* A list item that is long enough to wrap
+> A quote that is long enough to wrap
+` + "```\nPreformatted   text that is not wrapped\n```\n"
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		Options Options
+		Want    string
+	}{
+		{
+			Options: Options{Width: 20},
+			Want: `A title
+=======
+Lorem ipsum dolor
+sit amet,
+consectetur
+adipiscing elit.
+
+Example link
+<gemini://example.com/>
+gemini://example.org/
+* A list item that
+  is long enough to
+  wrap
+> A quote that is
+> long enough to
+> wrap
+Preformatted   text that is not wrapped
+`,
+		},
+		{
+			Options: Options{Width: -1, Bullet: "- ", Quote: "| ", Footnotes: true},
+			Want: `A title
+=======
+Lorem ipsum dolor sit amet, consectetur adipiscing elit.
+
+Example link [1]
+gemini://example.org/ [2]
+- A list item that is long enough to wrap
+| A quote that is long enough to wrap
+Preformatted   text that is not wrapped
+
+[1] gemini://example.com/
+[2] gemini://example.org/
+`,
+		},
+	}
+	for _, test := range tests {
+		var b strings.Builder
+		if err := Convert(&b, strings.NewReader(text), test.Options); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != test.Want {
+			t.Errorf("%+v: expected:\n%s\ngot:\n%s", test.Options, test.Want, b.String())
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package template helps generate Gemini text with text/template.
+//
+// Funcs returns functions for use in templates that escape untrusted
+// text and format it as Gemini text lines, so that values interpolated
+// into a template cannot inject links, headings or preformatting toggles:
+//
+//	tmpl := template.Must(template.New("page").Parse(
+//		"{{heading 1 .Title}}\n{{escape .Body}}\n{{link .URL \"Back\"}}\n"))
+//
+// Handler executes a template for each request and responds with the
+// resulting Gemini text.
+package template
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// Must is a helper that wraps a call to a function returning a template
+// and an error, and panics if the error is non-nil, like template.Must.
+func Must(t *template.Template, err error) *template.Template {
+	return template.Must(t, err)
+}
+
+// New returns a new text/template.Template with the provided name and
+// the functions returned by Funcs.
+func New(name string) *template.Template {
+	return template.New(name).Funcs(Funcs())
+}
+
+// Funcs returns the functions made available to templates created with
+// New. They can also be added to other templates with Template.Funcs.
+//
+//	escape TEXT
+//		Escapes the text so that each of its lines is a text line.
+//		See gemini.EscapeText.
+//	link URL [NAME]
+//		Formats a link line. Whitespace in the URL is percent-encoded,
+//		and line breaks in the name are replaced with spaces.
+//	query TEXT
+//		Escapes the text for use in a URL query. See gemini.QueryEscape.
+//	heading LEVEL TEXT
+//		Formats a heading line of the level, from 1 to 3.
+//	list ITEMS
+//		Formats each element of a slice as a list item line.
+//	quote TEXT
+//		Formats each line of the text as a quote line.
+//	pre ALT TEXT
+//		Formats the text as a preformatted block with the alt text.
+//
+// Each function formats single lines without a trailing newline, so that
+// lines are separated by the newlines in the template.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"escape":  gemini.EscapeText,
+		"link":    link,
+		"query":   gemini.QueryEscape,
+		"heading": heading,
+		"list":    list,
+		"quote":   quote,
+		"pre":     pre,
+	}
+}
+
+// singleLine replaces line breaks in s with spaces.
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// urlSpaceReplacer percent-encodes whitespace in URLs.
+var urlSpaceReplacer = strings.NewReplacer(" ", "%20", "\t", "%09", "\r", "%0D", "\n", "%0A")
+
+func link(url string, name ...string) string {
+	return gemini.LineLink{
+		URL:  urlSpaceReplacer.Replace(url),
+		Name: singleLine(strings.Join(name, " ")),
+	}.String()
+}
+
+func heading(level int, text string) (string, error) {
+	text = singleLine(text)
+	switch level {
+	case 1:
+		return gemini.LineHeading1(text).String(), nil
+	case 2:
+		return gemini.LineHeading2(text).String(), nil
+	case 3:
+		return gemini.LineHeading3(text).String(), nil
+	}
+	return "", fmt.Errorf("invalid heading level %d", level)
+}
+
+func list(items interface{}) (string, error) {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("list of %T, expected slice", items)
+	}
+	lines := make([]string, v.Len())
+	for i := range lines {
+		item := fmt.Sprint(v.Index(i).Interface())
+		lines[i] = gemini.LineListItem(singleLine(item)).String()
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func quote(text string) string {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = gemini.LineQuote(strings.TrimSuffix(line, "\r")).String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func pre(alt, text string) string {
+	var b strings.Builder
+	b.WriteString(gemini.LinePreformattingToggle(singleLine(alt)).String())
+	b.WriteByte('\n')
+	if text == "" {
+		b.WriteString("```")
+		return b.String()
+	}
+	for _, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		// Lines starting with a toggle would end the block
+		if strings.HasPrefix(line, "```") {
+			b.WriteByte(' ')
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteString("```")
+	return b.String()
+}
+
+// Handler responds to each request with the Gemini text produced by
+// executing a template.
+//
+// The template is executed before the response header is written, so
+// that a template error results in a "40 Temporary failure" response
+// rather than a partial document.
+type Handler struct {
+	// Template is the template to execute.
+	Template *template.Template
+
+	// Name optionally specifies the name of the associated template to
+	// execute. If empty, Template itself is executed.
+	Name string
+
+	// Data optionally returns the data passed to the template for a
+	// request. If nil, gemini.NewTemplateData is used.
+	Data func(r *gemini.Request) interface{}
+
+	// ErrorLog specifies an optional logger for errors executing the
+	// template. If nil, logging is done via the log package's standard
+	// logger.
+	ErrorLog interface {
+		Printf(format string, v ...interface{})
+	}
+}
+
+// ServeGemini executes the template and writes the result to w with the
+// media type "text/gemini".
+func (h *Handler) ServeGemini(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	var data interface{}
+	if h.Data != nil {
+		data = h.Data(r)
+	} else {
+		data = gemini.NewTemplateData(r)
+	}
+	var buf bytes.Buffer
+	var err error
+	if h.Name != "" {
+		err = h.Template.ExecuteTemplate(&buf, h.Name, data)
+	} else {
+		err = h.Template.Execute(&buf, data)
+	}
+	if err != nil {
+		h.logf("template: %v", err)
+		w.WriteHeader(gemini.StatusTemporaryFailure, "Temporary failure")
+		return
+	}
+	w.SetMediaType("text/gemini")
+	w.Write(buf.Bytes())
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
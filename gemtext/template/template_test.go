@@ -0,0 +1,104 @@
+package template
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+func TestFuncs(t *testing.T) {
+	const src = `{{heading 1 .Title}}
+{{escape .Body}}
+{{link .URL .Name}}
+{{link "/search?" (query .Query)}}
+{{list .Items}}
+{{quote .Quote}}
+{{pre "alt" .Pre}}
+`
+	data := map[string]interface{}{
+		"Title": "Title\n=> injected",
+		"Body":  "=> gemini://evil.example\n```",
+		"URL":   "/my page.gmi",
+		"Name":  "My\npage",
+		"Query": "a b+c",
+		"Items": []string{"one", "two\n# three"},
+		"Quote": "first\n=> second",
+		"Pre":   "code\n```\n# more",
+	}
+	const want = "# Title => injected\n" +
+		" => gemini://evil.example\n ```\n" +
+		"=> /my%20page.gmi My page\n" +
+		"=> /search? a%20b%2Bc\n" +
+		"* one\n* two # three\n" +
+		"> first\n> => second\n" +
+		"```alt\ncode\n ```\n# more\n```\n"
+
+	tmpl := Must(New("test").Parse(src))
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want {
+		t.Errorf("expected:\n%s\ngot:\n%s", want, b.String())
+	}
+
+	for _, src := range []string{`{{heading 4 "x"}}`, `{{list "x"}}`} {
+		tmpl := Must(New("test").Parse(src))
+		if err := tmpl.Execute(&b, nil); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, v ...interface{}) {}
+
+func TestHandler(t *testing.T) {
+	tmpl := Must(New("page").Parse(`{{define "query"}}{{heading 1 .Query}}{{end}}{{.URL.Path}}`))
+	tests := []struct {
+		Handler *Handler
+		Status  gemini.Status
+		Meta    string
+		Body    string
+	}{
+		{&Handler{Template: tmpl}, gemini.StatusSuccess, "text/gemini", "/path"},
+		{&Handler{Template: tmpl, Name: "query"}, gemini.StatusSuccess, "text/gemini", "# a b"},
+		{&Handler{Template: tmpl, Data: func(r *gemini.Request) interface{} {
+			return map[string]string{"Query": "data"}
+		}, Name: "query"}, gemini.StatusSuccess, "text/gemini", "# data"},
+		{&Handler{Template: tmpl, Name: "missing", ErrorLog: discardLogger{}}, gemini.StatusTemporaryFailure, "Temporary failure", ""},
+	}
+	for _, test := range tests {
+		req, err := gemini.NewRequest("gemini://example.com/path?a%20b")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &recorder{}
+		test.Handler.ServeGemini(context.Background(), w, req)
+		if w.status == 0 {
+			w.status, w.meta = gemini.StatusSuccess, w.mediatype
+		}
+		if w.status != test.Status || w.meta != test.Meta || w.body.String() != test.Body {
+			t.Errorf("expected %d %q %q, got %d %q %q", test.Status, test.Meta, test.Body, w.status, w.meta, w.body.String())
+		}
+	}
+}
+
+type recorder struct {
+	status    gemini.Status
+	meta      string
+	mediatype string
+	body      strings.Builder
+}
+
+func (r *recorder) SetMediaType(mediatype string) { r.mediatype = mediatype }
+func (r *recorder) Write(b []byte) (int, error)   { return r.body.Write(b) }
+func (r *recorder) WriteHeader(status gemini.Status, meta string) {
+	r.status, r.meta = status, meta
+}
+func (r *recorder) Flush() error  { return nil }
+func (r *recorder) Written() bool { return r.status != 0 || r.body.Len() > 0 }
+func (r *recorder) Close() error  { return nil }
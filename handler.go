@@ -3,6 +3,8 @@ package gemini
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/url"
 	"strings"
@@ -16,8 +18,9 @@ import (
 // valid to use the ResponseWriter after or concurrently with the completion
 // of the ServeGemini call.
 //
-// The provided context is canceled when the client's connection is closed
-// or the ServeGemini method returns.
+// The provided context is canceled when the server finds that the client
+// has gone away while writing or flushing the response, or when the
+// ServeGemini method returns.
 //
 // Handlers should not modify the provided Request.
 type Handler interface {
@@ -34,6 +37,50 @@ func (f HandlerFunc) ServeGemini(ctx context.Context, w ResponseWriter, r *Reque
 	f(ctx, w, r)
 }
 
+// The HandlerE type is an adapter to allow the use of ordinary functions
+// that return errors as Gemini handlers. If f is a function with the
+// appropriate signature, HandlerE(f) is a Handler that calls f.
+//
+// If f returns a non-nil error and no response header has been written,
+// a header describing the error is written. If the error is or wraps an
+// *Error, its status code and meta are used. Otherwise, the handler
+// responds with "40 Temporary failure" and the error is logged by the
+// server serving the request, if any.
+type HandlerE func(context.Context, ResponseWriter, *Request) error
+
+// ServeGemini calls f(ctx, w, r) and handles the returned error.
+func (f HandlerE) ServeGemini(ctx context.Context, w ResponseWriter, r *Request) {
+	err := f(ctx, w, r)
+	if err == nil || w.Written() {
+		return
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		meta := e.Meta
+		if meta == "" {
+			meta = e.Status.String()
+		}
+		w.WriteHeader(e.Status, meta)
+		return
+	}
+	if srv := ServerFromContext(ctx); srv != nil {
+		srv.logError("handler error", "url", r.URL, "err", err)
+	}
+	w.WriteHeader(StatusTemporaryFailure, "Temporary failure")
+}
+
+// An Error is an error that is sent to the client as a response header
+// with the provided status code and meta. It is used with HandlerE.
+// If Meta is empty, the text for the status code is used.
+type Error struct {
+	Status Status
+	Meta   string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gemini: %d %s", e.Status, e.Meta)
+}
+
 // StatusHandler returns a request handler that responds to each request
 // with the provided status code and meta.
 func StatusHandler(status Status, meta string) Handler {
@@ -42,25 +89,126 @@ func StatusHandler(status Status, meta string) Handler {
 	})
 }
 
+// Input replies to the request with "10" and the provided prompt,
+// asking the client to provide input.
+func Input(w ResponseWriter, prompt string) {
+	w.WriteHeader(StatusInput, prompt)
+}
+
+// SensitiveInput replies to the request with "11" and the provided
+// prompt, asking the client to provide sensitive input such as a
+// password. Clients should not echo the input.
+func SensitiveInput(w ResponseWriter, prompt string) {
+	w.WriteHeader(StatusSensitiveInput, prompt)
+}
+
+// Redirect replies to the request with a redirect to target, which may
+// be a path relative to the request path. If permanent is true, the
+// status code is "31 Permanent redirect". Otherwise, it is "30 Redirect".
+//
+// If target is relative, it is resolved against the request URL, so that
+// the client receives an absolute URL.
+func Redirect(w ResponseWriter, r *Request, target string, permanent bool) {
+	if ref, err := url.Parse(target); err == nil && r.URL != nil {
+		target = r.URL.ResolveReference(ref).String()
+	}
+	status := StatusRedirect
+	if permanent {
+		status = StatusPermanentRedirect
+	}
+	w.WriteHeader(status, target)
+}
+
+// CertificateRequired replies to the request with
+// "60 Certificate required".
+func CertificateRequired(w ResponseWriter) {
+	w.WriteHeader(StatusCertificateRequired, "Certificate required")
+}
+
+// CertificateNotAuthorized replies to the request with
+// "61 Certificate not authorized".
+func CertificateNotAuthorized(w ResponseWriter) {
+	w.WriteHeader(StatusCertificateNotAuthorized, "Certificate not authorized")
+}
+
+// CertificateNotValid replies to the request with
+// "62 Certificate not valid".
+func CertificateNotValid(w ResponseWriter) {
+	w.WriteHeader(StatusCertificateNotValid, "Certificate not valid")
+}
+
 // NotFoundHandler returns a simple request handler that replies to each
 // request with a “51 Not found” reply.
 func NotFoundHandler() Handler {
 	return StatusHandler(StatusNotFound, "Not found")
 }
 
+// GoneHandler returns a simple request handler that replies to each
+// request with a “52 Gone” reply.
+func GoneHandler() Handler {
+	return StatusHandler(StatusGone, "Gone")
+}
+
+// ProxyRefusedHandler returns a simple request handler that replies to
+// each request with a “53 Proxy request refused” reply.
+func ProxyRefusedHandler() Handler {
+	return StatusHandler(StatusProxyRequestRefused, "Proxy request refused")
+}
+
+// RedirectHandler returns a request handler that redirects each request
+// it receives to target, which may be relative to the request URL.
+// See Redirect.
+func RedirectHandler(target string, permanent bool) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		Redirect(w, r, target, permanent)
+	})
+}
+
+// HostSwitch is a handler that dispatches requests to the handler for
+// the host of the request URL, ignoring the port. Hosts are matched
+// case-insensitively and in their ASCII (punycode) form, so the keys of
+// the map should be lowercase ASCII hostnames. The handler for the empty
+// host, if any, handles requests for hosts that are not in the map.
+// Other requests are answered with "51 Not found".
+//
+// HostSwitch is suitable for virtual hosting when the pattern matching
+// of Mux is not needed:
+//
+//	hosts := gemini.HostSwitch{
+//		"example.com": exampleHandler,
+//		"example.org": orgHandler,
+//		"":            gemini.StatusHandler(gemini.StatusProxyRequestRefused, "Proxy request refused"),
+//	}
+type HostSwitch map[string]Handler
+
+// ServeGemini dispatches the request to the handler for its host.
+func (s HostSwitch) ServeGemini(ctx context.Context, w ResponseWriter, r *Request) {
+	h, ok := s[normalizeHost(r.URL.Hostname())]
+	if !ok {
+		h, ok = s[""]
+	}
+	if !ok || h == nil {
+		h = NotFoundHandler()
+	}
+	h.ServeGemini(ctx, w, r)
+}
+
 // StripPrefix returns a handler that serves Gemini requests by removing the
 // given prefix from the request URL's Path (and RawPath if set) and invoking
 // the handler h. StripPrefix handles a request for a path that doesn't begin
-// with prefix by replying with a Gemini 51 not found error. The prefix must
-// match exactly: if the prefix in the request contains escaped characters the
-// reply is also a Gemini 51 not found error.
+// with prefix by replying with a Gemini 51 not found error. The prefix is
+// unescaped: it is removed from the RawPath in its escaped form, which must
+// match exactly. If the prefix in the request is escaped differently, for
+// example "/a%2Fb" for the prefix "/a/b", the reply is also a Gemini 51 not
+// found error.
 func StripPrefix(prefix string, h Handler) Handler {
 	if prefix == "" {
 		return h
 	}
+	rawPrefix := (&url.URL{Path: prefix}).EscapedPath()
 	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
 		p := strings.TrimPrefix(r.URL.Path, prefix)
-		rp := strings.TrimPrefix(r.URL.RawPath, prefix)
+		rp := strings.TrimPrefix(r.URL.RawPath, rawPrefix)
 		if len(p) < len(r.URL.Path) && (r.URL.RawPath == "" || len(rp) < len(r.URL.RawPath)) {
 			r2 := new(Request)
 			*r2 = *r
@@ -75,6 +223,30 @@ func StripPrefix(prefix string, h Handler) Handler {
 	})
 }
 
+// AddPrefix returns a handler that serves Gemini requests by adding the
+// given prefix to the request URL's Path (and RawPath if set) and invoking
+// the handler h. It is the counterpart of StripPrefix, and can be used to
+// serve a handler that expects full paths from a Mux subtree whose prefix
+// has been stripped. The prefix is unescaped: it is added to the RawPath
+// in its escaped form.
+func AddPrefix(prefix string, h Handler) Handler {
+	if prefix == "" {
+		return h
+	}
+	rawPrefix := (&url.URL{Path: prefix}).EscapedPath()
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		r2 := new(Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = prefix + r.URL.Path
+		if r.URL.RawPath != "" {
+			r2.URL.RawPath = rawPrefix + r.URL.RawPath
+		}
+		h.ServeGemini(ctx, w, r2)
+	})
+}
+
 // TimeoutHandler returns a Handler that runs h with the given time limit.
 //
 // The new Handler calls h.ServeGemini to handle each request, but
@@ -131,6 +303,7 @@ type timeoutWriter struct {
 	meta        string
 	mediatype   string
 	wroteHeader bool
+	closed      bool
 }
 
 func (w *timeoutWriter) SetMediaType(mediatype string) {
@@ -141,6 +314,9 @@ func (w *timeoutWriter) Write(b []byte) (int, error) {
 	if !w.wroteHeader {
 		w.WriteHeader(StatusSuccess, w.mediatype)
 	}
+	if w.closed {
+		return 0, ErrResponseClosed
+	}
 	return w.wr.Write(b)
 }
 
@@ -156,3 +332,15 @@ func (w *timeoutWriter) WriteHeader(status Status, meta string) {
 func (w *timeoutWriter) Flush() error {
 	return nil
 }
+
+func (w *timeoutWriter) Written() bool {
+	return w.wroteHeader
+}
+
+func (w *timeoutWriter) Close() error {
+	if !w.wroteHeader {
+		w.WriteHeader(StatusTemporaryFailure, "Temporary failure")
+	}
+	w.closed = true
+	return nil
+}
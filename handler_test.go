@@ -0,0 +1,227 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestHandlerE(t *testing.T) {
+	tests := []struct {
+		Err    error
+		Status Status
+		Meta   string
+	}{
+		{nil, StatusSuccess, "text/gemini"},
+		{&Error{StatusNotFound, "No such page"}, StatusNotFound, "No such page"},
+		{&Error{Status: StatusGone}, StatusGone, "Gone"},
+		{fmt.Errorf("wrapped: %w", &Error{StatusSlowDown, "10"}), StatusSlowDown, "10"},
+		{errors.New("unknown"), StatusTemporaryFailure, "Temporary failure"},
+	}
+
+	req, err := NewRequest("gemini://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		h := HandlerE(func(ctx context.Context, w ResponseWriter, r *Request) error {
+			if test.Err != nil {
+				return test.Err
+			}
+			w.WriteHeader(StatusSuccess, "text/gemini")
+			return nil
+		})
+		rw := &recorder{}
+		h.ServeGemini(context.Background(), rw, req)
+		if rw.Status != test.Status || rw.Meta != test.Meta {
+			t.Errorf("%v: expected %d %q, got %d %q", test.Err, test.Status, test.Meta, rw.Status, rw.Meta)
+		}
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		Target    string
+		Permanent bool
+		Status    Status
+		Meta      string
+	}{
+		{"/other", false, StatusRedirect, "gemini://example.com/other"},
+		{"sibling", true, StatusPermanentRedirect, "gemini://example.com/dir/sibling"},
+		{"../up?q", false, StatusRedirect, "gemini://example.com/up?q"},
+		{"gemini://example.org/", false, StatusRedirect, "gemini://example.org/"},
+	}
+
+	req, err := NewRequest("gemini://example.com/dir/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		rw := &recorder{}
+		Redirect(rw, req, test.Target, test.Permanent)
+		if rw.Status != test.Status || rw.Meta != test.Meta {
+			t.Errorf("%q: expected %d %q, got %d %q", test.Target, test.Status, test.Meta, rw.Status, rw.Meta)
+		}
+	}
+}
+
+func TestHostSwitch(t *testing.T) {
+	hosts := HostSwitch{
+		"example.com":           StatusHandler(StatusSuccess, "example.com"),
+		"xn--bcher-kva.example": StatusHandler(StatusSuccess, "bücher"),
+	}
+	tests := []struct {
+		URL    string
+		Status Status
+		Meta   string
+	}{
+		{"gemini://example.com/path", StatusSuccess, "example.com"},
+		{"gemini://EXAMPLE.com:1966/", StatusSuccess, "example.com"},
+		{"gemini://bücher.example/", StatusSuccess, "bücher"},
+		{"gemini://example.org/", StatusNotFound, "Not found"},
+	}
+	for _, test := range tests {
+		req, err := NewRequest(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw := &recorder{}
+		hosts.ServeGemini(context.Background(), rw, req)
+		if rw.Status != test.Status || rw.Meta != test.Meta {
+			t.Errorf("%s: expected %d %q, got %d %q", test.URL, test.Status, test.Meta, rw.Status, rw.Meta)
+		}
+	}
+
+	hosts[""] = StatusHandler(StatusProxyRequestRefused, "Proxy request refused")
+	req, err := NewRequest("gemini://example.org/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := &recorder{}
+	hosts.ServeGemini(context.Background(), rw, req)
+	if rw.Status != StatusProxyRequestRefused {
+		t.Errorf("expected default handler, got %d %q", rw.Status, rw.Meta)
+	}
+}
+
+func TestStatusHandlers(t *testing.T) {
+	tests := []struct {
+		Handler Handler
+		Status  Status
+		Meta    string
+	}{
+		{NotFoundHandler(), StatusNotFound, "Not found"},
+		{GoneHandler(), StatusGone, "Gone"},
+		{ProxyRefusedHandler(), StatusProxyRequestRefused, "Proxy request refused"},
+		{RedirectHandler("/new", false), StatusRedirect, "gemini://example.com/new"},
+		{RedirectHandler("gemini://example.org/", true), StatusPermanentRedirect, "gemini://example.org/"},
+	}
+
+	req, err := NewRequest("gemini://example.com/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		rw := &recorder{}
+		test.Handler.ServeGemini(context.Background(), rw, req)
+		if rw.Status != test.Status || rw.Meta != test.Meta {
+			t.Errorf("expected %d %q, got %d %q", test.Status, test.Meta, rw.Status, rw.Meta)
+		}
+	}
+}
+
+func TestStripPrefix(t *testing.T) {
+	var got *Request
+	h := HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		got = r
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	})
+
+	tests := []struct {
+		Prefix  string
+		URL     string
+		Path    string
+		RawPath string
+		Status  Status
+	}{
+		{"/static", "gemini://example.com/static/style.css", "/style.css", "", StatusSuccess},
+		{"/static", "gemini://example.com/other/style.css", "", "", StatusNotFound},
+		{"/a b", "gemini://example.com/a%20b/c", "/c", "", StatusSuccess},
+		{"/dir", "gemini://example.com/dir/a%2Fb", "/a/b", "/a%2Fb", StatusSuccess},
+		{"/a b", "gemini://example.com/a%20b/x%2Fy", "/x/y", "/x%2Fy", StatusSuccess},
+		// The prefix must match the escaped path exactly
+		{"/a/b", "gemini://example.com/a%2Fb/c", "", "", StatusNotFound},
+	}
+	for _, test := range tests {
+		got = nil
+		req, err := NewRequest(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rw := &recorder{}
+		StripPrefix(test.Prefix, h).ServeGemini(context.Background(), rw, req)
+		if rw.Status != test.Status {
+			t.Errorf("%s: expected status %d, got %d", test.URL, test.Status, rw.Status)
+			continue
+		}
+		if got == nil {
+			continue
+		}
+		if got.URL.Path != test.Path || got.URL.RawPath != test.RawPath {
+			t.Errorf("%s: expected path %q (raw %q), got %q (raw %q)", test.URL, test.Path, test.RawPath, got.URL.Path, got.URL.RawPath)
+		}
+		if req.URL.Path == got.URL.Path {
+			t.Errorf("%s: request URL was modified", test.URL)
+		}
+	}
+}
+
+func TestAddPrefix(t *testing.T) {
+	var got *Request
+	h := AddPrefix("/a b", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		got = r
+	}))
+
+	tests := []struct {
+		URL     string
+		Path    string
+		RawPath string
+	}{
+		{"gemini://example.com/c", "/a b/c", ""},
+		{"gemini://example.com/x%2Fy", "/a b/x/y", "/a%20b/x%2Fy"},
+	}
+	for _, test := range tests {
+		got = nil
+		req, err := NewRequest(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h.ServeGemini(context.Background(), &recorder{}, req)
+		if got == nil {
+			t.Errorf("%s: handler was not called", test.URL)
+			continue
+		}
+		if got.URL.Path != test.Path || got.URL.RawPath != test.RawPath {
+			t.Errorf("%s: expected path %q (raw %q), got %q (raw %q)", test.URL, test.Path, test.RawPath, got.URL.Path, got.URL.RawPath)
+		}
+	}
+
+	// AddPrefix undoes StripPrefix
+	h = StripPrefix("/a b", AddPrefix("/a b", HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		got = r
+	})))
+	got = nil
+	req, err := NewRequest("gemini://example.com/a%20b/x%2Fy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := &recorder{}
+	h.ServeGemini(context.Background(), rw, req)
+	if got == nil {
+		t.Fatalf("handler was not called, got %d %q", rw.Status, rw.Meta)
+	}
+	if got.URL.EscapedPath() != req.URL.EscapedPath() {
+		t.Errorf("expected path %q, got %q", req.URL.EscapedPath(), got.URL.EscapedPath())
+	}
+}
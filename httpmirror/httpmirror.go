@@ -0,0 +1,276 @@
+// Package httpmirror serves a read-only HTTP mirror of a Gemini handler.
+//
+// The Handler in this package translates HTTP GET and HEAD requests into
+// Gemini requests and passes them to a gemini.Handler, such as a
+// gemini.Mux or a file server. Gemini text responses are converted to
+// HTML, and other responses are passed through with their media type.
+// This allows a capsule to offer a web mirror from the same code that
+// serves it over Gemini:
+//
+//	mux := &gemini.Mux{}
+//	mux.Handle("/", gemini.FileServer(os.DirFS("/var/gemini")))
+//	http.Handle("/", &httpmirror.Handler{Handler: mux})
+//	go http.ListenAndServeTLS(":443", "cert.pem", "key.pem", nil)
+//
+// Since the mirror is read-only, input requests and client certificates
+// are not supported.
+package httpmirror
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"git.sr.ht/~adnano/go-gemini"
+	gemhtml "git.sr.ht/~adnano/go-gemini/gemtext/html"
+)
+
+// A Handler serves a Gemini handler over HTTP.
+type Handler struct {
+	// The Gemini handler to mirror.
+	Handler gemini.Handler
+
+	// Host optionally specifies the hostname used in the URLs of
+	// the Gemini requests passed to Handler. If empty, the hostname
+	// of the HTTP request is used.
+	Host string
+
+	// ErrorLog specifies an optional logger for errors writing HTTP
+	// responses. If nil, logging is done via the log package's
+	// standard logger.
+	ErrorLog interface {
+		Printf(format string, v ...interface{})
+	}
+}
+
+// ServeHTTP translates the HTTP request into a Gemini request and writes
+// the Gemini response of the handler as an HTTP response.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	host := h.Host
+	if host == "" {
+		host = r.Host
+		if u, err := url.Parse("//" + host); err == nil {
+			host = u.Hostname()
+		}
+	}
+	u := &url.URL{
+		Scheme:   "gemini",
+		Host:     host,
+		Path:     r.URL.Path,
+		RawPath:  r.URL.RawPath,
+		RawQuery: r.URL.RawQuery,
+	}
+	req := &gemini.Request{URL: u}
+
+	rw := &responseWriter{w: w, host: host, head: r.Method == http.MethodHead}
+	if h.Handler == nil {
+		rw.WriteHeader(gemini.StatusNotFound, "Not found")
+	} else {
+		h.Handler.ServeGemini(r.Context(), rw, req)
+	}
+	// Gemini text is converted once the whole body has been written
+	if err := rw.Close(); err != nil {
+		h.logf("httpmirror: %v", err)
+	}
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
+
+// responseWriter translates Gemini responses into HTTP responses.
+// The bodies of Gemini text responses are buffered and converted to a
+// single HTML document when the response is closed, which happens at the
+// latest when the handler returns, so that flushing cannot split lines or
+// preformatted blocks. Other bodies are written and flushed as they are.
+type responseWriter struct {
+	w           http.ResponseWriter
+	host        string
+	head        bool
+	mediatype   string
+	status      gemini.Status
+	wroteHeader bool
+	bodyAllowed bool
+	gemtext     bool
+	closed      bool
+	buf         bytes.Buffer
+}
+
+func (w *responseWriter) SetMediaType(mediatype string) {
+	w.mediatype = mediatype
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		meta := w.mediatype
+		if meta == "" {
+			meta = "text/gemini"
+		}
+		w.WriteHeader(gemini.StatusSuccess, meta)
+	}
+	if w.closed {
+		return 0, gemini.ErrResponseClosed
+	}
+	if !w.bodyAllowed {
+		return 0, &gemini.BodyNotAllowedError{Status: w.status}
+	}
+	if w.head {
+		return len(b), nil
+	}
+	if w.gemtext {
+		return w.buf.Write(b)
+	}
+	return w.w.Write(b)
+}
+
+// WriteHeader writes the HTTP equivalent of the provided Gemini status
+// code and meta.
+func (w *responseWriter) WriteHeader(status gemini.Status, meta string) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+
+	switch status.Class() {
+	case gemini.StatusClassSuccess:
+		w.bodyAllowed = true
+		if mediatype, _, err := mime.ParseMediaType(meta); err == nil && mediatype == "text/gemini" {
+			w.gemtext = true
+			meta = "text/html; charset=utf-8"
+		}
+		w.w.Header().Set("Content-Type", meta)
+		w.w.WriteHeader(http.StatusOK)
+	case gemini.StatusClassRedirect:
+		code := http.StatusFound
+		if status == gemini.StatusPermanentRedirect {
+			code = http.StatusMovedPermanently
+		}
+		w.w.Header().Set("Location", rewriteURL(meta, w.host))
+		w.w.WriteHeader(code)
+	default:
+		http.Error(w.w, fmt.Sprintf("%d %s", status, meta), httpStatus(status))
+	}
+}
+
+// Flush flushes the response to the client. The bodies of Gemini text
+// responses remain buffered until the response is closed.
+func (w *responseWriter) Flush() error {
+	if w.closed {
+		return nil
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(gemini.StatusTemporaryFailure, "Temporary failure")
+	}
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func (w *responseWriter) Written() bool {
+	return w.wroteHeader
+}
+
+// Close converts the body of Gemini text responses to HTML and flushes
+// the response. The HTTP response is completed when the handler returns.
+func (w *responseWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	if !w.wroteHeader {
+		w.WriteHeader(gemini.StatusTemporaryFailure, "Temporary failure")
+	}
+	w.closed = true
+	if w.gemtext && !w.head {
+		err := writeHTML(w.w, &w.buf, w.host)
+		w.buf.Reset()
+		if err != nil {
+			return err
+		}
+	}
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// httpStatus returns the HTTP status code corresponding to the provided
+// Gemini failure status code.
+func httpStatus(status gemini.Status) int {
+	switch status {
+	case gemini.StatusInput, gemini.StatusSensitiveInput:
+		// Input cannot be provided to a read-only mirror
+		return http.StatusNotImplemented
+	case gemini.StatusServerUnavailable:
+		return http.StatusServiceUnavailable
+	case gemini.StatusSlowDown:
+		return http.StatusTooManyRequests
+	case gemini.StatusNotFound:
+		return http.StatusNotFound
+	case gemini.StatusGone:
+		return http.StatusGone
+	case gemini.StatusProxyRequestRefused:
+		return http.StatusMisdirectedRequest
+	case gemini.StatusBadRequest:
+		return http.StatusBadRequest
+	}
+	switch status.Class() {
+	case gemini.StatusClassTemporaryFailure:
+		return http.StatusServiceUnavailable
+	case gemini.StatusClassCertificateRequired:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
+// rewriteURL rewrites absolute Gemini URLs for the mirrored host into
+// absolute paths, so that they refer to the mirror.
+// Other URLs are returned unchanged.
+func rewriteURL(rawurl, host string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "gemini" || u.Hostname() != host {
+		return rawurl
+	}
+	ref := &url.URL{
+		Path:     u.Path,
+		RawPath:  u.RawPath,
+		RawQuery: u.RawQuery,
+		Fragment: u.Fragment,
+	}
+	if ref.Path == "" {
+		ref.Path = "/"
+	}
+	return ref.String()
+}
+
+// writeHTML converts the Gemini text read from r into an HTML document
+// and writes it to w.
+func writeHTML(w io.Writer, r io.Reader, host string) error {
+	var out bytes.Buffer
+	err := gemhtml.Convert(&out, r, gemhtml.Options{
+		Document: true,
+		RewriteURL: func(url string) string {
+			return rewriteURL(url, host)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = out.WriteTo(w)
+	return err
+}
@@ -0,0 +1,116 @@
+package httpmirror
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+func serve(h gemini.Handler, method, target string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, target, nil)
+	(&Handler{Handler: h}).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerFlush(t *testing.T) {
+	h := gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		io.WriteString(w, "# Title\nsplit ")
+		w.Flush()
+		io.WriteString(w, "line\n```\n")
+		w.Flush()
+		io.WriteString(w, "# not a heading\n```\n=> gemini://example.com/page Page\n")
+	})
+	rec := serve(h, http.MethodGet, "http://example.com/")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Errorf("expected HTML content type, got %q", ct)
+	}
+	body := rec.Body.String()
+	if n := strings.Count(body, "<!DOCTYPE html>"); n != 1 {
+		t.Errorf("expected one HTML document, got %d in %q", n, body)
+	}
+	for _, want := range []string{
+		"<h1>Title</h1>",
+		"<p>split line</p>",
+		"<pre>\n# not a heading\n</pre>",
+		`<a href="/page">Page</a>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected body to contain %q, got %q", want, body)
+		}
+	}
+}
+
+func TestHandlerPassthrough(t *testing.T) {
+	h := gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		w.SetMediaType("text/plain")
+		io.WriteString(w, "# plain")
+		w.Flush()
+		io.WriteString(w, " text")
+	})
+	rec := serve(h, http.MethodGet, "http://example.com/file.txt")
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("expected content type %q, got %q", "text/plain", ct)
+	}
+	if rec.Body.String() != "# plain text" {
+		t.Errorf("expected body %q, got %q", "# plain text", rec.Body.String())
+	}
+}
+
+func TestHandlerHead(t *testing.T) {
+	h := gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+		io.WriteString(w, "# Title\n")
+	})
+	rec := serve(h, http.MethodHead, "http://example.com/")
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 {
+		t.Errorf("expected an empty %d response, got %d %q", http.StatusOK, rec.Code, rec.Body.String())
+	}
+
+	rec = serve(h, http.MethodPost, "http://example.com/")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
+
+func TestHandlerStatus(t *testing.T) {
+	tests := []struct {
+		Status   gemini.Status
+		Meta     string
+		Code     int
+		Location string
+	}{
+		{gemini.StatusRedirect, "gemini://example.com/new?q", http.StatusFound, "/new?q"},
+		{gemini.StatusPermanentRedirect, "gemini://other.example/", http.StatusMovedPermanently, "gemini://other.example/"},
+		{gemini.StatusNotFound, "Not found", http.StatusNotFound, ""},
+		{gemini.StatusInput, "Query", http.StatusNotImplemented, ""},
+		{gemini.StatusCGIError, "CGI error", http.StatusServiceUnavailable, ""},
+		{gemini.StatusCertificateRequired, "Certificate required", http.StatusForbidden, ""},
+		{gemini.StatusPermanentFailure, "Failure", http.StatusInternalServerError, ""},
+	}
+	for _, test := range tests {
+		h := gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+			w.WriteHeader(test.Status, test.Meta)
+		})
+		rec := serve(h, http.MethodGet, "http://example.com/old")
+		if rec.Code != test.Code {
+			t.Errorf("%d %s: expected status %d, got %d", test.Status, test.Meta, test.Code, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != test.Location {
+			t.Errorf("%d %s: expected location %q, got %q", test.Status, test.Meta, test.Location, got)
+		}
+	}
+
+	// Handlers that do not respond produce a temporary failure
+	rec := serve(gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {}), http.MethodGet, "http://example.com/")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
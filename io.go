@@ -3,8 +3,25 @@ package gemini
 import (
 	"context"
 	"io"
+	"sync"
 )
 
+// copyBufPool is a pool of buffers used by copyBody.
+var copyBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 32*1024)
+		return &b
+	},
+}
+
+// copyBody copies from src to w like io.Copy, but uses a pooled buffer
+// if neither w implements io.ReaderFrom nor src implements io.WriterTo.
+func copyBody(w io.Writer, src io.Reader) (int64, error) {
+	buf := copyBufPool.Get().(*[]byte)
+	defer copyBufPool.Put(buf)
+	return io.CopyBuffer(w, src, *buf)
+}
+
 type contextReader struct {
 	ctx    context.Context
 	done   <-chan struct{}
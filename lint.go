@@ -0,0 +1,115 @@
+package gemini
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPreformattedWidth is the width in characters after which
+// preformatted lines are reported by Lint.
+const maxPreformattedWidth = 80
+
+// LintWarning describes a potential problem in Gemini text.
+type LintWarning struct {
+	// Line is the line number of the problem, starting at 1.
+	Line int
+
+	// Message describes the problem.
+	Message string
+}
+
+// String formats the warning as "line {line}: {message}".
+func (w LintWarning) String() string {
+	return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+}
+
+// Lint checks the provided Gemini text for common problems and returns
+// a warning for each problem found. It reports:
+//
+//   - links with empty or invalid URLs
+//   - links whose URL appears to contain an unescaped space
+//   - headings that skip a level, such as a third-level heading
+//     directly following a first-level heading
+//   - lines with trailing whitespace
+//   - preformatted lines wider than 80 characters
+//   - preformatted blocks that are never closed
+func Lint(t Text) []LintWarning {
+	var warnings []LintWarning
+	warn := func(line int, format string, args ...interface{}) {
+		warnings = append(warnings, LintWarning{
+			Line:    line,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	var heading int // level of the last heading
+	var pre int     // line number of the opening toggle, or 0
+	for i, line := range t {
+		n := i + 1
+		switch line := line.(type) {
+		case LineLink:
+			lintLink(line, func(msg string) { warn(n, "%s", msg) })
+		case LinePreformattingToggle:
+			if pre == 0 {
+				pre = n
+			} else {
+				pre = 0
+			}
+		case LinePreformattedText:
+			if utf8.RuneCountInString(string(line)) > maxPreformattedWidth {
+				warn(n, "preformatted line is wider than %d characters", maxPreformattedWidth)
+			}
+			continue
+		case LineHeading1, LineHeading2, LineHeading3:
+			level := headingLevel(line)
+			if heading != 0 && level > heading+1 {
+				warn(n, "heading level skips from %d to %d", heading, level)
+			}
+			heading = level
+		}
+		if s := line.String(); strings.TrimRight(s, " \t") != s {
+			warn(n, "line has trailing whitespace")
+		}
+	}
+	if pre != 0 {
+		warn(pre, "preformatted block is never closed")
+	}
+	return warnings
+}
+
+func lintLink(link LineLink, warn func(string)) {
+	if link.URL == "" {
+		warn("link has an empty URL")
+		return
+	}
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		warn("link has an invalid URL")
+		return
+	}
+	// A relative URL without a file extension followed by a name
+	// starting with what looks like a file name suggests that the
+	// URL contained an unescaped space.
+	if u.Scheme == "" && path.Ext(u.Path) == "" && link.Name != "" {
+		word := strings.Fields(link.Name)[0]
+		if ext := path.Ext(word); ext != "" && mime.TypeByExtension(ext) != "" {
+			warn("link URL may contain an unescaped space")
+		}
+	}
+}
+
+func headingLevel(line Line) int {
+	switch line.(type) {
+	case LineHeading1:
+		return 1
+	case LineHeading2:
+		return 2
+	case LineHeading3:
+		return 3
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package gemini
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	text := "# Title\n" +
+		"### Skipped\n" +
+		"=> my page.gmi My page\n" +
+		"=> /valid.gmi Valid\n" +
+		"Trailing space \n" +
+		"```\n" +
+		strings.Repeat("x", 81) + "\n"
+
+	doc, err := ParseText(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []LintWarning{
+		{2, "heading level skips from 1 to 3"},
+		{3, "link URL may contain an unescaped space"},
+		{5, "line has trailing whitespace"},
+		{7, "preformatted line is wider than 80 characters"},
+		{6, "preformatted block is never closed"},
+	}
+	if got := Lint(doc); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected warnings %v, got %v", want, got)
+	}
+}
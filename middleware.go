@@ -2,23 +2,199 @@ package gemini
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/url"
+	"time"
 )
 
+// A Middleware wraps a Handler, returning a Handler that usually calls
+// the wrapped Handler after or before performing some processing.
+type Middleware func(Handler) Handler
+
 // LoggingMiddleware returns a handler that wraps h and logs Gemini requests
 // and their responses to the log package's standard logger.
-// Requests are logged with the format "gemini: {host} {URL} {status code} {bytes written}".
+// Requests are logged with the format
+// "gemini: {host} {remote address} {URL} {status code} {meta} {bytes written} {duration}".
+//
+// To customize the output or format of the log, use LoggingMiddlewareFunc.
 func LoggingMiddleware(h Handler) Handler {
+	return LoggingMiddlewareFunc(h, func(entry LogEntry) {
+		log.Printf("gemini: %s", entry)
+	})
+}
+
+// LoggingMiddlewareFunc returns a handler that wraps h and calls f with
+// a LogEntry describing each Gemini request and its response once the
+// response has been written.
+func LoggingMiddlewareFunc(h Handler, f func(LogEntry)) Handler {
 	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		start := time.Now()
 		lw := &logResponseWriter{rw: w}
 		h.ServeGemini(ctx, lw, r)
-		host := r.ServerName()
-		log.Printf("gemini: %s %q %d %d", host, r.URL, lw.Status, lw.Wrote)
+		if !lw.wroteHeader {
+			// Record the header that would be sent for the
+			// empty response
+			lw.WriteHeader(lw.emptyHeader())
+		}
+		entry := LogEntry{
+			Time:     start,
+			Host:     r.ServerName(),
+			URL:      r.URL,
+			Status:   lw.Status,
+			Meta:     lw.Meta,
+			Wrote:    lw.Wrote,
+			Duration: time.Since(start),
+		}
+		if conn := r.Conn(); conn != nil {
+			entry.RemoteAddr = conn.RemoteAddr()
+		}
+		f(entry)
+	})
+}
+
+// LogEntry describes a Gemini request and its response.
+// It is used by LoggingMiddlewareFunc.
+type LogEntry struct {
+	// Time is the time at which the request was received.
+	Time time.Time
+
+	// Host is the server name requested by the client.
+	Host string
+
+	// RemoteAddr is the network address of the client.
+	// It is nil if the address is unknown.
+	RemoteAddr net.Addr
+
+	// URL is the requested URL.
+	URL *url.URL
+
+	// Status and Meta are the response status code and meta.
+	Status Status
+	Meta   string
+
+	// Wrote is the number of bytes written, including the response header.
+	Wrote int
+
+	// Duration is the time taken to serve the request.
+	Duration time.Duration
+}
+
+// String formats the entry in the format
+// "{host} {remote address} {URL} {status code} {meta} {bytes written} {duration}".
+func (e LogEntry) String() string {
+	remote := "-"
+	if e.RemoteAddr != nil {
+		remote = e.RemoteAddr.String()
+	}
+	return fmt.Sprintf("%s %s %q %d %q %d %v", e.Host, remote, e.URL, e.Status, e.Meta, e.Wrote, e.Duration)
+}
+
+// contextKey is a value for use with context.WithValue. It's used as
+// a pointer so it fits in an interface{} without allocation.
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string {
+	return "gemini context value " + k.name
+}
+
+// requestIDContextKey is the context key for the request ID.
+var requestIDContextKey = &contextKey{"request-id"}
+
+// RequestIDMiddleware returns a handler that wraps h and assigns a unique
+// ID to each request. The ID is stored in the context provided to h and
+// can be retrieved with RequestIDFromContext. If the context already
+// contains a request ID, it is kept.
+func RequestIDMiddleware(h Handler) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		if RequestIDFromContext(ctx) == "" {
+			ctx = context.WithValue(ctx, requestIDContextKey, newRequestID())
+		}
+		h.ServeGemini(ctx, w, r)
+	})
+}
+
+// RequestIDFromContext returns the request ID stored in ctx by
+// RequestIDMiddleware. It returns the empty string if ctx contains
+// no request ID.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey).(string)
+	return id
+}
+
+// newRequestID returns a new random request ID.
+func newRequestID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("gemini: failed to generate request ID: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+var (
+	// certificateContextKey is the context key for the client
+	// certificate verified by RequireCertificate.
+	certificateContextKey = &contextKey{"client-certificate"}
+
+	// fingerprintContextKey is the context key for the fingerprint
+	// of the client certificate verified by RequireCertificate.
+	fingerprintContextKey = &contextKey{"client-certificate-fingerprint"}
+)
+
+// RequireCertificate returns a handler that wraps h and only serves
+// requests made with a client certificate. Requests without a client
+// certificate are answered with "60 Certificate required". If authorize
+// is not nil, it is called with the client certificate, and requests for
+// which it returns false are answered with "61 Certificate not authorized".
+//
+// The client certificate and its fingerprint are stored in the context
+// provided to h and can be retrieved with CertificateFromContext and
+// FingerprintFromContext.
+func RequireCertificate(h Handler, authorize func(*x509.Certificate) bool) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		tls := r.TLS()
+		if tls == nil || len(tls.PeerCertificates) == 0 {
+			CertificateRequired(w)
+			return
+		}
+		cert := tls.PeerCertificates[0]
+		if authorize != nil && !authorize(cert) {
+			CertificateNotAuthorized(w)
+			return
+		}
+		ctx = context.WithValue(ctx, certificateContextKey, cert)
+		ctx = context.WithValue(ctx, fingerprintContextKey, Fingerprint(cert))
+		h.ServeGemini(ctx, w, r)
 	})
 }
 
+// CertificateFromContext returns the client certificate stored in ctx
+// by RequireCertificate, or nil if ctx contains no certificate.
+func CertificateFromContext(ctx context.Context) *x509.Certificate {
+	cert, _ := ctx.Value(certificateContextKey).(*x509.Certificate)
+	return cert
+}
+
+// FingerprintFromContext returns the fingerprint of the client
+// certificate stored in ctx by RequireCertificate, or the empty string
+// if ctx contains no certificate. The fingerprint is computed with
+// Fingerprint.
+func FingerprintFromContext(ctx context.Context) string {
+	fp, _ := ctx.Value(fingerprintContextKey).(string)
+	return fp
+}
+
 type logResponseWriter struct {
 	Status      Status
+	Meta        string
 	Wrote       int
 	rw          ResponseWriter
 	mediatype   string
@@ -43,16 +219,70 @@ func (w *logResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// ReadFrom implements io.ReaderFrom so that copies to the wrapped
+// ResponseWriter can use its ReadFrom method, if any.
+func (w *logResponseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		meta := w.mediatype
+		if meta == "" {
+			// Use default media type
+			meta = defaultMediaType
+		}
+		w.WriteHeader(StatusSuccess, meta)
+	}
+	n, err := copyBody(w.rw, r)
+	w.Wrote += int(n)
+	return n, err
+}
+
 func (w *logResponseWriter) WriteHeader(status Status, meta string) {
 	if w.wroteHeader {
 		return
 	}
 	w.wroteHeader = true
 	w.Status = status
+	w.Meta = meta
 	w.Wrote += len(meta) + 5
 	w.rw.WriteHeader(status, meta)
 }
 
 func (w *logResponseWriter) Flush() error {
-	return nil
+	if !w.wroteHeader {
+		w.WriteHeader(w.emptyHeader())
+	}
+	return w.rw.Flush()
+}
+
+func (w *logResponseWriter) Close() error {
+	if !w.wroteHeader {
+		w.WriteHeader(w.emptyHeader())
+	}
+	return w.rw.Close()
+}
+
+// emptyHeader returns the header that the wrapped ResponseWriter sends
+// for a response without one.
+func (w *logResponseWriter) emptyHeader() (Status, string) {
+	if e, ok := w.rw.(interface{ emptyHeader() (Status, string) }); ok {
+		return e.emptyHeader()
+	}
+	return StatusTemporaryFailure, "Temporary failure"
+}
+
+// Hijack implements the Hijacker interface if the wrapped ResponseWriter
+// does. Otherwise, it returns an error.
+func (w *logResponseWriter) Hijack() (net.Conn, error) {
+	h, ok := w.rw.(Hijacker)
+	if !ok {
+		return nil, errors.New("gemini: connection cannot be hijacked")
+	}
+	conn, err := h.Hijack()
+	if err == nil {
+		w.wroteHeader = true
+	}
+	return conn, err
+}
+
+func (w *logResponseWriter) Written() bool {
+	return w.wroteHeader
 }
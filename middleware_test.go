@@ -0,0 +1,186 @@
+package gemini
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
+)
+
+func TestLoggingMiddlewareFunc(t *testing.T) {
+	tests := []struct {
+		Handler HandlerFunc
+		Status  Status
+		Meta    string
+		Wrote   int
+	}{
+		{func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.Write([]byte("hello"))
+		}, StatusSuccess, "text/gemini", 21},
+		{func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.WriteHeader(StatusNotFound, "Not found")
+		}, StatusNotFound, "Not found", 14},
+		{func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.Close()
+		}, StatusTemporaryFailure, "Temporary failure", 22},
+		{func(ctx context.Context, w ResponseWriter, r *Request) {}, StatusTemporaryFailure, "Temporary failure", 22},
+	}
+	for i, test := range tests {
+		var entry LogEntry
+		h := LoggingMiddlewareFunc(test.Handler, func(e LogEntry) {
+			entry = e
+		})
+		w := serveFS(t, h, "gemini://example.com/")
+		if entry.Status != test.Status || entry.Meta != test.Meta || entry.Wrote != test.Wrote {
+			t.Errorf("#%d: expected %d %q with %d bytes, got %d %q with %d bytes",
+				i, test.Status, test.Meta, test.Wrote, entry.Status, entry.Meta, entry.Wrote)
+		}
+		if w.Status != entry.Status || w.Meta != entry.Meta {
+			t.Errorf("#%d: logged %d %q, but sent %d %q", i, entry.Status, entry.Meta, w.Status, w.Meta)
+		}
+		if entry.URL.String() != "gemini://example.com/" {
+			t.Errorf("#%d: expected URL %q, got %q", i, "gemini://example.com/", entry.URL)
+		}
+	}
+}
+
+func TestLoggingMiddlewareEmptyResponse(t *testing.T) {
+	// Empty responses are logged with the header sent by the server
+	entries := make(chan LogEntry, 1)
+	srv := &Server{
+		Handler: LoggingMiddlewareFunc(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {}), func(e LogEntry) {
+			entries <- e
+		}),
+		EmptyResponseStatus: StatusNotFound,
+	}
+	client, server := net.Pipe()
+	resp := make(chan []byte, 1)
+	go func() {
+		client.Write([]byte("gemini://example.com/\r\n"))
+		b, _ := ioutil.ReadAll(client)
+		client.Close()
+		resp <- b
+	}()
+	srv.ServeConn(context.Background(), server)
+	got := string(<-resp)
+	if want := "51 Not found\r\n"; got != want {
+		t.Errorf("expected response %q, got %q", want, got)
+	}
+	entry := <-entries
+	if entry.Status != StatusNotFound || entry.Meta != "Not found" || entry.Wrote != len(got) {
+		t.Errorf("expected entry for %q, got %d %q with %d bytes", got, entry.Status, entry.Meta, entry.Wrote)
+	}
+	if entry.RemoteAddr == nil {
+		t.Error("expected the remote address to be logged")
+	}
+}
+
+func TestLogEntryString(t *testing.T) {
+	u, _ := url.Parse("gemini://example.com/path")
+	entry := LogEntry{
+		Host:     "example.com",
+		URL:      u,
+		Status:   StatusSuccess,
+		Meta:     "text/gemini",
+		Wrote:    21,
+		Duration: 3 * time.Millisecond,
+	}
+	const want = `example.com - "gemini://example.com/path" 20 "text/gemini" 21 3ms`
+	if got := entry.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	entry.RemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1965}
+	const wantRemote = `example.com 192.0.2.1:1965 "gemini://example.com/path" 20 "text/gemini" 21 3ms`
+	if got := entry.String(); got != wantRemote {
+		t.Errorf("expected %q, got %q", wantRemote, got)
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var ids []string
+	h := RequestIDMiddleware(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		ids = append(ids, RequestIDFromContext(ctx))
+	}))
+
+	req, err := NewRequest("gemini://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.ServeGemini(context.Background(), &nopResponseWriter{}, req)
+	h.ServeGemini(context.Background(), &nopResponseWriter{}, req)
+	if len(ids) != 2 || ids[0] == "" || ids[1] == "" || ids[0] == ids[1] {
+		t.Errorf("expected two unique request IDs, got %q", ids)
+	}
+
+	ctx := context.WithValue(context.Background(), requestIDContextKey, "upstream")
+	h.ServeGemini(ctx, &nopResponseWriter{}, req)
+	if ids[2] != "upstream" {
+		t.Errorf("expected existing request ID to be kept, got %q", ids[2])
+	}
+}
+
+func TestRequireCertificate(t *testing.T) {
+	cert, err := certificate.Create(certificate.CreateOptions{
+		Subject:  pkix.Name{CommonName: "user"},
+		Duration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotCert *x509.Certificate
+	var gotFingerprint string
+	h := RequireCertificate(HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		gotCert = CertificateFromContext(ctx)
+		gotFingerprint = FingerprintFromContext(ctx)
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	}), func(cert *x509.Certificate) bool {
+		return cert.Subject.CommonName == "user"
+	})
+
+	req, err := NewRequest("gemini://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := &recorder{}
+	h.ServeGemini(context.Background(), rw, req)
+	if rw.Status != StatusCertificateRequired {
+		t.Errorf("expected status %d without certificate, got %d", StatusCertificateRequired, rw.Status)
+	}
+
+	req.tls = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{leaf}}
+	rw = &recorder{}
+	h.ServeGemini(context.Background(), rw, req)
+	if rw.Status != StatusSuccess {
+		t.Errorf("expected status %d with certificate, got %d", StatusSuccess, rw.Status)
+	}
+	if gotCert != leaf {
+		t.Errorf("expected certificate to be stored in context")
+	}
+	sum := sha256.Sum256(leaf.Raw)
+	if want := hex.EncodeToString(sum[:]); gotFingerprint != want {
+		t.Errorf("expected fingerprint %q, got %q", want, gotFingerprint)
+	}
+
+	other := *leaf
+	other.Subject.CommonName = "other"
+	req.tls = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{&other}}
+	rw = &recorder{}
+	h.ServeGemini(context.Background(), rw, req)
+	if rw.Status != StatusCertificateNotAuthorized {
+		t.Errorf("expected status %d for unauthorized certificate, got %d", StatusCertificateNotAuthorized, rw.Status)
+	}
+}
@@ -9,9 +9,12 @@ import (
 	"net"
 	"net/url"
 	"path"
+	"regexp"
 	"sort"
 	"strings"
 	"sync"
+
+	"golang.org/x/net/idna"
 )
 
 // Mux is a Gemini request multiplexer.
@@ -33,15 +36,38 @@ import (
 // patterns, not just the URL with Path == "/".
 //
 // Patterns may optionally begin with a host name, restricting matches to
-// URLs on that host only. Host-specific patterns take precedence over
+// URLs on that host only. IPv6 addresses are written in brackets, as in
+// "[::1]/path". Host-specific patterns take precedence over
 // general patterns, so that a handler might register for the two patterns
 // "/search" and "search.example.com/" without also taking over requests
 // for "gemini://example.com/".
+// This can be changed by setting Precedence to PrecedencePath.
+//
+// Hostnames are matched case-insensitively, and internationalized
+// hostnames are matched in their ASCII (punycode) form, so that the
+// pattern "bücher.example/" matches requests for "BÜCHER.example" and
+// "xn--bcher-kva.example".
 //
 // Wildcard patterns can be used to match multiple hostnames. For example,
 // the pattern "*.example.com" will match requests for "blog.example.com"
 // and "gemini.example.com", but not "example.org".
 //
+// Path segments consisting of a single "*" match any one non-empty path
+// segment. For example, the pattern "/users/*/avatar" matches
+// "/users/alice/avatar" but not "/users/avatar" or "/users/a/b/avatar",
+// and the pattern "/users/*/" names the subtrees of every user. The
+// values of the wildcard segments are stored in the context provided to
+// the handler and can be retrieved with MatchesFromContext.
+//
+// Patterns for the request host are always tried before patterns for
+// the wildcard host, which are tried before general patterns. Among the
+// patterns for a host, fixed paths take precedence over subtrees. If
+// several fixed paths or several subtrees match, the one with the most
+// segments wins, and if they have the same number of segments, the one
+// with a literal segment where the other has a wildcard wins. For
+// example, "/users/admin/avatar" takes precedence over "/users/*/avatar",
+// which takes precedence over "/users/".
+//
 // If a subtree has been registered and a request is received naming the
 // subtree root without its trailing slash, Mux redirects that
 // request to the subtree root (adding the trailing slash). This behavior can
@@ -50,15 +76,92 @@ import (
 // to redirect a request for "/images" to "/images/", unless "/images" has
 // been registered separately.
 //
+// Handlers can also be registered for regular expressions matching the
+// request path with HandleRegexp. Regexp patterns match requests for any
+// host. They take precedence over general subtree patterns, but not over
+// fixed general paths or host-specific patterns, and are tried in the
+// order in which they were registered. The submatches of the regexp are
+// stored in the context provided to the handler and can be retrieved
+// with MatchesFromContext.
+//
 // Mux also takes care of sanitizing the URL request path and
 // redirecting any request containing . or .. elements or repeated slashes
 // to an equivalent, cleaner URL.
+//
+// Both kinds of redirects can be disabled for servers that need exact
+// path semantics, by setting DisableSlashRedirect and DisableCleanPath.
+//
+// Titan upload requests are only dispatched to handlers registered with
+// HandleTitan, so that handlers registered with Handle, such as file
+// servers, never receive uploads. Titan patterns are matched like other
+// patterns, except that regexp patterns never match Titan requests and
+// Titan requests are never redirected, since the client would have to
+// send the upload again: requests naming a subtree root without its
+// trailing slash or a path that is not in canonical form are not found.
 type Mux struct {
-	mu sync.RWMutex
-	m  map[hostpath]Handler
-	es []muxEntry // slice of entries sorted from longest to shortest
+	// DisableSlashRedirect disables the redirects of requests naming
+	// a subtree root without its trailing slash.
+	DisableSlashRedirect bool
+
+	// DisableCleanPath disables the redirects of requests for paths that
+	// are not in canonical form. Such requests are matched against the
+	// registered patterns using the request path as is, except that an
+	// empty path is matched as "/".
+	DisableCleanPath bool
+
+	// AllowReplace allows Handle and HandleRegexp to replace the handler
+	// of a pattern that has already been registered. If false, they panic
+	// when a pattern is registered more than once.
+	AllowReplace bool
+
+	// MatchPorts makes patterns that include a port, such as
+	// "example.com:1966/" or ":1966/", match only requests for URLs with
+	// that port, so that the same Mux can serve different content on
+	// different listeners. URLs without a port are considered to have
+	// the default port 1965. Patterns without a port match requests for
+	// any port, but patterns with a matching port take precedence.
+	//
+	// If MatchPorts is false, the port of patterns is ignored.
+	// MatchPorts must be set before registering any patterns.
+	MatchPorts bool
+
+	// Precedence determines which pattern is used when patterns for
+	// different hosts match a request. See MuxPrecedence.
+	Precedence MuxPrecedence
+
+	mu    sync.RWMutex
+	m     map[hostpath]Handler
+	trees map[string]*muxNode // trees of subtrees and wildcard paths by host
+	ws    []muxEntry          // entries with wildcard segments
+	rs    []regexpEntry
+
+	mws      []Middleware
+	notFound Handler
 }
 
+// MuxPrecedence determines the precedence of Mux patterns for different
+// hosts that match the same request.
+type MuxPrecedence int
+
+const (
+	// PrecedenceHost gives precedence to host-specific patterns: patterns
+	// for the request host are tried first, then patterns for its
+	// wildcard, and then general patterns. For example, if "example.com/"
+	// and "/docs/" are registered, a request for
+	// "gemini://example.com/docs/" is handled by "example.com/".
+	// This is the default.
+	PrecedenceHost MuxPrecedence = iota
+
+	// PrecedencePath gives precedence to the pattern that most closely
+	// matches the path, regardless of its host: fixed paths are tried
+	// first, then regexp patterns, and then the subtree with the most
+	// segments wins. The host is only used to break ties, as for
+	// PrecedenceHost. For example, if "example.com/" and "/docs/" are
+	// registered, a request for "gemini://example.com/docs/" is handled
+	// by "/docs/".
+	PrecedencePath
+)
+
 type hostpath struct {
 	host string
 	path string
@@ -68,6 +171,38 @@ type muxEntry struct {
 	handler Handler
 	host    string
 	path    string
+	segs    []string // path segments of entries with wildcard segments
+}
+
+type regexpEntry struct {
+	handler Handler
+	re      *regexp.Regexp
+}
+
+// titanHostPrefix is prepended to the hosts of Titan patterns, so that
+// they are stored in the same tables as other patterns without ever
+// matching Gemini requests.
+const titanHostPrefix = "titan:"
+
+// matchesContextKey is the context key for the submatches of
+// the regexp pattern that matched a request.
+var matchesContextKey = &contextKey{"mux-matches"}
+
+// MatchesFromContext returns the submatches of the regexp pattern or the
+// pattern with wildcard segments that matched the request path.
+//
+// For regexp patterns, the submatches are as returned by
+// regexp.Regexp.FindStringSubmatch: the first element is the text of the
+// match, and the following elements are the texts of the capture groups.
+// For patterns with wildcard segments, the first element is the matched
+// path, which is a prefix of the request path for subtrees, and the
+// following elements are the values of the wildcard segments.
+//
+// It returns nil if ctx does not come from a request matched by such
+// a pattern.
+func MatchesFromContext(ctx context.Context) []string {
+	matches, _ := ctx.Value(matchesContextKey).([]string)
+	return matches
 }
 
 // cleanPath returns the canonical path for p, eliminating . and .. elements.
@@ -95,31 +230,232 @@ func cleanPath(p string) string {
 // Find a handler on a handler map given a path string.
 // Most-specific (longest) pattern wins.
 func (mux *Mux) match(host, path string) Handler {
+	if h := mux.matchFixed(host, path); h != nil {
+		return h
+	}
+	return mux.matchSubtree(host, path)
+}
+
+// matchFixed returns the handler for the fixed path pattern
+// matching the path, if any.
+func (mux *Mux) matchFixed(host, path string) Handler {
 	// Check for exact match first.
 	if h, ok := mux.m[hostpath{host, path}]; ok {
 		return h
 	}
+	root := mux.trees[host]
+	if root == nil || !root.hasFixed {
+		return nil
+	}
+	e, values := root.lookupFixed(splitSegments(path), nil)
+	if e == nil {
+		return nil
+	}
+	return withMatches(e.handler, append([]string{path}, values...))
+}
+
+// matchSubtree returns the handler for the most specific subtree
+// pattern matching the path, if any.
+func (mux *Mux) matchSubtree(host, path string) Handler {
+	h, _ := mux.matchSubtreeDepth(host, path)
+	return h
+}
+
+// matchSubtreeDepth is like matchSubtree, but also returns the number of
+// segments of the matching subtree pattern.
+func (mux *Mux) matchSubtreeDepth(host, path string) (Handler, int) {
+	root := mux.trees[host]
+	if root == nil {
+		return nil, 0
+	}
+	segs := splitSegments(path)
+	var best subtreeMatch
+	root.lookupSubtree(segs, 0, nil, &best)
+	if best.entry == nil {
+		return nil, 0
+	}
+	if best.entry.segs == nil {
+		// Literal subtree
+		return best.entry.handler, best.depth
+	}
+	prefix := "/"
+	if best.depth > 0 {
+		prefix = "/" + strings.Join(segs[:best.depth], "/") + "/"
+	}
+	return withMatches(best.entry.handler, append([]string{prefix}, best.values...)), best.depth
+}
+
+// splitSegments returns the segments of the path, without the leading
+// slash. The path "/" has a single empty segment.
+func splitSegments(path string) []string {
+	return strings.Split(path[1:], "/")
+}
+
+// A muxNode is a node of a tree of path segments. Each Mux has a tree for
+// each host, containing its subtree patterns and fixed path patterns with
+// wildcard segments, so that matching a request takes time proportional
+// to the number of segments of the request path rather than the number
+// of registered patterns. Fixed paths without wildcard segments are
+// matched with the map of the Mux.
+type muxNode struct {
+	children map[string]*muxNode
+	wildcard *muxNode  // child for "*" segments
+	fixed    *muxEntry // fixed path ending at this node
+	subtree  *muxEntry // subtree rooted at this node
+
+	// hasFixed is set at the root once a fixed path
+	// has been added to the tree.
+	hasFixed bool
+}
+
+// insert adds the entry to the tree.
+func (n *muxNode) insert(e *muxEntry) {
+	segs := splitSegments(e.path)
+	subtree := segs[len(segs)-1] == ""
+	if subtree {
+		segs = segs[:len(segs)-1]
+	}
+	for _, seg := range segs {
+		n = n.child(seg)
+	}
+	if subtree {
+		n.subtree = e
+	} else {
+		n.fixed = e
+	}
+}
+
+// child returns the child of the node for the segment, creating it
+// if necessary.
+func (n *muxNode) child(seg string) *muxNode {
+	if seg == "*" {
+		if n.wildcard == nil {
+			n.wildcard = &muxNode{}
+		}
+		return n.wildcard
+	}
+	c := n.children[seg]
+	if c == nil {
+		if n.children == nil {
+			n.children = make(map[string]*muxNode)
+		}
+		c = &muxNode{}
+		n.children[seg] = c
+	}
+	return c
+}
+
+// remove removes the entry for the path from the tree, pruning nodes
+// that become empty, and reports whether n itself is now empty.
+func (n *muxNode) remove(segs []string, subtree bool) bool {
+	if len(segs) == 0 {
+		if subtree {
+			n.subtree = nil
+		} else {
+			n.fixed = nil
+		}
+	} else if segs[0] == "*" {
+		if n.wildcard != nil && n.wildcard.remove(segs[1:], subtree) {
+			n.wildcard = nil
+		}
+	} else if c := n.children[segs[0]]; c != nil && c.remove(segs[1:], subtree) {
+		delete(n.children, segs[0])
+	}
+	return n.fixed == nil && n.subtree == nil && n.wildcard == nil && len(n.children) == 0
+}
+
+// lookupFixed returns the entry for the fixed path matching the segments,
+// and the values of its wildcard segments. Literal segments are preferred
+// over wildcards.
+func (n *muxNode) lookupFixed(segs, values []string) (*muxEntry, []string) {
+	if len(segs) == 0 {
+		return n.fixed, values
+	}
+	if c := n.children[segs[0]]; c != nil {
+		if e, v := c.lookupFixed(segs[1:], values); e != nil {
+			return e, v
+		}
+	}
+	if n.wildcard != nil && segs[0] != "" {
+		return n.wildcard.lookupFixed(segs[1:], append(values, segs[0]))
+	}
+	return nil, nil
+}
+
+type subtreeMatch struct {
+	entry  *muxEntry
+	depth  int
+	values []string
+}
 
-	// Check for longest valid match.  mux.es contains all patterns
-	// that end in / sorted from longest to shortest.
-	for _, e := range mux.es {
-		if len(e.host) == len(host) && e.host == host &&
-			strings.HasPrefix(path, e.path) {
-			return e.handler
+// lookupSubtree finds the deepest subtree matching the segments, below
+// the given depth. Literal segments are tried before wildcards, so that
+// among subtrees of the same depth, the one with a literal segment where
+// the others have a wildcard is found first.
+func (n *muxNode) lookupSubtree(segs []string, depth int, values []string, best *subtreeMatch) {
+	// A subtree matches paths with at least one more segment,
+	// which may be empty.
+	if depth < len(segs) && n.subtree != nil && (best.entry == nil || depth > best.depth) {
+		best.entry = n.subtree
+		best.depth = depth
+		best.values = append([]string(nil), values...)
+	}
+	if depth >= len(segs)-1 {
+		return
+	}
+	if c := n.children[segs[depth]]; c != nil {
+		c.lookupSubtree(segs, depth+1, values, best)
+	}
+	if n.wildcard != nil && segs[depth] != "" {
+		n.wildcard.lookupSubtree(segs, depth+1, append(values, segs[depth]), best)
+	}
+}
+
+// hasWildcardSegment reports whether the path contains a "*" segment.
+func hasWildcardSegment(path string) bool {
+	for _, seg := range strings.Split(path, "/") {
+		if seg == "*" {
+			return true
 		}
 	}
+	return false
+}
+
+func isSubtree(path string) bool {
+	return path[len(path)-1] == '/'
+}
+
+// withMatches returns a handler that stores the matches in the request
+// context before calling h.
+func withMatches(h Handler, matches []string) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		h.ServeGemini(context.WithValue(ctx, matchesContextKey, matches), w, r)
+	})
+}
+
+// matchRegexp returns a handler for the first regexp pattern that matches
+// the path. The handler stores the submatches in the request context.
+func (mux *Mux) matchRegexp(path string) Handler {
+	for _, e := range mux.rs {
+		matches := e.re.FindStringSubmatch(path)
+		if matches == nil {
+			continue
+		}
+		return withMatches(e.handler, matches)
+	}
 	return nil
 }
 
-// redirectToPathSlash determines if the given path needs appending "/" to it.
+// redirectToPathSlashLocked determines if the given path needs appending "/" to it.
 // This occurs when a handler for path + "/" was already registered, but
 // not for path itself. If the path needs appending to, it creates a new
 // URL, setting the path to u.Path + "/" and returning true to indicate so.
-func (mux *Mux) redirectToPathSlash(host, path string, u *url.URL) (*url.URL, bool) {
-	mux.mu.RLock()
-	shouldRedirect := mux.shouldRedirectRLocked(host, path)
-	mux.mu.RUnlock()
-	if !shouldRedirect {
+// mux.mu must be held for reading.
+func (mux *Mux) redirectToPathSlashLocked(host, path string, u *url.URL) (*url.URL, bool) {
+	if mux.DisableSlashRedirect {
+		return u, false
+	}
+	if !mux.shouldRedirectRLocked(host, path) {
 		return u, false
 	}
 	return u.ResolveReference(&url.URL{Path: path + "/"}), true
@@ -145,7 +481,9 @@ func (mux *Mux) shouldRedirectRLocked(host, path string) bool {
 }
 
 func getWildcard(hostname string) (string, bool) {
-	if net.ParseIP(hostname) == nil {
+	// IP addresses, including IPv6 addresses with zones,
+	// have no wildcards
+	if net.ParseIP(hostname) == nil && !strings.Contains(hostname, ":") {
 		split := strings.SplitN(hostname, ".", 2)
 		if len(split) == 2 {
 			return "*." + split[1], true
@@ -155,82 +493,431 @@ func getWildcard(hostname string) (string, bool) {
 }
 
 // Handler returns the handler to use for the given request, consulting
-// r.URL.Scheme, r.URL.Host, and r.URL.Path. It always returns a non-nil handler. If
+// r.URL.Scheme, r.URL.Host, and r.URL.Path. It always returns a non-nil handler.
+// If no pattern matches, the handler set with NotFound is returned. If
 // the path is not in its canonical form, the handler will be an
 // internally-generated handler that redirects to the canonical path. If the
-// host contains a port, it is ignored when matching handlers.
+// host contains a port, it is ignored when matching handlers unless
+// MatchPorts is set.
+// Requests with the "titan" scheme are matched against the patterns
+// registered with HandleTitan. Requests with other schemes than "gemini"
+// and "titan" are not found.
 func (mux *Mux) Handler(r *Request) Handler {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
 	// Disallow non-Gemini schemes
-	if r.URL.Scheme != "gemini" {
-		return NotFoundHandler()
+	titan := r.URL.Scheme == "titan"
+	if r.URL.Scheme != "gemini" && !titan {
+		return mux.notFoundHandler()
 	}
 
-	host := r.URL.Hostname()
-	path := cleanPath(r.URL.Path)
+	hosts := mux.candidateHosts(r.URL)
+	path := r.URL.Path
+	if !mux.DisableCleanPath {
+		path = cleanPath(path)
+	} else if path == "" {
+		path = "/"
+	}
+
+	if titan {
+		if path != r.URL.Path && !mux.DisableCleanPath {
+			return mux.notFoundHandler()
+		}
+		return mux.matchTitan(hosts, path)
+	}
 
 	// If the given path is /tree and its handler is not registered,
 	// redirect for /tree/.
-	if u, ok := mux.redirectToPathSlash(host, path, r.URL); ok {
+	if u, ok := mux.redirectToPathSlashLocked(hosts[0], path, r.URL); ok {
 		return StatusHandler(StatusPermanentRedirect, u.String())
 	}
 
-	if path != r.URL.Path {
+	if path != r.URL.Path && !mux.DisableCleanPath {
 		u := *r.URL
 		u.Path = path
 		return StatusHandler(StatusPermanentRedirect, u.String())
 	}
 
-	mux.mu.RLock()
-	defer mux.mu.RUnlock()
+	if mux.Precedence == PrecedencePath {
+		return mux.matchByPath(hosts, path, r.URL)
+	}
 
-	h := mux.match(host, path)
+	for i, host := range hosts {
+		if i > 0 {
+			if u, ok := mux.redirectToPathSlashLocked(host, path, r.URL); ok {
+				return StatusHandler(StatusPermanentRedirect, u.String())
+			}
+		}
+		if host != "" {
+			if h := mux.match(host, path); h != nil {
+				return h
+			}
+			continue
+		}
+		// Regexp patterns take precedence over general subtrees
+		h := mux.matchFixed("", path)
+		if h == nil {
+			h = mux.matchRegexp(path)
+		}
+		if h == nil {
+			h = mux.matchSubtree("", path)
+		}
+		if h != nil {
+			return h
+		}
+	}
+	return mux.notFoundHandler()
+}
 
-	if h == nil {
-		// Try wildcard
-		if wildcard, ok := getWildcard(host); ok {
-			if u, ok := mux.redirectToPathSlash(wildcard, path, r.URL); ok {
+// matchByPath returns the handler for the pattern that most closely
+// matches the path, using the order of hosts to break ties.
+// It implements PrecedencePath. mux.mu must be held for reading.
+func (mux *Mux) matchByPath(hosts []string, path string, u *url.URL) Handler {
+	for i, host := range hosts {
+		if i > 0 {
+			if u, ok := mux.redirectToPathSlashLocked(host, path, u); ok {
 				return StatusHandler(StatusPermanentRedirect, u.String())
 			}
-			h = mux.match(wildcard, path)
 		}
+		if h := mux.matchFixed(host, path); h != nil {
+			return h
+		}
+	}
+	if h := mux.matchRegexp(path); h != nil {
+		return h
+	}
+	if h := mux.matchDeepestSubtree(hosts, path); h != nil {
+		return h
 	}
+	return mux.notFoundHandler()
+}
 
-	if h == nil {
-		// Try empty host
-		if u, ok := mux.redirectToPathSlash("", path, r.URL); ok {
-			return StatusHandler(StatusPermanentRedirect, u.String())
+// matchDeepestSubtree returns the handler for the subtree pattern with
+// the most segments matching the path, using the order of hosts to
+// break ties. mux.mu must be held for reading.
+func (mux *Mux) matchDeepestSubtree(hosts []string, path string) Handler {
+	var best Handler
+	bestDepth := -1
+	for _, host := range hosts {
+		if h, depth := mux.matchSubtreeDepth(host, path); h != nil && depth > bestDepth {
+			best, bestDepth = h, depth
 		}
-		h = mux.match("", path)
 	}
+	return best
+}
 
-	if h == nil {
-		h = NotFoundHandler()
+// matchTitan returns the handler for the Titan pattern matching the path,
+// trying the hosts in order. It follows the precedence of the Mux, but
+// never redirects. mux.mu must be held for reading.
+func (mux *Mux) matchTitan(hosts []string, path string) Handler {
+	titanHosts := make([]string, len(hosts))
+	for i, host := range hosts {
+		titanHosts[i] = titanHostPrefix + host
+	}
+	if mux.Precedence == PrecedencePath {
+		for _, host := range titanHosts {
+			if h := mux.matchFixed(host, path); h != nil {
+				return h
+			}
+		}
+		if h := mux.matchDeepestSubtree(titanHosts, path); h != nil {
+			return h
+		}
+		return mux.notFoundHandler()
+	}
+	for _, host := range titanHosts {
+		if h := mux.match(host, path); h != nil {
+			return h
+		}
 	}
+	return mux.notFoundHandler()
+}
 
-	return h
+// candidateHosts returns the hosts of the patterns that may match the
+// URL, in order of precedence: the URL host, its wildcard, and the empty
+// host of general patterns. If MatchPorts is set, each host is preceded
+// by the host with the URL port.
+func (mux *Mux) candidateHosts(u *url.URL) []string {
+	host := normalizeHost(u.Hostname())
+	hosts := []string{host}
+	if wildcard, ok := getWildcard(host); ok {
+		hosts = append(hosts, wildcard)
+	}
+	hosts = append(hosts, "")
+	if !mux.MatchPorts {
+		return hosts
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "1965"
+	}
+	withPorts := make([]string, 0, 2*len(hosts))
+	for _, host := range hosts {
+		withPorts = append(withPorts, net.JoinHostPort(host, port), host)
+	}
+	return withPorts
+}
+
+// NotFound sets the handler used for requests that do not match any
+// registered pattern, such as a handler rendering a Gemini text page
+// describing the error or redirecting the client. If h is nil,
+// NotFoundHandler is used, which is the default.
+func (mux *Mux) NotFound(h Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.notFound = h
+}
+
+func (mux *Mux) notFoundHandler() Handler {
+	if mux.notFound != nil {
+		return mux.notFound
+	}
+	return NotFoundHandler()
 }
 
 // ServeGemini dispatches the request to the handler whose
-// pattern most closely matches the request URL.
+// pattern most closely matches the request URL, wrapped with the
+// middleware added with Use.
 func (mux *Mux) ServeGemini(ctx context.Context, w ResponseWriter, r *Request) {
 	h := mux.Handler(r)
+	mux.mu.RLock()
+	h = chain(h, mux.mws)
+	mux.mu.RUnlock()
 	h.ServeGemini(ctx, w, r)
 }
 
-// Handle registers the handler for the given pattern.
-// If a handler already exists for pattern, Handle panics.
-func (mux *Mux) Handle(pattern string, handler Handler) {
+// Use appends middleware to the Mux. The middleware wraps the handler
+// for every request served by the Mux, including requests for which no
+// handler is found and requests that are redirected, the first
+// middleware being the outermost.
+func (mux *Mux) Use(mws ...Middleware) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.mws = append(mux.mws, mws...)
+}
+
+// chain wraps h with the middleware, the first middleware being
+// the outermost.
+func chain(h Handler, mws []Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// Handle registers the handler for the given pattern. If middleware is
+// provided, the handler is wrapped with it, the first middleware being
+// the outermost.
+// If a handler already exists for pattern, Handle replaces it if
+// AllowReplace is true, and panics otherwise.
+//
+// Handle may be called concurrently with serving requests, so that
+// routes can be added and removed at runtime. See also Unhandle.
+//
+// Handlers registered with Handle do not receive Titan upload requests.
+// See HandleTitan.
+func (mux *Mux) Handle(pattern string, handler Handler, mws ...Middleware) {
+	mux.handle(pattern, "", handler, mws)
+}
+
+// HandleTitan registers the handler for Titan upload requests matching
+// the given pattern, which is interpreted as by Handle. Titan requests
+// are only dispatched to handlers registered with HandleTitan, and the
+// handlers registered with HandleTitan only receive Titan requests.
+func (mux *Mux) HandleTitan(pattern string, handler Handler, mws ...Middleware) {
+	mux.handle(pattern, titanHostPrefix, handler, mws)
+}
+
+// HandleTitanFunc registers the handler function for Titan upload
+// requests matching the given pattern. See HandleTitan for details.
+func (mux *Mux) HandleTitanFunc(pattern string, handler HandlerFunc, mws ...Middleware) {
+	mux.HandleTitan(pattern, handler, mws...)
+}
+
+// handle registers the handler for the pattern, prepending hostPrefix to
+// the host of the pattern.
+func (mux *Mux) handle(pattern, hostPrefix string, handler Handler, mws []Middleware) {
 	if pattern == "" {
 		panic("gemini: invalid pattern")
 	}
 	if handler == nil {
 		panic("gemini: nil handler")
 	}
+	handler = chain(handler, mws)
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	host, path := mux.splitPattern(pattern)
+	host = hostPrefix + host
+	if mux.removeLocked(host, path) && !mux.AllowReplace {
+		panic("gemini: multiple registrations for " + pattern)
+	}
+
+	e := &muxEntry{handler: handler, host: host, path: path}
+	if hasWildcardSegment(path) {
+		e.segs = strings.Split(path, "/")
+		mux.ws = append(mux.ws, *e)
+	} else {
+		if mux.m == nil {
+			mux.m = make(map[hostpath]Handler)
+		}
+		mux.m[hostpath{host, path}] = handler
+		if !isSubtree(path) {
+			// Fixed paths are matched with the map only
+			return
+		}
+	}
+
+	if mux.trees == nil {
+		mux.trees = make(map[string]*muxNode)
+	}
+	root := mux.trees[host]
+	if root == nil {
+		root = &muxNode{}
+		mux.trees[host] = root
+	}
+	root.insert(e)
+	if !isSubtree(path) {
+		root.hasFixed = true
+	}
+}
+
+// HandleRegexp registers the handler for request paths matching the
+// regular expression pattern. The expression is matched against the
+// cleaned request path, and is not anchored unless it begins with "^".
+// HandleRegexp panics if the expression cannot be compiled, or if a
+// handler already exists for it and AllowReplace is false.
+//
+// For example, the following registers a handler for yearly archives:
+//
+//	mux.HandleRegexp(`^/archive/(\d{4})/$`, archive)
+//
+// The year can then be retrieved by the handler with MatchesFromContext.
+func (mux *Mux) HandleRegexp(pattern string, handler Handler) {
+	if handler == nil {
+		panic("gemini: nil handler")
+	}
+	re := regexp.MustCompile(pattern)
+
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+
+	for i, e := range mux.rs {
+		if e.re.String() == pattern {
+			if !mux.AllowReplace {
+				panic("gemini: multiple registrations for " + pattern)
+			}
+			// Keep the position of the replaced expression
+			mux.rs[i].handler = handler
+			return
+		}
+	}
+	mux.rs = append(mux.rs, regexpEntry{handler, re})
+}
+
+// Unhandle removes the handler registered for the given pattern with
+// Handle, and reports whether there was one. The pattern is interpreted
+// as by Handle.
+func (mux *Mux) Unhandle(pattern string) bool {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	host, path := mux.splitPattern(pattern)
+	return mux.removeLocked(host, path)
+}
+
+// UnhandleTitan removes the handler registered for the given pattern with
+// HandleTitan, and reports whether there was one.
+func (mux *Mux) UnhandleTitan(pattern string) bool {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	host, path := mux.splitPattern(pattern)
+	return mux.removeLocked(titanHostPrefix+host, path)
+}
 
+// UnhandleRegexp removes the handler registered for the regular
+// expression pattern with HandleRegexp, and reports whether there was one.
+func (mux *Mux) UnhandleRegexp(pattern string) bool {
 	mux.mu.Lock()
 	defer mux.mu.Unlock()
+	for i, e := range mux.rs {
+		if e.re.String() == pattern {
+			mux.rs = append(mux.rs[:i], mux.rs[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
 
-	var host, path string
+// removeLocked removes the entry for the host and path, if any,
+// and reports whether there was one.
+func (mux *Mux) removeLocked(host, path string) bool {
+	if hasWildcardSegment(path) {
+		found := false
+		for i, e := range mux.ws {
+			if e.host == host && e.path == path {
+				mux.ws = append(mux.ws[:i], mux.ws[i+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	} else {
+		if _, exist := mux.m[hostpath{host, path}]; !exist {
+			return false
+		}
+		delete(mux.m, hostpath{host, path})
+		if !isSubtree(path) {
+			return true
+		}
+	}
+
+	if root := mux.trees[host]; root != nil {
+		segs := splitSegments(path)
+		if isSubtree(path) {
+			segs = segs[:len(segs)-1]
+		}
+		if root.remove(segs, isSubtree(path)) {
+			delete(mux.trees, host)
+		}
+	}
+	return true
+}
+
+// splitPattern splits the pattern into a host and a path. The port,
+// if any, is removed from the host unless MatchPorts is set.
+func (mux *Mux) splitPattern(pattern string) (host, path string) {
+	host, port, path := splitPattern(pattern)
+	host = normalizeHost(host)
+	if mux.MatchPorts && port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	return host, path
+}
+
+// normalizeHost returns the lowercase ASCII form of the hostname, which
+// may be a wildcard. Hostnames that cannot be converted to ASCII are
+// only converted to lowercase.
+func normalizeHost(host string) string {
+	if isASCII(host) {
+		return strings.ToLower(host)
+	}
+	prefix := ""
+	if strings.HasPrefix(host, "*.") {
+		prefix, host = "*.", host[2:]
+	}
+	if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+		return prefix + ascii
+	}
+	return prefix + strings.ToLower(host)
+}
+
+// splitPattern splits the pattern into a hostname, a port and a path.
+func splitPattern(pattern string) (host, port, path string) {
 	// extract hostname and path
 	cut := strings.Index(pattern, "/")
 	if cut == -1 {
@@ -242,40 +929,148 @@ func (mux *Mux) Handle(pattern string, handler Handler) {
 	}
 
 	// strip port from hostname
-	if hostname, _, err := net.SplitHostPort(host); err == nil {
-		host = hostname
+	if hostname, p, err := net.SplitHostPort(host); err == nil {
+		host, port = hostname, p
+	} else if len(host) > 1 && host[0] == '[' && host[len(host)-1] == ']' {
+		// IPv6 literal without port
+		host = host[1 : len(host)-1]
 	}
+	return host, port, path
+}
 
-	if _, exist := mux.m[hostpath{host, path}]; exist {
-		panic("gemini: multiple registrations for " + pattern)
+// Hosts returns the hostnames of the registered patterns, sorted in
+// lexical order. Patterns that do not begin with a hostname are ignored.
+func (mux *Mux) Hosts() []string {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var hosts []string
+	add := func(host string) {
+		host = strings.TrimPrefix(host, titanHostPrefix)
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if host == "" || seen[host] {
+			return
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	for hp := range mux.m {
+		add(hp.host)
 	}
+	for _, e := range mux.ws {
+		add(e.host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Patterns returns the registered patterns, sorted in lexical order.
+// Ports are not included in the returned patterns unless MatchPorts is set.
+// Regexp patterns are included as they were registered, and patterns
+// registered with HandleTitan are prefixed with "titan://".
+func (mux *Mux) Patterns() []string {
+	mux.mu.RLock()
+	defer mux.mu.RUnlock()
 
-	if mux.m == nil {
-		mux.m = make(map[hostpath]Handler)
+	patterns := make([]string, 0, len(mux.m)+len(mux.ws)+len(mux.rs))
+	for hp := range mux.m {
+		patterns = append(patterns, joinHostPath(hp.host, hp.path))
+	}
+	for _, e := range mux.ws {
+		patterns = append(patterns, joinHostPath(e.host, e.path))
 	}
-	mux.m[hostpath{host, path}] = handler
-	e := muxEntry{handler, host, path}
-	if path[len(path)-1] == '/' {
-		mux.es = appendSorted(mux.es, e)
+	for _, e := range mux.rs {
+		patterns = append(patterns, e.re.String())
 	}
+	sort.Strings(patterns)
+	return patterns
 }
 
-func appendSorted(es []muxEntry, e muxEntry) []muxEntry {
-	n := len(es)
-	i := sort.Search(n, func(i int) bool {
-		return len(es[i].path) < len(e.path)
-	})
-	if i == n {
-		return append(es, e)
+// joinHostPath returns the pattern for the host and path of an entry.
+func joinHostPath(host, path string) string {
+	if strings.HasPrefix(host, titanHostPrefix) {
+		return "titan://" + strings.TrimPrefix(host, titanHostPrefix) + path
 	}
-	// we now know that i points at where we want to insert
-	es = append(es, muxEntry{}) // try to grow the slice in place, any entry works.
-	copy(es[i+1:], es[i:])      // move shorter entries down
-	es[i] = e
-	return es
+	return host + path
 }
 
 // HandleFunc registers the handler function for the given pattern.
-func (mux *Mux) HandleFunc(pattern string, handler HandlerFunc) {
-	mux.Handle(pattern, handler)
+// See Handle for details.
+func (mux *Mux) HandleFunc(pattern string, handler HandlerFunc, mws ...Middleware) {
+	mux.Handle(pattern, handler, mws...)
+}
+
+// Group returns a MuxGroup that registers handlers with mux for patterns
+// beginning with prefix. The prefix may begin with a host name, so that
+// groups can be scoped to a host:
+//
+//	blog := mux.Group("example.com/blog")
+//	blog.HandleFunc("/", index)     // registers "example.com/blog/"
+//	blog.HandleFunc("/feed", feed)  // registers "example.com/blog/feed"
+func (mux *Mux) Group(prefix string) *MuxGroup {
+	return &MuxGroup{mux: mux, prefix: prefix}
+}
+
+// A MuxGroup registers handlers with a Mux for patterns sharing a common
+// prefix, optionally wrapping them with middleware. The handlers are
+// registered in the table of the Mux, as if they had been registered
+// with Mux.Handle.
+type MuxGroup struct {
+	mux    *Mux
+	prefix string
+	mws    []Middleware
+}
+
+// Group returns a MuxGroup for patterns beginning with the prefix of g
+// followed by prefix. The returned group uses the middleware of g,
+// followed by any middleware added to it with Use.
+func (g *MuxGroup) Group(prefix string) *MuxGroup {
+	mws := make([]Middleware, len(g.mws))
+	copy(mws, g.mws)
+	return &MuxGroup{mux: g.mux, prefix: joinPattern(g.prefix, prefix), mws: mws}
+}
+
+// Use appends middleware to the group. Handlers registered with the
+// group are wrapped with its middleware, the first middleware being the
+// outermost. Use affects only handlers registered after it is called.
+func (g *MuxGroup) Use(mws ...Middleware) {
+	g.mws = append(g.mws, mws...)
+}
+
+// Handle registers the handler for the prefix of g followed by pattern.
+// The handler is wrapped with the middleware of the group, followed by
+// the provided middleware.
+// If a handler already exists for the resulting pattern, Handle replaces
+// it if the AllowReplace field of the Mux is true, and panics otherwise.
+func (g *MuxGroup) Handle(pattern string, handler Handler, mws ...Middleware) {
+	if handler == nil {
+		panic("gemini: nil handler")
+	}
+	handler = chain(chain(handler, mws), g.mws)
+	g.mux.Handle(joinPattern(g.prefix, pattern), handler)
+}
+
+// HandleFunc registers the handler function for the prefix of g
+// followed by pattern. See Handle for details.
+func (g *MuxGroup) HandleFunc(pattern string, handler HandlerFunc, mws ...Middleware) {
+	g.Handle(pattern, handler, mws...)
+}
+
+// joinPattern joins a group prefix and a pattern, avoiding a repeated
+// slash between them.
+func joinPattern(prefix, pattern string) string {
+	if strings.HasSuffix(prefix, "/") && strings.HasPrefix(pattern, "/") {
+		pattern = pattern[1:]
+	}
+	return prefix + pattern
+}
+
+// HandleStatus registers a handler for the given pattern that responds
+// to each request with the provided status code and meta.
+// See StatusHandler.
+func (mux *Mux) HandleStatus(pattern string, status Status, meta string) {
+	mux.Handle(pattern, StatusHandler(status, meta))
 }
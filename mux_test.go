@@ -2,8 +2,11 @@ package gemini
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/url"
+	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -24,6 +27,8 @@ func (w *nopResponseWriter) WriteHeader(status Status, meta string) {
 func (nopResponseWriter) SetMediaType(mediatype string) {}
 func (nopResponseWriter) Write(b []byte) (int, error)   { return 0, io.EOF }
 func (nopResponseWriter) Flush() error                  { return nil }
+func (w *nopResponseWriter) Written() bool              { return w.Status != 0 }
+func (nopResponseWriter) Close() error                  { return nil }
 
 func TestMux(t *testing.T) {
 	type Test struct {
@@ -354,3 +359,602 @@ func TestMuxMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestMuxHosts(t *testing.T) {
+	var mux Mux
+	mux.Handle("/", &nopHandler{})
+	mux.Handle("example.org/", &nopHandler{})
+	mux.Handle("example.com:1965/", &nopHandler{})
+	mux.Handle("example.com/path", &nopHandler{})
+
+	got := mux.Hosts()
+	want := []string{"example.com", "example.org"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected hosts %v, got %v", want, got)
+	}
+}
+
+func TestMuxRegexp(t *testing.T) {
+	var matches []string
+	archive := HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		matches = MatchesFromContext(ctx)
+		w.WriteHeader(StatusSuccess, "archive")
+	})
+
+	var mux Mux
+	mux.HandleStatus("/", StatusSuccess, "root")
+	mux.HandleStatus("/archive/latest/", StatusSuccess, "latest")
+	mux.HandleStatus("/archive/2020/", StatusSuccess, "fixed")
+	mux.HandleStatus("example.com/archive/", StatusSuccess, "host")
+	mux.HandleRegexp(`^/archive/(\d{4})/`, archive)
+
+	tests := []struct {
+		URL     string
+		Meta    string
+		Matches []string
+	}{
+		{"gemini://example.org/archive/2021/", "archive", []string{"/archive/2021/", "2021"}},
+		{"gemini://example.org/archive/2021/01/post.gmi", "archive", []string{"/archive/2021/", "2021"}},
+		{"gemini://example.org/archive/2020/", "fixed", nil},
+		{"gemini://example.org/archive/latest/", "latest", nil},
+		{"gemini://example.org/archive/abc/", "root", nil},
+		{"gemini://example.com/archive/2021/", "host", nil},
+	}
+	for _, test := range tests {
+		matches = nil
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		if w.Meta != test.Meta {
+			t.Errorf("%s: expected %q, got %q", test.URL, test.Meta, w.Meta)
+		}
+		if !reflect.DeepEqual(matches, test.Matches) {
+			t.Errorf("%s: expected matches %q, got %q", test.URL, test.Matches, matches)
+		}
+	}
+}
+
+func TestMuxWildcardSegments(t *testing.T) {
+	var matches []string
+	handler := func(meta string) Handler {
+		return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			matches = MatchesFromContext(ctx)
+			w.WriteHeader(StatusSuccess, meta)
+		})
+	}
+
+	var mux Mux
+	mux.Handle("/", handler("root"))
+	mux.Handle("/users/", handler("users"))
+	mux.Handle("/users/admin/avatar", handler("admin avatar"))
+	mux.Handle("/users/*/avatar", handler("avatar"))
+	mux.Handle("/users/*/", handler("user"))
+	mux.Handle("/users/bob/", handler("bob"))
+	mux.Handle("/*/*/avatar", handler("any avatar"))
+	mux.Handle("example.com/users/*/avatar", handler("host avatar"))
+	mux.Handle("*.example.org/users/*/avatar", handler("wildcard host avatar"))
+
+	tests := []struct {
+		URL     string
+		Meta    string
+		Matches []string
+	}{
+		{"gemini://example.net/users/alice/avatar", "avatar", []string{"/users/alice/avatar", "alice"}},
+		{"gemini://example.net/users/admin/avatar", "admin avatar", nil},
+		{"gemini://example.net/groups/staff/avatar", "any avatar", []string{"/groups/staff/avatar", "groups", "staff"}},
+		{"gemini://example.net/users/alice/posts/1", "user", []string{"/users/alice/", "alice"}},
+		{"gemini://example.net/users/alice/", "user", []string{"/users/alice/", "alice"}},
+		{"gemini://example.net/users/bob/avatar", "avatar", []string{"/users/bob/avatar", "bob"}},
+		{"gemini://example.net/users/bob/posts", "bob", nil},
+		{"gemini://example.net/users/", "users", nil},
+		{"gemini://example.net/users/a/b/avatar", "user", []string{"/users/a/", "a"}},
+		{"gemini://example.net/avatar", "root", nil},
+		{"gemini://example.com/users/alice/avatar", "host avatar", []string{"/users/alice/avatar", "alice"}},
+		{"gemini://www.example.org/users/alice/avatar", "wildcard host avatar", []string{"/users/alice/avatar", "alice"}},
+	}
+	for _, test := range tests {
+		matches = nil
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		if w.Meta != test.Meta {
+			t.Errorf("%s: expected %q, got %q", test.URL, test.Meta, w.Meta)
+		}
+		if !reflect.DeepEqual(matches, test.Matches) {
+			t.Errorf("%s: expected matches %q, got %q", test.URL, test.Matches, matches)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected duplicate registration to panic")
+		}
+	}()
+	mux.Handle("/users/*/avatar", handler("duplicate"))
+}
+
+func TestMuxGroup(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+				calls = append(calls, name)
+				h.ServeGemini(ctx, w, r)
+			})
+		}
+	}
+
+	var mux Mux
+	mux.HandleStatus("/", StatusSuccess, "root")
+	blog := mux.Group("example.com/blog/")
+	blog.Use(mw("blog"))
+	blog.Handle("/", StatusHandler(StatusSuccess, "index"))
+	admin := blog.Group("/admin")
+	admin.Use(mw("admin"))
+	admin.Handle("/posts", StatusHandler(StatusSuccess, "posts"))
+
+	tests := []struct {
+		URL   string
+		Meta  string
+		Calls []string
+	}{
+		{"gemini://example.com/blog/", "index", []string{"blog"}},
+		{"gemini://example.com/blog/admin/posts", "posts", []string{"blog", "admin"}},
+		{"gemini://example.org/blog/", "root", nil},
+	}
+	for _, test := range tests {
+		calls = nil
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		if w.Meta != test.Meta {
+			t.Errorf("%s: expected %q, got %q", test.URL, test.Meta, w.Meta)
+		}
+		if !reflect.DeepEqual(calls, test.Calls) {
+			t.Errorf("%s: expected middleware calls %q, got %q", test.URL, test.Calls, calls)
+		}
+	}
+
+	want := []string{"/", "example.com/blog/", "example.com/blog/admin/posts"}
+	if got := mux.Patterns(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected patterns %q, got %q", want, got)
+	}
+}
+
+func TestMuxUse(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return func(h Handler) Handler {
+			return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+				calls = append(calls, name)
+				h.ServeGemini(ctx, w, r)
+			})
+		}
+	}
+
+	var mux Mux
+	mux.Use(mw("first"), mw("second"))
+	mux.HandleStatus("/", StatusSuccess, "root")
+	mux.Handle("/auth", StatusHandler(StatusSuccess, "auth"), mw("route"))
+	mux.HandleFunc("/func", func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusSuccess, "func")
+	}, mw("func"))
+
+	tests := []struct {
+		URL   string
+		Meta  string
+		Calls []string
+	}{
+		{"gemini://example.com/", "root", []string{"first", "second"}},
+		{"gemini://example.com/auth", "auth", []string{"first", "second", "route"}},
+		{"gemini://example.com/func", "func", []string{"first", "second", "func"}},
+		{"http://example.com/", "Not found", []string{"first", "second"}},
+	}
+	for _, test := range tests {
+		calls = nil
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		if w.Meta != test.Meta {
+			t.Errorf("%s: expected %q, got %q", test.URL, test.Meta, w.Meta)
+		}
+		if !reflect.DeepEqual(calls, test.Calls) {
+			t.Errorf("%s: expected middleware calls %q, got %q", test.URL, test.Calls, calls)
+		}
+	}
+}
+
+func TestMuxNotFound(t *testing.T) {
+	var mux Mux
+	mux.HandleStatus("/exists", StatusSuccess, "exists")
+
+	request := func(rawurl string) *nopResponseWriter {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		return w
+	}
+
+	if w := request("gemini://example.com/missing"); w.Status != StatusNotFound || w.Meta != "Not found" {
+		t.Errorf("expected default not found response, got %d %s", w.Status, w.Meta)
+	}
+
+	mux.NotFound(StatusHandler(StatusRedirect, "/exists"))
+	for _, rawurl := range []string{"gemini://example.com/missing", "http://example.com/"} {
+		if w := request(rawurl); w.Status != StatusRedirect || w.Meta != "/exists" {
+			t.Errorf("%s: expected custom not found response, got %d %s", rawurl, w.Status, w.Meta)
+		}
+	}
+	if w := request("gemini://example.com/exists"); w.Meta != "exists" {
+		t.Errorf("expected registered handler, got %d %s", w.Status, w.Meta)
+	}
+}
+
+func TestMuxDisableRedirects(t *testing.T) {
+	mux := &Mux{
+		DisableSlashRedirect: true,
+		DisableCleanPath:     true,
+	}
+	mux.HandleStatus("/", StatusSuccess, "root")
+	mux.HandleStatus("/dir/", StatusSuccess, "dir")
+	mux.HandleStatus("/a//b", StatusSuccess, "raw")
+
+	tests := []struct {
+		URL  string
+		Meta string
+	}{
+		{"gemini://example.com", "root"},
+		{"gemini://example.com/dir", "root"},
+		{"gemini://example.com/dir/../x", "dir"},
+		{"gemini://example.com/a//b", "raw"},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		if w.Status != StatusSuccess || w.Meta != test.Meta {
+			t.Errorf("%s: expected %q, got %d %s", test.URL, test.Meta, w.Status, w.Meta)
+		}
+	}
+}
+
+func TestMuxUnhandle(t *testing.T) {
+	var mux Mux
+	mux.HandleStatus("/", StatusSuccess, "root")
+	mux.HandleStatus("/dir/", StatusSuccess, "dir")
+	mux.HandleStatus("/users/*/", StatusSuccess, "user")
+	mux.HandleRegexp(`^/\d+$`, StatusHandler(StatusSuccess, "number"))
+
+	meta := func(rawurl string) string {
+		u, err := url.Parse(rawurl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		return w.Meta
+	}
+
+	for _, pattern := range []string{"/dir/", "/users/*/"} {
+		if !mux.Unhandle(pattern) {
+			t.Errorf("expected %q to be unregistered", pattern)
+		}
+		if mux.Unhandle(pattern) {
+			t.Errorf("expected %q to be unregistered only once", pattern)
+		}
+	}
+	if !mux.UnhandleRegexp(`^/\d+$`) {
+		t.Error("expected regexp to be unregistered")
+	}
+	for _, rawurl := range []string{"gemini://example.com/dir/file", "gemini://example.com/users/alice/", "gemini://example.com/123"} {
+		if got := meta(rawurl); got != "root" {
+			t.Errorf("%s: expected root handler, got %q", rawurl, got)
+		}
+	}
+	if got, want := mux.Patterns(), []string{"/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected patterns %q, got %q", want, got)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected duplicate registration to panic")
+			}
+		}()
+		mux.HandleStatus("/", StatusSuccess, "duplicate")
+	}()
+
+	mux.AllowReplace = true
+	mux.HandleStatus("/", StatusSuccess, "replaced")
+	if got := meta("gemini://example.com/dir/file"); got != "replaced" {
+		t.Errorf("expected replaced handler, got %q", got)
+	}
+}
+
+func TestMuxConcurrentHandle(t *testing.T) {
+	mux := &Mux{AllowReplace: true}
+	mux.HandleStatus("example.com/dir/", StatusSuccess, "dir")
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			mux.HandleStatus(fmt.Sprintf("/p%d", i%10), StatusSuccess, "p")
+		}
+	}()
+
+	// Lookups for unregistered hosts consult the slash redirects of
+	// several hosts while Handle waits for the lock
+	for _, precedence := range []MuxPrecedence{PrecedenceHost, PrecedencePath} {
+		mux.mu.Lock()
+		mux.Precedence = precedence
+		mux.mu.Unlock()
+		for i := 0; i < 1000; i++ {
+			for _, rawurl := range []string{"gemini://unknown.example/dir", "gemini://example.com/dir"} {
+				u, err := url.Parse(rawurl)
+				if err != nil {
+					t.Fatal(err)
+				}
+				mux.Handler(&Request{URL: u})
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestMuxMatchPorts(t *testing.T) {
+	mux := &Mux{MatchPorts: true}
+	mux.HandleStatus("/", StatusSuccess, "any")
+	mux.HandleStatus(":1966/", StatusSuccess, "any:1966")
+	mux.HandleStatus("example.com/", StatusSuccess, "example.com")
+	mux.HandleStatus("example.com:1965/", StatusSuccess, "example.com:1965")
+	mux.HandleStatus("example.com:1967/", StatusSuccess, "example.com:1967")
+
+	tests := []struct {
+		URL  string
+		Meta string
+	}{
+		{"gemini://example.com/", "example.com:1965"},
+		{"gemini://example.com:1965/", "example.com:1965"},
+		{"gemini://example.com:1967/", "example.com:1967"},
+		{"gemini://example.com:1966/", "example.com"},
+		{"gemini://example.org:1966/", "any:1966"},
+		{"gemini://example.org/", "any"},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		if w.Meta != test.Meta {
+			t.Errorf("%s: expected %q, got %q", test.URL, test.Meta, w.Meta)
+		}
+	}
+
+	if got, want := mux.Hosts(), []string{"example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected hosts %q, got %q", want, got)
+	}
+}
+
+func TestMuxHostNormalization(t *testing.T) {
+	var mux Mux
+	mux.HandleStatus("Example.COM/", StatusSuccess, "example")
+	mux.HandleStatus("bücher.example/", StatusSuccess, "bücher")
+	mux.HandleStatus("*.Wildcard.example/", StatusSuccess, "wildcard")
+
+	tests := []struct {
+		URL  string
+		Meta string
+	}{
+		{"gemini://example.com/", "example"},
+		{"gemini://EXAMPLE.com/", "example"},
+		{"gemini://bücher.example/", "bücher"},
+		{"gemini://BÜCHER.example/", "bücher"},
+		{"gemini://xn--bcher-kva.example/", "bücher"},
+		{"gemini://www.WILDCARD.example/", "wildcard"},
+	}
+	for _, test := range tests {
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		if w.Meta != test.Meta {
+			t.Errorf("%s: expected %q, got %d %q", test.URL, test.Meta, w.Status, w.Meta)
+		}
+	}
+
+	want := []string{"*.wildcard.example", "example.com", "xn--bcher-kva.example"}
+	if got := mux.Hosts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected hosts %q, got %q", want, got)
+	}
+}
+
+func benchmarkMux(b *testing.B, routes int) {
+	var mux Mux
+	mux.Handle("/", &nopHandler{})
+	for i := 0; i < routes; i++ {
+		mux.Handle(fmt.Sprintf("/wiki/page%d/", i), &nopHandler{})
+		mux.Handle(fmt.Sprintf("/archive/%d/*/", i), &nopHandler{})
+	}
+	reqs := make([]*Request, 0, 64)
+	for i := 0; i < 64; i++ {
+		n := i * routes / 64
+		for _, path := range []string{
+			fmt.Sprintf("/wiki/page%d/index.gmi", n),
+			fmt.Sprintf("/archive/%d/01/post.gmi", n),
+			"/missing/page.gmi",
+		} {
+			reqs = append(reqs, &Request{URL: &url.URL{Scheme: "gemini", Host: "example.com", Path: path}})
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mux.Handler(reqs[i%len(reqs)])
+	}
+}
+
+func BenchmarkMux10(b *testing.B)   { benchmarkMux(b, 10) }
+func BenchmarkMux1000(b *testing.B) { benchmarkMux(b, 1000) }
+
+func TestMuxPrecedence(t *testing.T) {
+	tests := []struct {
+		Precedence MuxPrecedence
+		URL        string
+		Meta       string
+	}{
+		{PrecedenceHost, "gemini://example.com/docs/page", "host"},
+		{PrecedenceHost, "gemini://example.com/fixed", "host"},
+		{PrecedenceHost, "gemini://www.example.org/docs/page", "wildcard"},
+		{PrecedenceHost, "gemini://example.net/docs/page", "docs"},
+		{PrecedencePath, "gemini://example.com/docs/page", "docs"},
+		{PrecedencePath, "gemini://example.com/fixed", "fixed"},
+		{PrecedencePath, "gemini://example.com/other", "host"},
+		{PrecedencePath, "gemini://www.example.org/docs/page", "docs"},
+		{PrecedencePath, "gemini://www.example.org/docs/api/page", "wildcard api"},
+		{PrecedencePath, "gemini://example.com/", "host"},
+	}
+	for _, test := range tests {
+		mux := &Mux{Precedence: test.Precedence}
+		mux.HandleStatus("/", StatusSuccess, "root")
+		mux.HandleStatus("/docs/", StatusSuccess, "docs")
+		mux.HandleStatus("/fixed", StatusSuccess, "fixed")
+		mux.HandleStatus("example.com/", StatusSuccess, "host")
+		mux.HandleStatus("*.example.org/", StatusSuccess, "wildcard")
+		mux.HandleStatus("*.example.org/docs/api/", StatusSuccess, "wildcard api")
+
+		u, err := url.Parse(test.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := &nopResponseWriter{}
+		mux.ServeGemini(context.Background(), w, &Request{URL: u})
+		if w.Meta != test.Meta {
+			t.Errorf("%d %s: expected %q, got %q", test.Precedence, test.URL, test.Meta, w.Meta)
+		}
+	}
+}
+
+func TestMuxIPv6(t *testing.T) {
+	for _, matchPorts := range []bool{false, true} {
+		mux := &Mux{MatchPorts: matchPorts}
+		mux.HandleStatus("/", StatusSuccess, "root")
+		mux.HandleStatus("[::1]/", StatusSuccess, "loopback")
+		mux.HandleStatus("[::1]:1966/path", StatusSuccess, "loopback path")
+		mux.HandleStatus("[2001:db8::1]/dir/", StatusSuccess, "dir")
+
+		tests := []struct {
+			URL        string
+			Meta       string
+			MatchPorts string
+		}{
+			{"gemini://[::1]/", "loopback", ""},
+			{"gemini://[::1]:1965/", "loopback", ""},
+			{"gemini://[::1]:1966/path", "loopback path", ""},
+			{"gemini://[::1]/path", "loopback path", "loopback"},
+			{"gemini://[2001:db8::1]/dir/file", "dir", ""},
+			{"gemini://[2001:db8::2]/dir/file", "root", ""},
+			{"gemini://[fe80::1%25eth0]/", "root", ""},
+		}
+		for _, test := range tests {
+			want := test.Meta
+			if matchPorts && test.MatchPorts != "" {
+				want = test.MatchPorts
+			}
+			u, err := url.Parse(test.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := &nopResponseWriter{}
+			mux.ServeGemini(context.Background(), w, &Request{URL: u})
+			if w.Meta != want {
+				t.Errorf("MatchPorts %t: %s: expected %q, got %q", matchPorts, test.URL, want, w.Meta)
+			}
+		}
+
+		if got, want := mux.Hosts(), []string{"2001:db8::1", "::1"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("MatchPorts %t: expected hosts %q, got %q", matchPorts, want, got)
+		}
+	}
+}
+
+func TestMuxTitan(t *testing.T) {
+	for _, precedence := range []MuxPrecedence{PrecedenceHost, PrecedencePath} {
+		mux := &Mux{Precedence: precedence}
+		mux.HandleStatus("/", StatusSuccess, "root")
+		mux.HandleStatus("/uploads/", StatusSuccess, "files")
+		mux.HandleRegexp(`^/uploads/\d+$`, StatusHandler(StatusSuccess, "number"))
+		mux.HandleTitan("/uploads/", StatusHandler(StatusSuccess, "upload"))
+		mux.HandleTitanFunc("example.com/uploads/avatar", func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.WriteHeader(StatusSuccess, "avatar")
+		})
+
+		tests := []struct {
+			URL    string
+			Status Status
+			Meta   string
+		}{
+			{"gemini://example.com/uploads/file", StatusSuccess, "files"},
+			{"gemini://example.com/uploads/42", StatusSuccess, "number"},
+			{"titan://example.com/uploads/file", StatusSuccess, "upload"},
+			{"titan://example.com/uploads/42", StatusSuccess, "upload"},
+			{"titan://example.com/uploads/avatar", StatusSuccess, "avatar"},
+			{"titan://example.org/uploads/avatar", StatusSuccess, "upload"},
+			{"titan://example.com/other", StatusNotFound, "Not found"},
+			{"titan://example.com/uploads", StatusNotFound, "Not found"},
+			{"titan://example.com/a/../uploads/file", StatusNotFound, "Not found"},
+		}
+		for _, test := range tests {
+			u, err := url.Parse(test.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := &nopResponseWriter{}
+			mux.ServeGemini(context.Background(), w, &Request{URL: u})
+			if w.Status != test.Status || w.Meta != test.Meta {
+				t.Errorf("%d %s: expected %d %s, got %d %s", precedence, test.URL, test.Status, test.Meta, w.Status, w.Meta)
+			}
+		}
+
+		want := []string{"/", "/uploads/", `^/uploads/\d+$`, "titan:///uploads/", "titan://example.com/uploads/avatar"}
+		if got := mux.Patterns(); !reflect.DeepEqual(got, want) {
+			t.Errorf("expected patterns %q, got %q", want, got)
+		}
+		if got, want := mux.Hosts(), []string{"example.com"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected hosts %v, got %v", want, got)
+		}
+		if mux.Unhandle("/uploads/avatar") || !mux.UnhandleTitan("example.com/uploads/avatar") {
+			t.Error("expected the Titan pattern to be unregistered with UnhandleTitan only")
+		}
+	}
+}
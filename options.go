@@ -0,0 +1,106 @@
+package gemini
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
+)
+
+// A ServerOption configures a Server created with NewServer.
+type ServerOption func(*Server)
+
+// NewServer returns a new Server configured with the provided options.
+// Options are applied in order. The returned Server may be further
+// configured by setting its fields before it is used.
+func NewServer(opts ...ServerOption) *Server {
+	srv := &Server{}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	return srv
+}
+
+// WithAddr sets the address for the server to listen on.
+// See Server.Addr.
+func WithAddr(addr string) ServerOption {
+	return func(srv *Server) {
+		srv.Addr = addr
+	}
+}
+
+// WithHandler sets the handler to invoke.
+// See Server.Handler.
+func WithHandler(h Handler) ServerOption {
+	return func(srv *Server) {
+		srv.Handler = h
+	}
+}
+
+// WithTimeouts sets the timeouts for reading requests and writing
+// responses. See Server.ReadTimeout and Server.WriteTimeout.
+func WithTimeouts(read, write time.Duration) ServerOption {
+	return func(srv *Server) {
+		srv.ReadTimeout = read
+		srv.WriteTimeout = write
+	}
+}
+
+// WithCertStore sets the certificate store used to retrieve TLS
+// certificates. See Server.Certificates.
+func WithCertStore(store *certificate.Store) ServerOption {
+	return func(srv *Server) {
+		srv.Certificates = store
+	}
+}
+
+// WithLogger sets the structured logger used for server events.
+// See Server.Logger.
+func WithLogger(logger Logger) ServerOption {
+	return func(srv *Server) {
+		srv.Logger = logger
+	}
+}
+
+// A ClientOption configures a Client created with NewClient.
+type ClientOption func(*Client)
+
+// NewClient returns a new Client configured with the provided options.
+// Options are applied in order. The returned Client may be further
+// configured by setting its fields before it is used.
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithTOFU sets the client to trust server certificates on first use,
+// using the provided known hosts, such as a *tofu.KnownHosts or
+// *tofu.PersistentHosts. See Client.TrustCertificate.
+func WithTOFU(hosts interface {
+	TOFU(hostname string, cert *x509.Certificate) error
+}) ClientOption {
+	return func(c *Client) {
+		c.TrustCertificate = hosts.TOFU
+	}
+}
+
+// WithDialContext sets the dial function for creating TCP connections.
+// See Client.DialContext.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) ClientOption {
+	return func(c *Client) {
+		c.DialContext = dial
+	}
+}
+
+// WithDecompress sets whether the client transparently decompresses
+// responses. See Client.Decompress.
+func WithDecompress(decompress bool) ClientOption {
+	return func(c *Client) {
+		c.Decompress = decompress
+	}
+}
@@ -0,0 +1,31 @@
+package gemini
+
+import (
+	"testing"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
+	"git.sr.ht/~adnano/go-gemini/tofu"
+)
+
+func TestNewServer(t *testing.T) {
+	store := &certificate.Store{}
+	h := &nopHandler{}
+	srv := NewServer(
+		WithAddr(":1966"),
+		WithHandler(h),
+		WithTimeouts(time.Second, 2*time.Second),
+		WithCertStore(store),
+	)
+	if srv.Addr != ":1966" || srv.Handler != h || srv.Certificates != store ||
+		srv.ReadTimeout != time.Second || srv.WriteTimeout != 2*time.Second {
+		t.Errorf("unexpected server configuration: %+v", srv)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	c := NewClient(WithTOFU(&tofu.KnownHosts{}), WithDecompress(true))
+	if c.TrustCertificate == nil || !c.Decompress {
+		t.Errorf("unexpected client configuration: %+v", c)
+	}
+}
@@ -0,0 +1,103 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"net/url"
+	"strings"
+)
+
+// ReverseProxy is a Handler that takes an incoming request and sends it
+// to another Gemini server, proxying the response back to the client.
+//
+// Redirects sent by the upstream server are passed to the client unchanged.
+type ReverseProxy struct {
+	// Director must be a function which modifies the request into a new
+	// request to be sent using Client. The URL of the request is a copy
+	// of the incoming request's URL and may be modified in place.
+	Director func(*Request)
+
+	// ClientCertificate optionally specifies a function that returns the
+	// TLS certificate to present to the upstream server for the incoming
+	// request r. It can be used to forward the identity of clients, for
+	// example by mapping client certificates to certificates known to the
+	// upstream server. If ClientCertificate is nil or returns nil, no
+	// certificate is presented.
+	ClientCertificate func(r *Request) *tls.Certificate
+
+	// Client is the client used to perform proxy requests.
+	// If nil, a zero Client is used, which accepts any certificate
+	// presented by the upstream server.
+	Client *Client
+
+	// ErrorLog specifies an optional logger for errors that occur when
+	// attempting to proxy the request.
+	// If nil, errors are not logged.
+	ErrorLog interface {
+		Printf(format string, v ...interface{})
+	}
+}
+
+// NewSingleHostReverseProxy returns a new ReverseProxy that routes
+// requests to the scheme and host provided in target. If the target's
+// path is "/base" and the incoming request was for "/dir", the target
+// request will be for "/base/dir".
+func NewSingleHostReverseProxy(target *url.URL) *ReverseProxy {
+	director := func(r *Request) {
+		r.URL.Scheme = target.Scheme
+		r.URL.Host = target.Host
+		r.URL.Path = singleJoiningSlash(target.Path, r.URL.Path)
+		r.URL.RawPath = ""
+		if target.RawQuery != "" && r.URL.RawQuery == "" {
+			r.URL.RawQuery = target.RawQuery
+		}
+	}
+	return &ReverseProxy{Director: director}
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash && a != "" && b != "":
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// ServeGemini proxies the request to the upstream server.
+func (p *ReverseProxy) ServeGemini(ctx context.Context, w ResponseWriter, r *Request) {
+	u := *r.URL
+	out := &Request{URL: &u}
+	if p.Director != nil {
+		p.Director(out)
+	}
+	if p.ClientCertificate != nil {
+		out.Certificate = p.ClientCertificate(r)
+	}
+
+	client := p.Client
+	if client == nil {
+		client = &Client{}
+	}
+	resp, err := client.Do(ctx, out)
+	if err != nil {
+		p.logf("gemini: proxy error: %v", err)
+		w.WriteHeader(StatusProxyError, "Proxy error")
+		return
+	}
+	defer resp.Body.Close()
+
+	w.WriteHeader(resp.Status, resp.Meta)
+	if _, err := copyBody(w, resp.Body); err != nil {
+		p.logf("gemini: proxy error copying response body: %v", err)
+	}
+}
+
+func (p *ReverseProxy) logf(format string, args ...interface{}) {
+	if p.ErrorLog != nil {
+		p.ErrorLog.Printf(format, args...)
+	}
+}
@@ -0,0 +1,59 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
+)
+
+func TestReverseProxy(t *testing.T) {
+	cert, err := certificate.Create(certificate.CreateOptions{
+		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		Duration:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			fmt.Fprint(w, r.URL.Path)
+		}),
+		GetCertificate: func(string) (*tls.Certificate, error) {
+			return &cert, nil
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go upstream.ServeTLS(context.Background(), l)
+	defer upstream.Close()
+
+	target := &url.URL{Scheme: "gemini", Host: l.Addr().String(), Path: "/base"}
+	proxy := NewSingleHostReverseProxy(target)
+
+	w := &recorder{}
+	req, _ := NewRequest("gemini://proxy.example/dir")
+	proxy.ServeGemini(context.Background(), w, req)
+	if w.Status != StatusSuccess || w.Body.String() != "/base/dir" {
+		t.Errorf("expected proxied response, got %d %q %q", w.Status, w.Meta, w.Body.String())
+	}
+
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2.Close()
+	proxy = NewSingleHostReverseProxy(&url.URL{Scheme: "gemini", Host: l2.Addr().String()})
+	w = &recorder{}
+	proxy.ServeGemini(context.Background(), w, req)
+	if w.Status != StatusProxyError {
+		t.Errorf("expected status %d, got %d", StatusProxyError, w.Status)
+	}
+}
@@ -0,0 +1,39 @@
+package gemini
+
+import "testing"
+
+func TestQueryEscape(t *testing.T) {
+	tests := []struct {
+		Query   string
+		Escaped string
+	}{
+		{"", ""},
+		{"hello world", "hello%20world"},
+		{"1+1=2", "1%2B1=2"},
+		{"a/b?c#d", "a%2Fb%3Fc%23d"},
+		{"100%", "100%25"},
+		{"héllo", "h%C3%A9llo"},
+	}
+	for _, test := range tests {
+		escaped := QueryEscape(test.Query)
+		if escaped != test.Escaped {
+			t.Errorf("QueryEscape(%q) = %q, want %q", test.Query, escaped, test.Escaped)
+		}
+		query, err := QueryUnescape(escaped)
+		if err != nil {
+			t.Errorf("QueryUnescape(%q): %v", escaped, err)
+		} else if query != test.Query {
+			t.Errorf("QueryUnescape(%q) = %q, want %q", escaped, query, test.Query)
+		}
+	}
+}
+
+func TestQueryUnescape(t *testing.T) {
+	// Plus signs do not represent spaces in Gemini queries
+	if query, err := QueryUnescape("a+b"); err != nil || query != "a+b" {
+		t.Errorf("QueryUnescape(%q) = %q, %v, want %q", "a+b", query, err, "a+b")
+	}
+	if _, err := QueryUnescape("%zz"); err == nil {
+		t.Errorf("QueryUnescape(%q): expected error", "%zz")
+	}
+}
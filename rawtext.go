@@ -0,0 +1,89 @@
+package gemini
+
+import (
+	"io"
+	"strings"
+)
+
+// RawLine is a line of Gemini text together with its original text.
+type RawLine struct {
+	// Line is the parsed line.
+	Line Line
+
+	// Raw is the original text of the line, including its line ending,
+	// if any. Raw preserves whitespace and line endings that are lost
+	// when parsing, such as the spacing between a link URL and its name,
+	// or between a preformatting toggle and its alt text.
+	//
+	// When a program modifies Line, it should set Raw to the empty string,
+	// so that the line is formatted with Line.String followed by a
+	// newline instead.
+	Raw string
+}
+
+// String returns the raw text of the line, or the formatted line
+// followed by a newline if Raw is empty.
+func (l RawLine) String() string {
+	if l.Raw == "" {
+		return l.Line.String() + "\n"
+	}
+	return l.Raw
+}
+
+// RawText is Gemini text parsed losslessly with ParseRawText, for use by
+// programs such as editors and diff tools that must reproduce their input
+// exactly.
+type RawText []RawLine
+
+// ParseRawText parses Gemini text from the provided io.Reader, keeping
+// the original text of each line, so that the String method of the result
+// reproduces the input byte for byte.
+// It is equivalent to ParseOptions{}.ParseRawText(r).
+func ParseRawText(r io.Reader) (RawText, error) {
+	return ParseOptions{}.ParseRawText(r)
+}
+
+// ParseRawText parses Gemini text losslessly like the ParseRawText
+// function, using the options. If an error occurs, it returns the lines
+// parsed so far along with the error.
+func (o ParseOptions) ParseRawText(r io.Reader) (RawText, error) {
+	var t RawText
+	tok := o.NewTokenizer(r)
+	for tok.Next() {
+		t = append(t, RawLine{
+			Line: tok.Line(),
+			Raw:  string(tok.Raw()),
+		})
+	}
+	return t, tok.Err()
+}
+
+// Text returns the parsed lines.
+func (t RawText) Text() Text {
+	text := make(Text, len(t))
+	for i, l := range t {
+		text[i] = l.Line
+	}
+	return text
+}
+
+// String returns the text of all the lines.
+func (t RawText) String() string {
+	var b strings.Builder
+	t.WriteTo(&b)
+	return b.String()
+}
+
+// WriteTo writes the text of all the lines to w.
+// It implements io.WriterTo.
+func (t RawText) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, l := range t {
+		m, err := io.WriteString(w, l.String())
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,44 @@
+package gemini
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRawText(t *testing.T) {
+	tests := []string{
+		"",
+		"text",
+		"# Title\r\n=>\tgemini://example.com   Example  \n",
+		"```  alt text \n  pre\t\n```\n\n\n*item\n>  quote\r\nno newline\r",
+		"a\rb\n\n",
+	}
+	for _, text := range tests {
+		raw, err := ParseRawText(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := raw.String(); got != text {
+			t.Errorf("expected %q, got %q", text, got)
+		}
+		parsed, err := ParseText(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := raw.Text(); len(got) != len(parsed) || (len(got) > 0 && !reflect.DeepEqual(got, parsed)) {
+			t.Errorf("%q: expected lines %#v, got %#v", text, parsed, got)
+		}
+	}
+
+	// Modified lines are formatted
+	raw, err := ParseRawText(strings.NewReader("#  Title\r\n=>  /a  A\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[1] = RawLine{Line: LineLink{URL: "/b", Name: "B"}}
+	const want = "#  Title\r\n=> /b B\n"
+	if got := raw.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,36 @@
+package gemini
+
+import (
+	"io"
+)
+
+// A Renderer renders Gemini text incrementally as it is parsed.
+// Clients can implement Renderer to display a page progressively while
+// the response body is still being received.
+type Renderer interface {
+	// RenderLine renders a single line. offset is the byte offset of the
+	// start of the line in the Gemini text.
+	// If RenderLine returns a non-nil error, rendering stops.
+	RenderLine(line Line, offset int64) error
+}
+
+// The RendererFunc type is an adapter to allow the use of ordinary
+// functions as Renderers. If f is a function with the appropriate
+// signature, RendererFunc(f) is a Renderer that calls f.
+type RendererFunc func(line Line, offset int64) error
+
+// RenderLine calls f(line, offset).
+func (f RendererFunc) RenderLine(line Line, offset int64) error {
+	return f(line, offset)
+}
+
+// Render parses Gemini text from the provided io.Reader and passes each
+// line to the renderer as soon as it has been read. The reader is
+// typically the Body of a Response, in which case lines are rendered as
+// the body is downloaded.
+//
+// Render returns the first error returned by the renderer, or any error
+// encountered while reading.
+func Render(r io.Reader, renderer Renderer) error {
+	return parseLines(r, renderer.RenderLine)
+}
@@ -0,0 +1,65 @@
+package gemini
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	const text = "# Title\r\n=> gemini://example.com Example\nText\n```\npre\n```"
+	type rendered struct {
+		line   Line
+		offset int64
+	}
+	want := []rendered{
+		{LineHeading1("Title"), 0},
+		{LineLink{"gemini://example.com", "Example"}, 9},
+		{LineText("Text"), 41},
+		{LinePreformattingToggle(""), 46},
+		{LinePreformattedText("pre"), 50},
+		{LinePreformattingToggle(""), 54},
+	}
+
+	// Deliver the text one byte at a time to simulate a slow connection.
+	pr, pw := io.Pipe()
+	go func() {
+		for i := 0; i < len(text); i++ {
+			pw.Write([]byte{text[i]})
+		}
+		pw.Close()
+	}()
+
+	var got []rendered
+	err := Render(pr, RendererFunc(func(line Line, offset int64) error {
+		got = append(got, rendered{line, offset})
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d lines, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("line %d: expected %#v, got %#v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	errStop := errors.New("stop")
+	var n int
+	err := Render(strings.NewReader("a\nb\nc\n"), RendererFunc(func(line Line, offset int64) error {
+		n++
+		return errStop
+	}))
+	if err != errStop {
+		t.Errorf("expected error %v, got %v", errStop, err)
+	}
+	if n != 1 {
+		t.Errorf("expected renderer to be called once, got %d", n)
+	}
+}
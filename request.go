@@ -2,10 +2,16 @@ package gemini
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"crypto/tls"
+	"errors"
 	"io"
 	"net"
 	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 // A Request represents a Gemini request received by a server or to be sent
@@ -28,8 +34,23 @@ type Request struct {
 	// This field is ignored by the Gemini server.
 	Certificate *tls.Certificate
 
-	conn net.Conn
-	tls  *tls.ConnectionState
+	// For server requests, Titan holds the parameters of Titan upload
+	// requests, that is, requests with the "titan" URL scheme.
+	// The parameters are removed from the URL path.
+	// Titan is nil for other requests.
+	// This field is ignored by the Gemini client.
+	Titan *TitanParameters
+
+	// For server requests, Body is the body of Titan upload requests.
+	// Reading from Body returns at most Titan.Size bytes.
+	// Body is nil for other requests.
+	// This field is ignored by the Gemini client.
+	Body io.Reader
+
+	conn   net.Conn
+	tls    *tls.ConnectionState
+	values context.Context // holds values set with WithValue
+	rawURL string          // URL as received by ReadRequest
 }
 
 // NewRequest returns a new request.
@@ -47,13 +68,19 @@ func NewRequest(rawurl string) (*Request, error) {
 
 // ReadRequest reads and parses an incoming request from r.
 //
+// If the request is a Titan upload request, its parameters are parsed
+// and the request body can be read from the Body field of the returned
+// Request, which reads from r.
+//
 // ReadRequest is a low-level function and should only be used
 // for specialized applications; most code should use the Server
 // to read requests and handle them via the Handler interface.
 func ReadRequest(r io.Reader) (*Request, error) {
 	// Limit request size
+	raw := r
 	r = io.LimitReader(r, 1026)
-	br := bufio.NewReaderSize(r, 1026)
+	br := newBufioReader(r)
+	defer putBufioReader(br)
 	b, err := br.ReadBytes('\n')
 	if err != nil {
 		if err == io.EOF {
@@ -73,7 +100,57 @@ func ReadRequest(r io.Reader) (*Request, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Request{URL: u}, nil
+	req := &Request{URL: u, rawURL: string(rawurl)}
+	if u.Scheme == "titan" {
+		req.Titan, err = parseTitanURL(u)
+		if err != nil {
+			return nil, err
+		}
+		// The body starts with any data buffered after the request line
+		// The buffered data is copied, since br is reused after
+		// ReadRequest returns.
+		buffered, _ := br.Peek(br.Buffered())
+		buffered = append([]byte(nil), buffered...)
+		body := io.MultiReader(bytes.NewReader(buffered), raw)
+		req.Body = io.LimitReader(body, req.Titan.Size)
+	}
+	return req, nil
+}
+
+// validateStrict checks that a request read by ReadRequest conforms
+// to the Gemini specification. The request URL must be absolute, must
+// not contain a fragment or userinfo and must be valid UTF-8.
+func validateStrict(r *Request) error {
+	switch {
+	case !utf8.ValidString(r.rawURL):
+		return errors.New("gemini: request URL is not valid UTF-8")
+	case r.URL.Scheme == "":
+		return errors.New("gemini: request URL has no scheme")
+	case r.URL.User != nil:
+		return errors.New("gemini: request URL contains userinfo")
+	case r.URL.Fragment != "" || strings.Contains(r.rawURL, "#"):
+		return errors.New("gemini: request URL contains a fragment")
+	}
+	return nil
+}
+
+// bufioReaderPool is a pool of *bufio.Reader used by ReadRequest.
+// The buffer is large enough to hold a request line of the maximum length.
+var bufioReaderPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, 1026)
+	},
+}
+
+func newBufioReader(r io.Reader) *bufio.Reader {
+	br := bufioReaderPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+func putBufioReader(br *bufio.Reader) {
+	br.Reset(nil)
+	bufioReaderPool.Put(br)
 }
 
 // WriteTo writes r to w in the Gemini request format.
@@ -98,6 +175,34 @@ func (r *Request) WriteTo(w io.Writer) (int64, error) {
 	return wrote, bw.Flush()
 }
 
+// WithValue returns a shallow copy of r with the value associated with
+// key set to val. Values are not sent to the server. They can be used to
+// pass per-request options, such as whether to bypass a cache, to code
+// that wraps a Client.
+//
+// As with context.WithValue, the provided key must be comparable and
+// should not be of type string or any other built-in type to avoid
+// collisions between packages.
+func (r *Request) WithValue(key, val interface{}) *Request {
+	r2 := new(Request)
+	*r2 = *r
+	r2.values = context.WithValue(r.valueContext(), key, val)
+	return r2
+}
+
+// Value returns the value associated with key in the request,
+// or nil if no value is associated with key.
+func (r *Request) Value(key interface{}) interface{} {
+	return r.valueContext().Value(key)
+}
+
+func (r *Request) valueContext() context.Context {
+	if r.values == nil {
+		return context.Background()
+	}
+	return r.values
+}
+
 // Conn returns the network connection on which the request was received.
 // Conn returns nil for client requests.
 func (r *Request) Conn() net.Conn {
@@ -2,9 +2,12 @@ package gemini
 
 import (
 	"bufio"
+	"io/ioutil"
 	"net/url"
 	"strings"
 	"testing"
+
+	"git.sr.ht/~adnano/go-gemini/spec"
 )
 
 // 1024 bytes
@@ -129,3 +132,69 @@ func TestWriteRequest(t *testing.T) {
 		}
 	}
 }
+
+func TestRequestWithValue(t *testing.T) {
+	type key struct{}
+	req, err := NewRequest("gemini://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req2 := req.WithValue(key{}, "value")
+	if v := req2.Value(key{}); v != "value" {
+		t.Errorf("expected value %q, got %v", "value", v)
+	}
+	if v := req.Value(key{}); v != nil {
+		t.Errorf("expected original request to be unmodified, got %v", v)
+	}
+}
+
+func TestReadTitanRequest(t *testing.T) {
+	const raw = "titan://example.com/a%20b.txt;mime=text/plain;size=5;token=t0k\r\nhello, world"
+	req, err := ReadRequest(strings.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Path != "/a b.txt" {
+		t.Errorf("expected path %q, got %q", "/a b.txt", req.URL.Path)
+	}
+	want := TitanParameters{Size: 5, MediaType: "text/plain", Token: "t0k"}
+	if req.Titan == nil || *req.Titan != want {
+		t.Fatalf("expected parameters %v, got %v", want, req.Titan)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "hello" {
+		t.Errorf("expected body %q, got %q", "hello", body)
+	}
+
+	if _, err := ReadRequest(strings.NewReader("titan://example.com/a.txt\r\n")); err != ErrInvalidRequest {
+		t.Errorf("expected err = %v for missing size, got %v", ErrInvalidRequest, err)
+	}
+}
+
+func BenchmarkReadRequest(b *testing.B) {
+	const raw = "gemini://example.com/path?query\r\n"
+	r := strings.NewReader(raw)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(raw)
+		if _, err := ReadRequest(r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRequestVectors(t *testing.T) {
+	for _, v := range spec.Requests() {
+		req, err := ReadRequest(strings.NewReader(v.Raw))
+		if v.Valid != (err == nil) {
+			t.Errorf("%s: expected valid = %t, got error %v", v.Name, v.Valid, err)
+			continue
+		}
+		if err == nil && req.URL.String() != v.URL {
+			t.Errorf("%s: expected URL %q, got %q", v.Name, v.URL, req.URL)
+		}
+	}
+}
@@ -3,10 +3,14 @@ package gemini
 import (
 	"bufio"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // The default media type for responses.
@@ -85,7 +89,7 @@ func ReadResponse(r io.ReadCloser) (*Response, error) {
 	}
 	resp.Meta = string(meta)
 
-	if resp.Status.Class() == StatusSuccess {
+	if resp.Status.Success() {
 		// Use unlimited reader
 		wr.Reader = r
 
@@ -175,48 +179,221 @@ type ResponseWriter interface {
 
 	// Flush sends any buffered data to the client.
 	Flush() error
+
+	// Written reports whether the response header has been written.
+	Written() bool
+
+	// Close sends any buffered data to the client and completes the
+	// response, closing the connection if there is one. If no response
+	// header has been written, the header configured by the server's
+	// EmptyResponseStatus, "40 Temporary failure" by default, is sent.
+	// Subsequent writes return ErrResponseClosed.
+	//
+	// Close lets streaming handlers end a response without returning
+	// from ServeGemini. Handlers that simply return need not call it.
+	Close() error
+}
+
+// The Hijacker interface is implemented by ResponseWriters that allow a
+// Handler to take over the connection.
+//
+// The ResponseWriter provided to handlers by Server implements Hijacker.
+// Handlers should always test for this ability at runtime, since
+// ResponseWriters that wrap it may not.
+type Hijacker interface {
+	// Hijack lets the caller take over the connection. Any response
+	// data written before the call is sent to the client first. After a
+	// call to Hijack, the server will not do anything else with the
+	// connection, and the ResponseWriter may no longer be used; its Write
+	// and Flush methods return ErrHijacked.
+	//
+	// It becomes the caller's responsibility to manage and close the
+	// connection. The read and write deadlines set by the server are
+	// cleared. The returned connection may outlive the call to
+	// ServeGemini.
+	//
+	// Data sent by the client after the request line may have been
+	// consumed by the server. The body of a Titan request should be read
+	// from Request.Body.
+	Hijack() (net.Conn, error)
 }
 
 type responseWriter struct {
 	bw          *bufio.Writer
+	conn        net.Conn
 	mediatype   string
+	status      Status
 	wroteHeader bool
 	bodyAllowed bool
+	warned      bool
+	hijacked    bool
+	closed      bool
+	mu          sync.Mutex
+
+	// hijacking and aborting are set by Hijack and preventHijack before
+	// they check each other, so that the server never interrupts a
+	// connection that is being hijacked. They are accessed atomically.
+	hijacking int32
+	aborting  int32
+
+	// checkClient, if not nil, is called after the response has been
+	// flushed to check whether the client has gone away.
+	checkClient func()
+
+	// emptyStatus and emptyMeta are sent if the response is completed
+	// without a header. See Server.EmptyResponseStatus.
+	emptyStatus Status
+	emptyMeta   string
+
+	// warn, if not nil, is called the first time the handler attempts
+	// to write a body that is not allowed by the response status code.
+	warn func(msg string, args ...interface{})
+}
+
+// bufioWriterPool is a pool of *bufio.Writer used by responseWriter.
+var bufioWriterPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewWriter(nil)
+	},
 }
 
 func newResponseWriter(w io.Writer) *responseWriter {
+	bw := bufioWriterPool.Get().(*bufio.Writer)
+	bw.Reset(w)
 	return &responseWriter{
-		bw: bufio.NewWriter(w),
+		bw: bw,
+	}
+}
+
+// Hijack implements the Hijacker interface.
+// It returns ErrHijacked if the connection has already been hijacked.
+func (w *responseWriter) Hijack() (net.Conn, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hijacked {
+		return nil, ErrHijacked
+	}
+	if w.conn == nil || w.bw == nil {
+		return nil, errors.New("gemini: connection cannot be hijacked")
 	}
+	if w.closed {
+		return nil, ErrResponseClosed
+	}
+	atomic.StoreInt32(&w.hijacking, 1)
+	if atomic.LoadInt32(&w.aborting) != 0 {
+		atomic.StoreInt32(&w.hijacking, 0)
+		return nil, errors.New("gemini: server is shutting down")
+	}
+	if err := w.bw.Flush(); err != nil {
+		atomic.StoreInt32(&w.hijacking, 0)
+		return nil, err
+	}
+	w.hijacked = true
+	w.wroteHeader = true
+	w.bodyAllowed = false
+	w.conn.SetDeadline(time.Time{})
+	return w.conn, nil
+}
+
+// isHijacked reports whether the connection has been hijacked.
+func (w *responseWriter) isHijacked() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.hijacked
+}
+
+func (w *responseWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.wroteHeader
+}
+
+// release returns the buffered writer to the pool. It must be called
+// only once the response has been flushed. Subsequent writes return
+// ErrBodyNotAllowed and subsequent flushes do nothing.
+func (w *responseWriter) release() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.bw == nil {
+		return
+	}
+	w.bw.Reset(nil)
+	bufioWriterPool.Put(w.bw)
+	w.bw = nil
+	w.wroteHeader = true
+	w.bodyAllowed = false
 }
 
 func (w *responseWriter) SetMediaType(mediatype string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 	w.mediatype = mediatype
 }
 
 func (w *responseWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.startBodyLocked(len(b) > 0); err != nil {
+		return 0, err
+	}
+	return w.bw.Write(b)
+}
+
+// ReadFrom implements io.ReaderFrom. It copies the response body from r
+// into the buffered writer without an intermediate buffer, so that
+// io.Copy to the ResponseWriter avoids redundant copies and allocations.
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.startBodyLocked(true); err != nil {
+		return 0, err
+	}
+	return w.bw.ReadFrom(r)
+}
+
+// startBodyLocked writes the response header if necessary and reports
+// whether the response body may be written. nonEmpty reports whether
+// the handler is attempting to write data.
+func (w *responseWriter) startBodyLocked(nonEmpty bool) error {
 	if !w.wroteHeader {
 		meta := w.mediatype
 		if meta == "" {
 			// Use default media type
 			meta = defaultMediaType
 		}
-		w.WriteHeader(StatusSuccess, meta)
+		w.writeHeaderLocked(StatusSuccess, meta)
+	}
+	if w.hijacked {
+		return ErrHijacked
+	}
+	if w.closed {
+		return ErrResponseClosed
 	}
 	if !w.bodyAllowed {
-		return 0, ErrBodyNotAllowed
+		if nonEmpty && !w.warned && w.warn != nil {
+			w.warned = true
+			w.warn("Handler wrote body after non-success header", "status", w.status)
+		}
+		return &BodyNotAllowedError{w.status}
 	}
-	return w.bw.Write(b)
+	return nil
 }
 
 func (w *responseWriter) WriteHeader(status Status, meta string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeHeaderLocked(status, meta)
+}
+
+func (w *responseWriter) writeHeaderLocked(status Status, meta string) {
 	if w.wroteHeader {
 		return
 	}
 
-	if status.Class() == StatusSuccess {
+	if status.Success() {
 		w.bodyAllowed = true
 	}
+	w.status = status
 
 	w.bw.WriteString(strconv.Itoa(int(status)))
 	w.bw.WriteByte(' ')
@@ -226,9 +403,96 @@ func (w *responseWriter) WriteHeader(status Status, meta string) {
 }
 
 func (w *responseWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hijacked {
+		return ErrHijacked
+	}
+	if w.bw == nil || w.closed {
+		// The response has already been completed
+		return nil
+	}
 	if !w.wroteHeader {
-		w.WriteHeader(StatusTemporaryFailure, "Temporary failure")
+		w.writeHeaderLocked(w.emptyHeader())
 	}
 	// Write errors from WriteHeader will be returned here.
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+	if w.checkClient != nil {
+		w.checkClient()
+	}
+	return nil
+}
+
+func (w *responseWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hijacked {
+		return ErrHijacked
+	}
+	if w.bw == nil || w.closed {
+		return nil
+	}
+	if !w.wroteHeader {
+		w.writeHeaderLocked(w.emptyHeader())
+	}
+	w.closed = true
+	w.bodyAllowed = false
+	err := w.bw.Flush()
+	if w.conn != nil {
+		if cerr := w.conn.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// emptyHeader returns the header sent for a response without one.
+func (w *responseWriter) emptyHeader() (Status, string) {
+	return failureHeader(w.emptyStatus, w.emptyMeta, StatusTemporaryFailure)
+}
+
+// abort sends a response header with the provided status code and meta
+// if no header has been written yet. Subsequent writes by the handler
+// return ErrBodyNotAllowed, or fail if a header had already been written.
+// It is safe to call abort concurrently with other methods.
+//
+// Pending writes to the connection are interrupted first, since a handler
+// blocked writing to a client that is not reading holds the lock.
+func (w *responseWriter) abort(status Status, meta string) error {
+	if !w.preventHijack() {
+		return nil
+	}
+	if w.conn != nil {
+		w.conn.SetWriteDeadline(aLongTimeAgo)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.wroteHeader || w.bw == nil {
+		return nil
+	}
+	if w.conn != nil {
+		// No write was in progress, since the header is written
+		// first, so the header can be sent. Do not wait for
+		// clients that are not reading.
+		w.conn.SetWriteDeadline(time.Now().Add(abortWriteTimeout))
+	}
+	w.writeHeaderLocked(status, meta)
+	w.bodyAllowed = false
 	return w.bw.Flush()
 }
+
+// preventHijack makes subsequent calls to Hijack fail, and reports
+// whether the connection has not been hijacked. It does not wait for
+// the lock, so that the server can interrupt handlers that are blocked
+// writing to the connection.
+func (w *responseWriter) preventHijack() bool {
+	atomic.StoreInt32(&w.aborting, 1)
+	return atomic.LoadInt32(&w.hijacking) == 0
+}
+
+// abortWriteTimeout is the maximum duration for sending the response
+// header of aborted connections.
+const abortWriteTimeout = time.Second
@@ -1,10 +1,14 @@
 package gemini
 
 import (
+	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"strings"
 	"testing"
+
+	"git.sr.ht/~adnano/go-gemini/spec"
 )
 
 func TestReadWriteResponse(t *testing.T) {
@@ -133,3 +137,140 @@ func TestReadWriteResponse(t *testing.T) {
 		}
 	}
 }
+
+// recorder is a ResponseWriter that records the response.
+type recorder struct {
+	Status    Status
+	Meta      string
+	Body      bytes.Buffer
+	mediatype string
+	closed    bool
+}
+
+func (w *recorder) SetMediaType(mediatype string) {
+	w.mediatype = mediatype
+}
+
+func (w *recorder) Write(b []byte) (int, error) {
+	if w.Status == 0 {
+		meta := w.mediatype
+		if meta == "" {
+			meta = defaultMediaType
+		}
+		w.WriteHeader(StatusSuccess, meta)
+	}
+	if w.closed {
+		return 0, ErrResponseClosed
+	}
+	return w.Body.Write(b)
+}
+
+func (w *recorder) WriteHeader(status Status, meta string) {
+	if w.Status != 0 {
+		return
+	}
+	w.Status = status
+	w.Meta = meta
+}
+
+func (w *recorder) Flush() error {
+	return nil
+}
+
+func (w *recorder) Written() bool {
+	return w.Status != 0
+}
+
+func (w *recorder) Close() error {
+	if w.Status == 0 {
+		w.WriteHeader(StatusTemporaryFailure, "Temporary failure")
+	}
+	w.closed = true
+	return nil
+}
+
+func BenchmarkResponseWriter(b *testing.B) {
+	body := []byte("# Hello, world!\n")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		w := newResponseWriter(ioutil.Discard)
+		w.SetMediaType("text/gemini")
+		w.Write(body)
+		if err := w.Flush(); err != nil {
+			b.Fatal(err)
+		}
+		w.release()
+	}
+}
+
+func TestResponseWriterBodyNotAllowed(t *testing.T) {
+	var warnings int
+	w := newResponseWriter(ioutil.Discard)
+	w.warn = func(msg string, args ...interface{}) {
+		warnings++
+	}
+	if w.Written() {
+		t.Error("expected Written to report false before the header is written")
+	}
+	w.WriteHeader(StatusNotFound, "Not found")
+	if !w.Written() {
+		t.Error("expected Written to report true after the header is written")
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := w.Write([]byte("body"))
+		if !errors.Is(err, ErrBodyNotAllowed) {
+			t.Fatalf("expected ErrBodyNotAllowed, got %v", err)
+		}
+		var bodyErr *BodyNotAllowedError
+		if !errors.As(err, &bodyErr) || bodyErr.Status != StatusNotFound {
+			t.Errorf("expected *BodyNotAllowedError with status %d, got %#v", StatusNotFound, err)
+		}
+	}
+	if warnings != 1 {
+		t.Errorf("expected 1 warning, got %d", warnings)
+	}
+}
+
+func TestResponseWriterReadFrom(t *testing.T) {
+	var b bytes.Buffer
+	w := newResponseWriter(&b)
+	w.SetMediaType("text/plain")
+	body := strings.Repeat("line\n", 10000)
+	n, err := io.Copy(w, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(body)) {
+		t.Errorf("expected %d bytes to be copied, got %d", len(body), n)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := "20 text/plain\r\n" + body; b.String() != want {
+		t.Errorf("unexpected response of %d bytes", b.Len())
+	}
+
+	w = newResponseWriter(ioutil.Discard)
+	w.WriteHeader(StatusNotFound, "Not found")
+	if _, err := w.ReadFrom(strings.NewReader(body)); !errors.Is(err, ErrBodyNotAllowed) {
+		t.Errorf("expected ErrBodyNotAllowed, got %v", err)
+	}
+}
+
+func TestResponseVectors(t *testing.T) {
+	for _, v := range spec.Responses() {
+		resp, err := ReadResponse(ioutil.NopCloser(strings.NewReader(v.Raw)))
+		if v.Valid != (err == nil) {
+			t.Errorf("%s: expected valid = %t, got error %v", v.Name, v.Valid, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if int(resp.Status) != v.Status || resp.Meta != v.Meta || string(body) != v.Body {
+			t.Errorf("%s: expected %d %q %q, got %d %q %q", v.Name, v.Status, v.Meta, v.Body, resp.Status, resp.Meta, body)
+		}
+	}
+}
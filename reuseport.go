@@ -0,0 +1,25 @@
+package gemini
+
+import (
+	"context"
+	"net"
+)
+
+// ListenReusePort is like net.Listen except that it sets the SO_REUSEPORT
+// socket option on the listening socket. This allows multiple processes to
+// listen on the same address, with the operating system distributing
+// incoming connections among them. It can be used to scale a server across
+// several processes instead of running one large process.
+//
+// Servers listening on the same port should share a certificate directory
+// so that they present the same certificates. See the Load method of
+// certificate.Store.
+//
+// ListenReusePort returns an error on platforms that do not support
+// SO_REUSEPORT.
+func ListenReusePort(network, address string) (net.Listener, error) {
+	lc := net.ListenConfig{
+		Control: reusePortControl,
+	}
+	return lc.Listen(context.Background(), network, address)
+}
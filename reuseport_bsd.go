@@ -0,0 +1,7 @@
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package gemini
+
+import "syscall"
+
+const soReusePort = syscall.SO_REUSEPORT
@@ -0,0 +1,6 @@
+// +build linux,!mips,!mipsle,!mips64,!mips64le
+
+package gemini
+
+// The syscall package does not define SO_REUSEPORT on Linux.
+const soReusePort = 0xf
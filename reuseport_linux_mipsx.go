@@ -0,0 +1,6 @@
+// +build linux,mips linux,mipsle linux,mips64 linux,mips64le
+
+package gemini
+
+// The syscall package does not define SO_REUSEPORT on Linux.
+const soReusePort = 0x200
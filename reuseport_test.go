@@ -0,0 +1,29 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package gemini
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListenReusePort(t *testing.T) {
+	l1, err := ListenReusePort("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l1.Close()
+
+	// A second listener can bind the same address
+	l2, err := ListenReusePort("tcp", l1.Addr().String())
+	if err != nil {
+		t.Fatalf("expected a second listener on %s, got %v", l1.Addr(), err)
+	}
+	defer l2.Close()
+
+	// Listeners without SO_REUSEPORT cannot
+	if l, err := net.Listen("tcp", l1.Addr().String()); err == nil {
+		l.Close()
+		t.Error("expected net.Listen to fail on the same address")
+	}
+}
@@ -0,0 +1,118 @@
+package gemini
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ErrTruncated is returned by Sanitizer.Sanitize when the Gemini text
+// exceeds the maximum size or number of lines and has been truncated.
+var ErrTruncated = errors.New("gemini: sanitized text truncated")
+
+// A Sanitizer rewrites Gemini text from an untrusted source, such as a
+// third-party server, so that it can be served safely by a gateway or
+// proxy. The zero value passes all lines through unchanged, except that
+// it closes a preformatted block left open at the end of the text.
+type Sanitizer struct {
+	// Schemes optionally lists the URL schemes allowed in links, such as
+	// "gemini" and "https". Relative URLs are always allowed. Links with
+	// other schemes, and links with invalid URLs, are replaced with text
+	// lines containing their names, or removed if they have no name.
+	// If nil, all schemes are allowed.
+	Schemes []string
+
+	// RewriteURL optionally rewrites the URLs of allowed links, for
+	// example to refer to the gateway. If it returns the empty string,
+	// the link is handled as if its scheme was not allowed.
+	RewriteURL func(url string) string
+
+	// MaxLines, if positive, limits the number of lines written.
+	MaxLines int
+
+	// MaxSize, if positive, limits the number of bytes written, not
+	// counting the toggle line written to close a preformatted block.
+	MaxSize int64
+}
+
+// Sanitize reads Gemini text from r and writes the sanitized text to w.
+// If the text exceeds MaxLines or MaxSize, Sanitize stops at the last
+// line that fits, closes any open preformatted block, and returns
+// ErrTruncated. Otherwise, it returns the first error encountered while
+// reading or writing, if any.
+func (s *Sanitizer) Sanitize(w io.Writer, r io.Reader) error {
+	var pre bool
+	var lines int
+	var size int64
+	var err error
+	t := NewTokenizer(r)
+	for t.Next() {
+		line, ok := s.sanitizeLine(t.Line())
+		if !ok {
+			continue
+		}
+		text := line.String() + "\n"
+		if (s.MaxLines > 0 && lines >= s.MaxLines) ||
+			(s.MaxSize > 0 && size+int64(len(text)) > s.MaxSize) {
+			err = ErrTruncated
+			break
+		}
+		if _, err := io.WriteString(w, text); err != nil {
+			return err
+		}
+		if _, ok := line.(LinePreformattingToggle); ok {
+			pre = !pre
+		}
+		lines++
+		size += int64(len(text))
+	}
+	if err == nil {
+		err = t.Err()
+	}
+	if pre {
+		if _, err := io.WriteString(w, "```\n"); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// sanitizeLine returns the sanitized line, or false if it should be
+// removed.
+func (s *Sanitizer) sanitizeLine(line Line) (Line, bool) {
+	link, ok := line.(LineLink)
+	if !ok {
+		return line, true
+	}
+	if s.allowed(link.URL) {
+		if s.RewriteURL == nil {
+			return link, true
+		}
+		if link.URL = s.RewriteURL(link.URL); link.URL != "" {
+			return link, true
+		}
+	}
+	if link.Name == "" {
+		return nil, false
+	}
+	// The name could start with characters with a special meaning
+	return LineText(EscapeText(link.Name)), true
+}
+
+// allowed reports whether the scheme of the URL is allowed.
+func (s *Sanitizer) allowed(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false
+	}
+	if s.Schemes == nil || u.Scheme == "" {
+		return true
+	}
+	for _, scheme := range s.Schemes {
+		if strings.EqualFold(scheme, u.Scheme) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package gemini
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizer(t *testing.T) {
+	const text = "# Title\n" +
+		"=> gemini://example.com/ Gemini\n" +
+		"=> /relative Relative\n" +
+		"=> JavaScript:alert(1) => Script\n" +
+		"=> file:///etc/passwd\n" +
+		"=> https://example.org/ HTTPS\n" +
+		"```\n" +
+		"unterminated\n"
+
+	tests := []struct {
+		Sanitizer Sanitizer
+		Want      string
+		Err       error
+	}{
+		{
+			Sanitizer{},
+			text + "```\n",
+			nil,
+		},
+		{
+			Sanitizer{Schemes: []string{"gemini", "https"}},
+			"# Title\n" +
+				"=> gemini://example.com/ Gemini\n" +
+				"=> /relative Relative\n" +
+				" => Script\n" +
+				"=> https://example.org/ HTTPS\n" +
+				"```\n" +
+				"unterminated\n" +
+				"```\n",
+			nil,
+		},
+		{
+			Sanitizer{
+				Schemes: []string{"gemini", "https"},
+				RewriteURL: func(url string) string {
+					if strings.HasPrefix(url, "https:") {
+						return ""
+					}
+					return strings.Replace(url, "gemini://", "/proxy/", 1)
+				},
+			},
+			"# Title\n" +
+				"=> /proxy/example.com/ Gemini\n" +
+				"=> /relative Relative\n" +
+				" => Script\n" +
+				"HTTPS\n" +
+				"```\n" +
+				"unterminated\n" +
+				"```\n",
+			nil,
+		},
+		{
+			Sanitizer{MaxLines: 7},
+			strings.Join(strings.SplitAfter(text, "\n")[:7], "") + "```\n",
+			ErrTruncated,
+		},
+		{
+			Sanitizer{MaxSize: 10},
+			"# Title\n",
+			ErrTruncated,
+		},
+	}
+	for i, test := range tests {
+		var b strings.Builder
+		err := test.Sanitizer.Sanitize(&b, strings.NewReader(text))
+		if err != test.Err {
+			t.Errorf("%d: expected error %v, got %v", i, test.Err, err)
+		}
+		if b.String() != test.Want {
+			t.Errorf("%d: expected:\n%s\ngot:\n%s", i, test.Want, b.String())
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Package scgi implements an SCGI (Simple Common Gateway Interface)
+// client for Gemini servers.
+//
+// The Handler forwards each request to an SCGI application server
+// listening on a socket. The request is described using the same
+// environment variables as CGI (see the cgi submodule). The application
+// must write a complete Gemini response, including the response header.
+package scgi
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+
+	"git.sr.ht/~adnano/go-gemini"
+	"git.sr.ht/~adnano/go-gemini/cgi"
+)
+
+// Handler forwards requests to an SCGI application server.
+type Handler struct {
+	// Network and Addr specify the address of the application server,
+	// for example "unix" and "/run/app.sock" or "tcp" and "localhost:4000".
+	// See net.Dial for details of the address format.
+	Network string
+	Addr    string
+
+	// Root is the root URL path prefix of the handler; empty means "/".
+	// The part of the request path following Root is passed to the
+	// application in the PATH_INFO variable.
+	Root string
+
+	// Env specifies extra variables to send, in the form "key=value".
+	Env []string
+
+	// DialContext specifies the dial function for connecting to the
+	// application server. If DialContext is nil, package net is used.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// ErrorLog specifies an optional logger for errors communicating
+	// with the application server. If nil, logging is done via the log
+	// package's standard logger.
+	ErrorLog interface {
+		Printf(format string, v ...interface{})
+	}
+}
+
+// ServeGemini forwards the request to the application server, together
+// with the body of Titan upload requests, and relays its response to w.
+// Requests whose variables would contain NUL bytes, such as requests for
+// paths with an escaped NUL, are answered with "59 Bad request".
+// If the application server cannot be reached or writes an invalid
+// response header, the handler responds with "42 CGI error".
+func (h *Handler) ServeGemini(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+	env := append(cgi.Environ(r, h.Root), h.Env...)
+	// NUL bytes would let the request inject its own variables
+	for _, kv := range env {
+		if strings.IndexByte(kv, 0) != -1 {
+			w.WriteHeader(gemini.StatusBadRequest, "Bad request")
+			return
+		}
+	}
+	var contentLength int64
+	if r.Titan != nil {
+		contentLength = r.Titan.Size
+	}
+
+	conn, err := h.dial(ctx)
+	if err != nil {
+		h.logf("scgi: %v", err)
+		w.WriteHeader(gemini.StatusCGIError, "CGI error")
+		return
+	}
+	defer conn.Close()
+
+	// Close the connection when the context is canceled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	if _, err := conn.Write(encodeHeaders(env, contentLength)); err != nil {
+		h.logf("scgi: %v", err)
+		w.WriteHeader(gemini.StatusCGIError, "CGI error")
+		return
+	}
+	if contentLength > 0 && r.Body != nil {
+		if _, err := io.CopyN(conn, r.Body, contentLength); err != nil {
+			h.logf("scgi: error sending request body: %v", err)
+			w.WriteHeader(gemini.StatusCGIError, "CGI error")
+			return
+		}
+	}
+
+	resp, err := gemini.ReadResponse(conn)
+	if err != nil {
+		h.logf("scgi: invalid response: %v", err)
+		w.WriteHeader(gemini.StatusCGIError, "CGI error")
+		return
+	}
+	defer resp.Body.Close()
+
+	w.WriteHeader(resp.Status, resp.Meta)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		h.logf("scgi: %v", err)
+	}
+}
+
+// encodeHeaders encodes the provided variables as an SCGI request
+// netstring, with CONTENT_LENGTH set to the size of the request body,
+// which is zero for requests other than Titan uploads. The variables must
+// not contain NUL bytes.
+func encodeHeaders(env []string, contentLength int64) []byte {
+	var b bytes.Buffer
+	b.WriteString("CONTENT_LENGTH\x00")
+	b.WriteString(strconv.FormatInt(contentLength, 10))
+	b.WriteString("\x00SCGI\x001\x00")
+	for _, kv := range env {
+		i := strings.IndexByte(kv, '=')
+		if i == -1 {
+			continue
+		}
+		key := kv[:i]
+		if key == "CONTENT_LENGTH" || key == "SCGI" {
+			continue
+		}
+		b.WriteString(key)
+		b.WriteByte(0)
+		b.WriteString(kv[i+1:])
+		b.WriteByte(0)
+	}
+
+	var ns bytes.Buffer
+	ns.WriteString(strconv.Itoa(b.Len()))
+	ns.WriteByte(':')
+	b.WriteTo(&ns)
+	ns.WriteByte(',')
+	return ns.Bytes()
+}
+
+func (h *Handler) dial(ctx context.Context) (net.Conn, error) {
+	if h.DialContext != nil {
+		return h.DialContext(ctx, h.Network, h.Addr)
+	}
+	return (&net.Dialer{}).DialContext(ctx, h.Network, h.Addr)
+}
+
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.ErrorLog != nil {
+		h.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
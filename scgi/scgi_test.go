@@ -0,0 +1,217 @@
+package scgi
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// readHeaders reads an SCGI request netstring from r and returns its
+// variables in order, in the form "key=value".
+func readHeaders(r *bufio.Reader) ([]string, error) {
+	n, err := r.ReadString(':')
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(n, ":"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid netstring length %q", n)
+	}
+	b := make([]byte, size+1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	if b[size] != ',' {
+		return nil, fmt.Errorf("netstring does not end with a comma: %q", b)
+	}
+	fields := bytes.Split(b[:size], []byte{0})
+	if len(fields)%2 != 1 || len(fields[len(fields)-1]) != 0 {
+		return nil, fmt.Errorf("headers are not NUL-terminated key and value pairs: %q", b[:size])
+	}
+	var env []string
+	for i := 0; i+1 < len(fields); i += 2 {
+		env = append(env, string(fields[i])+"="+string(fields[i+1]))
+	}
+	return env, nil
+}
+
+func TestEncodeHeaders(t *testing.T) {
+	b := encodeHeaders([]string{"PATH_INFO=/a=b", "CONTENT_LENGTH=5", "SCGI=2", "EMPTY=", "invalid"}, 42)
+	const want = "47:CONTENT_LENGTH\x0042\x00SCGI\x001\x00PATH_INFO\x00/a=b\x00EMPTY\x00\x00,"
+	if string(b) != want {
+		t.Errorf("expected %q, got %q", want, b)
+	}
+
+	env, err := readHeaders(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEnv := []string{"CONTENT_LENGTH=42", "SCGI=1", "PATH_INFO=/a=b", "EMPTY="}
+	if strings.Join(env, "\n") != strings.Join(wantEnv, "\n") {
+		t.Errorf("expected %q, got %q", wantEnv, env)
+	}
+}
+
+type recorder struct {
+	status gemini.Status
+	meta   string
+	body   bytes.Buffer
+}
+
+func (r *recorder) SetMediaType(mediatype string) {}
+func (r *recorder) Write(b []byte) (int, error)   { return r.body.Write(b) }
+func (r *recorder) WriteHeader(status gemini.Status, meta string) {
+	r.status, r.meta = status, meta
+}
+func (r *recorder) Flush() error  { return nil }
+func (r *recorder) Written() bool { return r.status != 0 }
+func (r *recorder) Close() error  { return nil }
+
+// backend is a fake SCGI application server that records the variables
+// and body of a request and responds with the body.
+type backend struct {
+	env  []string
+	body string
+	err  chan error
+}
+
+func (b *backend) dial() func(ctx context.Context, network, addr string) (net.Conn, error) {
+	b.err = make(chan error, 1)
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			br := bufio.NewReader(server)
+			env, err := readHeaders(br)
+			if err != nil {
+				b.err <- err
+				return
+			}
+			b.env = env
+			var length int
+			for _, kv := range b.env {
+				if strings.HasPrefix(kv, "CONTENT_LENGTH=") {
+					length, _ = strconv.Atoi(strings.TrimPrefix(kv, "CONTENT_LENGTH="))
+				}
+			}
+			body := make([]byte, length)
+			if _, err := io.ReadFull(br, body); err != nil {
+				b.err <- err
+				return
+			}
+			b.body = string(body)
+			_, err = io.WriteString(server, "20 text/gemini\r\nbody: "+b.body)
+			b.err <- err
+		}()
+		return client, nil
+	}
+}
+
+func (b *backend) lookup(key string) (string, bool) {
+	for _, kv := range b.env {
+		if strings.HasPrefix(kv, key+"=") {
+			return strings.TrimPrefix(kv, key+"="), true
+		}
+	}
+	return "", false
+}
+
+func TestHandler(t *testing.T) {
+	var b backend
+	h := &Handler{Root: "/app", Env: []string{"EXTRA=1"}}
+	h.DialContext = b.dial()
+
+	req, err := gemini.NewRequest("gemini://example.com/app/page?q")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &recorder{}
+	h.ServeGemini(context.Background(), w, req)
+	if err := <-b.err; err != nil {
+		t.Fatal(err)
+	}
+	if w.status != gemini.StatusSuccess || w.meta != "text/gemini" || w.body.String() != "body: " {
+		t.Errorf("unexpected response %d %q %q", w.status, w.meta, w.body.String())
+	}
+	for key, want := range map[string]string{
+		"CONTENT_LENGTH": "0",
+		"SCGI":           "1",
+		"PATH_INFO":      "/page",
+		"QUERY_STRING":   "q",
+		"EXTRA":          "1",
+	} {
+		if got, _ := b.lookup(key); got != want {
+			t.Errorf("expected %s=%q, got %q", key, want, got)
+		}
+	}
+}
+
+func TestHandlerTitan(t *testing.T) {
+	var b backend
+	h := &Handler{}
+	h.DialContext = b.dial()
+
+	u, err := url.Parse("titan://example.com/upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &gemini.Request{
+		URL:   u,
+		Titan: &gemini.TitanParameters{Size: 5, MediaType: "text/plain"},
+		Body:  strings.NewReader("hello, and more"),
+	}
+	w := &recorder{}
+	h.ServeGemini(context.Background(), w, req)
+	if err := <-b.err; err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := b.lookup("CONTENT_LENGTH"); got != "5" {
+		t.Errorf("expected CONTENT_LENGTH=5, got %q", got)
+	}
+	if b.body != "hello" || w.body.String() != "body: hello" {
+		t.Errorf("expected body %q, got %q (response %q)", "hello", b.body, w.body.String())
+	}
+}
+
+func TestHandlerRejectsNUL(t *testing.T) {
+	dialed := false
+	h := &Handler{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = true
+			return nil, io.EOF
+		},
+	}
+	req, err := gemini.NewRequest("gemini://example.com/x%00TLS_CLIENT_HASH%00SHA256:FORGED")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &recorder{}
+	h.ServeGemini(context.Background(), w, req)
+	if w.status != gemini.StatusBadRequest {
+		t.Errorf("expected status %d, got %d %q", gemini.StatusBadRequest, w.status, w.meta)
+	}
+	if dialed {
+		t.Error("expected the application server not to be contacted")
+	}
+
+	// NUL bytes in configured variables are rejected as well
+	h.Env = []string{"KEY=a\x00b"}
+	req, err = gemini.NewRequest("gemini://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = &recorder{}
+	h.ServeGemini(context.Background(), w, req)
+	if w.status != gemini.StatusBadRequest || dialed {
+		t.Errorf("expected status %d without dialing, got %d", gemini.StatusBadRequest, w.status)
+	}
+}
@@ -0,0 +1,104 @@
+package gemini
+
+// Section is a section of Gemini text, started by a heading.
+type Section struct {
+	// Heading is the heading line that starts the section, or nil for
+	// the lines preceding the first heading of the text.
+	Heading Line
+
+	// Level is the level of the heading, from 1 to 3, or 0 if Heading
+	// is nil.
+	Level int
+
+	// Title is the text of the heading.
+	Title string
+
+	// Anchor is a fragment identifier for the heading, as in the table
+	// of contents returned by TableOfContents. It is empty for sections
+	// with empty headings and for the lines preceding the first heading.
+	Anchor string
+
+	// Line is the line number of the heading, or of the first line of the
+	// section if Heading is nil, starting at 1.
+	Line int
+
+	// Body contains the lines of the section following the heading, up to
+	// the next heading.
+	Body Text
+
+	// Sections are the subsections of the section: the sections started
+	// by headings of lower levels that follow the heading, up to the next
+	// heading of the same or a higher level.
+	Sections []Section
+}
+
+// Text returns the complete text of the section, including its heading
+// and its subsections.
+func (s *Section) Text() Text {
+	var t Text
+	s.appendText(&t)
+	return t
+}
+
+func (s *Section) appendText(t *Text) {
+	if s.Heading != nil {
+		*t = append(*t, s.Heading)
+	}
+	*t = append(*t, s.Body...)
+	for i := range s.Sections {
+		s.Sections[i].appendText(t)
+	}
+}
+
+// SplitSections splits the provided Gemini text into sections started by
+// headings. Sections are nested below the closest preceding heading of a
+// higher level, like the entries of TableOfContents. If the text does not
+// start with a heading, the first section contains the preceding lines
+// and has a nil Heading. Concatenating the text of the sections returns
+// the original text.
+func SplitSections(t Text) []Section {
+	var flat []Section
+	anchors := make(anchorSet)
+	for i, line := range t {
+		level := headingLevel(line)
+		if level == 0 {
+			if len(flat) == 0 {
+				flat = append(flat, Section{Line: i + 1})
+			}
+			last := &flat[len(flat)-1]
+			last.Body = append(last.Body, line)
+			continue
+		}
+		section := Section{
+			Heading: line,
+			Level:   level,
+			Title:   headingTitle(line, level),
+			Line:    i + 1,
+		}
+		if section.Title != "" {
+			section.Anchor = anchors.add(section.Title)
+		}
+		flat = append(flat, section)
+	}
+	if len(flat) > 0 && flat[0].Heading == nil {
+		// The lines preceding the first heading are never nested
+		return append([]Section{flat[0]}, nestSections(flat[1:])...)
+	}
+	return nestSections(flat)
+}
+
+// nestSections nests the sections of a flat list of sections.
+func nestSections(flat []Section) []Section {
+	var sections []Section
+	for i := 0; i < len(flat); {
+		section := flat[i]
+		j := i + 1
+		for j < len(flat) && flat[j].Level > section.Level {
+			j++
+		}
+		section.Sections = nestSections(flat[i+1 : j])
+		sections = append(sections, section)
+		i = j
+	}
+	return sections
+}
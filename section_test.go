@@ -0,0 +1,63 @@
+package gemini
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitSections(t *testing.T) {
+	text := "Preamble\n" +
+		"# Title\n" +
+		"Intro\n" +
+		"## Usage\n" +
+		"```\n" +
+		"# not a heading\n" +
+		"```\n" +
+		"### Install\n" +
+		"Steps\n" +
+		"#\n" +
+		"## Usage\n"
+
+	doc, err := ParseText(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Section{
+		{Line: 1, Body: Text{LineText("Preamble")}},
+		{Heading: LineHeading1("Title"), Level: 1, Title: "Title", Anchor: "title", Line: 2,
+			Body: Text{LineText("Intro")},
+			Sections: []Section{
+				{Heading: LineHeading2("Usage"), Level: 2, Title: "Usage", Anchor: "usage", Line: 4,
+					Body: Text{
+						LinePreformattingToggle(""),
+						LinePreformattedText("# not a heading"),
+						LinePreformattingToggle(""),
+					},
+					Sections: []Section{
+						{Heading: LineHeading3("Install"), Level: 3, Title: "Install", Anchor: "install", Line: 8,
+							Body: Text{LineText("Steps")}},
+					},
+				},
+			},
+		},
+		{Heading: LineHeading1(""), Level: 1, Line: 10, Sections: []Section{
+			{Heading: LineHeading2("Usage"), Level: 2, Title: "Usage", Anchor: "usage-1", Line: 11},
+		}},
+	}
+	sections := SplitSections(doc)
+	if !reflect.DeepEqual(sections, want) {
+		t.Errorf("expected %+v, got %+v", want, sections)
+	}
+
+	var joined Text
+	for i := range sections {
+		joined = append(joined, sections[i].Text()...)
+	}
+	if joined.String() != doc.String() {
+		t.Errorf("expected sections to join to %q, got %q", doc.String(), joined.String())
+	}
+	if got, want := sections[1].Sections[0].Text().String(), "## Usage\n```\n# not a heading\n```\n### Install\nSteps\n"; got != want {
+		t.Errorf("expected section text %q, got %q", want, got)
+	}
+}
@@ -3,11 +3,20 @@ package gemini
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"os"
+	"runtime"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
 )
 
 // A Server defines parameters for running a Gemini server. The zero value for
@@ -18,6 +27,12 @@ type Server struct {
 	// See net.Dial for details of the address format.
 	Addr string
 
+	// ReusePort specifies whether ListenAndServe should set the
+	// SO_REUSEPORT socket option on its listener, allowing several
+	// processes to listen on the same address.
+	// See ListenReusePort for details.
+	ReusePort bool
+
 	// The Handler to invoke.
 	Handler Handler
 
@@ -43,19 +58,161 @@ type Server struct {
 	// and rotates certificates as needed.
 	GetCertificate func(hostname string) (*tls.Certificate, error)
 
+	// Certificates optionally specifies a certificate store used to
+	// retrieve TLS certificates if GetCertificate is nil.
+	// Hostnames of patterns registered with Handle and HandleFunc
+	// are registered as certificate scopes in the store. If Handler
+	// is a *Mux, the hostnames of its patterns are also registered
+	// when the server starts serving TLS connections.
+	Certificates *certificate.Store
+
+	// VerifyClientCertificate, if not nil, is called to verify the
+	// certificate presented by the client, if any. Only the leaf
+	// certificate is provided, without the intermediate certificates
+	// sent by the client.
+	// If it returns a non-nil error, the server responds with
+	// "62 Certificate not valid" and a meta describing the error,
+	// and the Handler is not invoked.
+	//
+	// Verification is performed after the TLS handshake has completed
+	// and the request has been read, so that the client receives a
+	// Gemini response instead of an aborted handshake.
+	//
+	// See ClientCertificateVerifier for an implementation that checks
+	// validity periods and certificate authorities.
+	VerifyClientCertificate func(cert *x509.Certificate) error
+
+	// StrictValidation specifies whether requests are checked for
+	// conformance with the Gemini specification. If true, requests whose
+	// URL is not valid UTF-8, has no scheme, or contains userinfo or a
+	// fragment are rejected in the same way as requests that cannot be
+	// read. See BadRequestStatus.
+	StrictValidation bool
+
+	// AllowProxying specifies whether the server passes proxy requests
+	// to Handler. A request is a proxy request if its URL scheme is
+	// not "gemini" or "titan", or if its hostname is not one of the
+	// server's hosts. If AllowProxying is false, proxy requests are
+	// answered with "53 Proxy request refused".
+	AllowProxying bool
+
+	// Hosts optionally lists the hostnames served by the server. Wildcard
+	// patterns of the form "*.example.com" match any subdomain of
+	// example.com. If Hosts is empty, the server's only host is the
+	// server name sent by the client in the TLS handshake, and requests
+	// on connections without a server name are never proxy requests.
+	Hosts []string
+
+	// UnhandledStatus and UnhandledMeta specify the response header sent
+	// when Handler is nil. If UnhandledStatus is zero, "51 Not found" is
+	// sent. If only UnhandledMeta is empty, the text for the status code
+	// is used as the meta.
+	UnhandledStatus Status
+	UnhandledMeta   string
+
+	// BadRequestStatus and BadRequestMeta specify the response header
+	// sent when the request cannot be read. If BadRequestStatus is zero,
+	// "59 Bad request" is sent. If only BadRequestMeta is empty, the text
+	// for the status code is used as the meta.
+	BadRequestStatus Status
+	BadRequestMeta   string
+
+	// EmptyResponseStatus and EmptyResponseMeta specify the response
+	// header sent when the handler returns or closes the response without
+	// writing a header.
+	// If EmptyResponseStatus is zero, "40 Temporary failure" is sent.
+	// If only EmptyResponseMeta is empty, the text for the status code
+	// is used as the meta.
+	EmptyResponseStatus Status
+	EmptyResponseMeta   string
+
+	// ShutdownGracePeriod is the maximum duration that Shutdown waits for
+	// active connections to finish. After the grace period has elapsed,
+	// remaining connections that have not yet sent a response header are
+	// sent "41 Server unavailable", and all remaining connections are closed.
+	//
+	// A ShutdownGracePeriod of zero means Shutdown waits indefinitely.
+	ShutdownGracePeriod time.Duration
+
 	// ErrorLog specifies an optional logger for errors accepting connections,
-	// unexpected behavior from handlers, and underlying file system errors.
-	// If nil, logging is done via the log package's standard logger.
+	// TLS handshake failures, handler panics, slow requests, unexpected
+	// behavior from handlers, and underlying file system errors.
+	// It is not used if Logger is set.
+	// If nil, logging is done via the log package's standard logger, so
+	// that TLS handshake failures, such as those of clients that reject
+	// the server's certificate, are logged by default.
 	ErrorLog interface {
 		Printf(format string, v ...interface{})
 	}
 
-	listeners map[*net.Listener]context.CancelFunc
-	conns     map[*net.Conn]context.CancelFunc
-	closed    bool // true if Close or Shutdown called
-	shutdown  bool // true if Shutdown called
-	doneChan  chan struct{}
-	mu        sync.Mutex
+	// Logger optionally specifies a structured logger for server events
+	// such as errors accepting connections, TLS handshake failures,
+	// handler panics and slow requests. If Logger is not nil, it is used
+	// instead of ErrorLog.
+	Logger Logger
+
+	// SlowRequestThreshold is the duration after which a request is
+	// considered slow. Requests whose handlers take longer than this
+	// duration are logged.
+	//
+	// A SlowRequestThreshold of zero means requests are never logged
+	// as slow.
+	SlowRequestThreshold time.Duration
+
+	// ConnState specifies an optional callback function that is
+	// called when a client connection changes state. See the
+	// ConnState type and associated constants for details.
+	ConnState func(net.Conn, ConnState)
+
+	listeners  map[*net.Listener]context.CancelFunc
+	conns      map[*net.Conn]*activeConn
+	closed     bool // true if Close or Shutdown called
+	shutdown   bool // true if Shutdown called
+	doneChan   chan struct{}
+	onShutdown []func()
+	mu         sync.Mutex
+}
+
+// A ConnState represents the state of a client connection to a server.
+// It's used by the optional Server.ConnState hook.
+type ConnState int
+
+const (
+	// StateNew represents a new connection that is expected to
+	// send a request immediately. Connections begin at this
+	// state and then transition to either StateHandshaking or
+	// StateClosed.
+	StateNew ConnState = iota
+
+	// StateHandshaking represents a connection that is performing
+	// the TLS handshake. Connections transition from StateHandshaking
+	// to either StateActive or StateClosed.
+	StateHandshaking
+
+	// StateActive represents a connection that has completed the
+	// TLS handshake and is reading the request or writing the response.
+	// Connections transition from StateActive to StateClosed.
+	StateActive
+
+	// StateClosed represents a closed connection.
+	// This is a terminal state.
+	StateClosed
+
+	// StateHijacked represents a hijacked connection.
+	// This is a terminal state. It does not transition to StateClosed.
+	StateHijacked
+)
+
+var stateName = map[ConnState]string{
+	StateNew:         "new",
+	StateHandshaking: "handshaking",
+	StateActive:      "active",
+	StateClosed:      "closed",
+	StateHijacked:    "hijacked",
+}
+
+func (c ConnState) String() string {
+	return stateName[c]
 }
 
 func (srv *Server) isClosed() bool {
@@ -101,9 +258,26 @@ func (srv *Server) tryCloseDoneLocked() {
 	}
 }
 
+// RegisterOnShutdown registers a function to call on Shutdown or Close.
+// This can be used to release resources such as database connections,
+// flush caches, or deregister the server from service discovery.
+// Each function is called in its own goroutine and is not waited for.
+func (srv *Server) RegisterOnShutdown(f func()) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.onShutdown = append(srv.onShutdown, f)
+}
+
+func (srv *Server) runOnShutdownLocked() {
+	for _, f := range srv.onShutdown {
+		go f()
+	}
+}
+
 // Close immediately closes all active net.Listeners and connections.
 // For a graceful shutdown, use Shutdown.
 func (srv *Server) Close() error {
+	var conns []*activeConn
 	srv.mu.Lock()
 	{
 		if srv.closed {
@@ -113,17 +287,20 @@ func (srv *Server) Close() error {
 		srv.closed = true
 
 		srv.tryCloseDoneLocked()
+		srv.runOnShutdownLocked()
 
 		// Close all active connections and listeners.
 		for _, cancel := range srv.listeners {
 			cancel()
 		}
-		for _, cancel := range srv.conns {
-			cancel()
-		}
+		conns = srv.untrackConnsLocked(func(*activeConn) bool { return true })
 	}
 	srv.mu.Unlock()
 
+	for _, c := range conns {
+		c.close()
+	}
+
 	select {
 	case <-srv.done():
 		return nil
@@ -153,6 +330,7 @@ func (srv *Server) Shutdown(ctx context.Context) error {
 		srv.shutdown = true
 
 		srv.tryCloseDoneLocked()
+		srv.runOnShutdownLocked()
 
 		// Close all active listeners.
 		for _, cancel := range srv.listeners {
@@ -162,6 +340,22 @@ func (srv *Server) Shutdown(ctx context.Context) error {
 	srv.mu.Unlock()
 
 	// Wait for active connections to finish.
+	var grace <-chan time.Time
+	if d := srv.ShutdownGracePeriod; d != 0 {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		grace = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-srv.done():
+		return nil
+	case <-grace:
+	}
+
+	// Abort remaining connections and wait for them to close.
+	srv.abortConns()
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -170,6 +364,21 @@ func (srv *Server) Shutdown(ctx context.Context) error {
 	}
 }
 
+// abortConns sends "41 Server unavailable" on all active connections that
+// have not yet sent a response header and then closes them.
+func (srv *Server) abortConns() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for conn, c := range srv.conns {
+		go func(conn *net.Conn, c *activeConn) {
+			c.w.abort(StatusServerUnavailable, "Server unavailable")
+			c.close()
+			srv.deleteConn(conn)
+			srv.tryCloseDone()
+		}(conn, c)
+	}
+}
+
 // ListenAndServe listens for requests at the server's configured address.
 // ListenAndServe listens on the TCP network address srv.Addr and then calls
 // Serve to handle requests on incoming connections. If the provided
@@ -189,26 +398,230 @@ func (srv *Server) ListenAndServe(ctx context.Context) error {
 		addr = ":1965"
 	}
 
-	l, err := net.Listen("tcp", addr)
+	var l net.Listener
+	var err error
+	if srv.ReusePort {
+		l, err = ListenReusePort("tcp", addr)
+	} else {
+		l, err = net.Listen("tcp", addr)
+	}
 	if err != nil {
 		return err
 	}
 
-	l = tls.NewListener(l, &tls.Config{
-		ClientAuth:     tls.RequestClientCert,
-		MinVersion:     tls.VersionTLS12,
-		GetCertificate: srv.getCertificate,
+	return srv.ServeTLS(ctx, l)
+}
+
+// ServeTLS accepts incoming connections on the Listener l, performing
+// a TLS handshake with each connection using the server's certificates,
+// and then serves them as described in Serve.
+//
+// ServeTLS can be used to serve connections on a listener inherited from
+// another process:
+//
+//	f := os.NewFile(3, "listener")
+//	l, err := net.FileListener(f)
+//	if err != nil {
+//		// handle error
+//	}
+//	err = server.ServeTLS(ctx, l)
+//
+// ServeTLS always closes l and returns a non-nil error.
+// After Shutdown or Close, the returned error is context.Canceled.
+func (srv *Server) ServeTLS(ctx context.Context, l net.Listener) error {
+	srv.registerCertificateScopes()
+	return srv.Serve(ctx, &tlsListener{
+		Listener: l,
+		config: &tls.Config{
+			ClientAuth:     tls.RequestClientCert,
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: srv.getCertificate,
+		},
 	})
-	return srv.Serve(ctx, l)
+}
+
+// registerCertificateScopes registers the hostnames of the patterns of
+// the server's Mux, if any, as scopes in the server's certificate store.
+func (srv *Server) registerCertificateScopes() {
+	if srv.Certificates == nil {
+		return
+	}
+	mux, ok := srv.Handler.(*Mux)
+	if !ok {
+		return
+	}
+	for _, host := range mux.Hosts() {
+		srv.Certificates.Register(host)
+	}
+}
+
+// tlsListener is like the listener returned by tls.NewListener,
+// except that it exposes the file of the underlying listener.
+type tlsListener struct {
+	net.Listener
+	config *tls.Config
+}
+
+func (l *tlsListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return tls.Server(c, l.config), nil
+}
+
+func (l *tlsListener) File() (*os.File, error) {
+	return listenerFile(l.Listener)
+}
+
+// listenerFile returns a copy of the file underlying the listener.
+func listenerFile(l net.Listener) (*os.File, error) {
+	if f, ok := l.(interface{ File() (*os.File, error) }); ok {
+		return f.File()
+	}
+	return nil, fmt.Errorf("gemini: listener %T does not provide a file", l)
+}
+
+// ListenerFiles returns copies of the files underlying the server's
+// active listeners. It can be used to hand the listening sockets over to
+// another process, for example a new version of the program, which can
+// then serve them with ServeTLS while this server drains its remaining
+// connections with Shutdown. It is the caller's responsibility to close
+// the returned files.
+//
+// ListenerFiles returns an error if any of the listeners does not provide
+// a file, as is the case for listeners not created by package net.
+func (srv *Server) ListenerFiles() ([]*os.File, error) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	var files []*os.File
+	for l := range srv.listeners {
+		f, err := listenerFile(*l)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// ActiveConns returns the number of connections currently being served.
+func (srv *Server) ActiveConns() int {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return len(srv.conns)
 }
 
 func (srv *Server) getCertificate(h *tls.ClientHelloInfo) (*tls.Certificate, error) {
 	if srv.GetCertificate == nil {
+		if srv.Certificates != nil {
+			return srv.Certificates.Get(h.ServerName)
+		}
 		return nil, errors.New("gemini: GetCertificate is nil")
 	}
 	return srv.GetCertificate(h.ServerName)
 }
 
+// Handle registers the handler for the given pattern.
+// It is a shorthand for registering the handler with a Mux used as the
+// server's Handler. If the server's Handler is nil, Handle creates a new
+// Mux and uses it as the Handler. Handle panics if the server's Handler
+// is not a *Mux. See Mux for details of the pattern format.
+//
+// If the pattern begins with a hostname and Certificates is not nil,
+// the hostname is also registered as a certificate scope.
+//
+// Handle should not be called concurrently with serving requests.
+func (srv *Server) Handle(pattern string, handler Handler, mws ...Middleware) {
+	if srv.Handler == nil {
+		srv.Handler = &Mux{}
+	}
+	mux, ok := srv.Handler.(*Mux)
+	if !ok {
+		panic("gemini: Server.Handle called with a Handler that is not a *Mux")
+	}
+	mux.Handle(pattern, handler, mws...)
+	if host, _, _ := splitPattern(pattern); host != "" && srv.Certificates != nil {
+		srv.Certificates.Register(normalizeHost(host))
+	}
+}
+
+// HandleFunc registers the handler function for the given pattern.
+// See Handle for details.
+func (srv *Server) HandleFunc(pattern string, handler HandlerFunc, mws ...Middleware) {
+	srv.Handle(pattern, handler, mws...)
+}
+
+func (srv *Server) verifyClientCertificate(r *Request) error {
+	if srv.VerifyClientCertificate == nil {
+		return nil
+	}
+	tls := r.TLS()
+	if tls == nil || len(tls.PeerCertificates) == 0 {
+		return nil
+	}
+	return srv.VerifyClientCertificate(tls.PeerCertificates[0])
+}
+
+// certificateErrorMeta returns a response meta describing the provided
+// certificate verification error.
+func certificateErrorMeta(err error) string {
+	reason := strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, err.Error())
+	meta := "Certificate not valid: " + reason
+	if len(meta) > 1024 {
+		// Do not cut a multi-byte character in half
+		n := 1024
+		for n > 0 && !utf8.RuneStart(meta[n]) {
+			n--
+		}
+		meta = meta[:n]
+	}
+	return meta
+}
+
+// ClientCertificateVerifier returns a function suitable for use in
+// a Server's VerifyClientCertificate field. The returned function
+// reports an error if the certificate has expired or is not yet valid.
+// If roots is not nil, it also reports an error if the certificate
+// is not signed by one of the provided certificate authorities.
+//
+// Intermediate certificates sent by the client are not used to build
+// the chain, since they are not provided to VerifyClientCertificate.
+// Client certificates must therefore be signed directly by one of the
+// roots, or the intermediate certificates must be added to roots.
+func ClientCertificateVerifier(roots *x509.CertPool) func(*x509.Certificate) error {
+	return func(cert *x509.Certificate) error {
+		now := time.Now()
+		if now.After(cert.NotAfter) {
+			return errors.New("expired")
+		}
+		if now.Before(cert.NotBefore) {
+			return errors.New("not yet valid")
+		}
+		if roots == nil {
+			return nil
+		}
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:       roots,
+			CurrentTime: now,
+			KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		})
+		var unknown x509.UnknownAuthorityError
+		if errors.As(err, &unknown) {
+			return errors.New("unknown certificate authority")
+		}
+		return err
+	}
+}
+
 func (srv *Server) trackListener(l *net.Listener, cancel context.CancelFunc) bool {
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
@@ -233,6 +646,12 @@ func (srv *Server) deleteListener(l *net.Listener) {
 // then call the appropriate Handler to reply to them. If the provided
 // context expires, Serve closes l and returns the context's error.
 //
+// Serve does not perform TLS handshakes; to serve Gemini over TLS, use
+// ServeTLS. Serve can be used directly when TLS is terminated by a
+// fronting proxy or when l already returns TLS connections. Requests
+// served over plaintext connections have no client certificates, and
+// their TLS method returns nil.
+//
 // Serve always closes l and returns a non-nil error.
 // After Shutdown or Close, the returned error is context.Canceled.
 func (srv *Server) Serve(ctx context.Context, l net.Listener) error {
@@ -249,11 +668,16 @@ func (srv *Server) Serve(ctx context.Context, l net.Listener) error {
 
 	errch := make(chan error, 1)
 	go func() {
-		errch <- srv.serve(ctx, l)
+		errch <- srv.serve(context.WithValue(ctx, listenerAddrContextKey, l.Addr()), l)
 	}()
 
 	select {
 	case <-lnctx.Done():
+		if ctx.Err() != nil {
+			// Connections are not watched individually, so close
+			// the connections whose context has expired here.
+			srv.closeExpiredConns()
+		}
 		return lnctx.Err()
 	case err := <-errch:
 		return err
@@ -275,7 +699,7 @@ func (srv *Server) serve(ctx context.Context, l net.Listener) error {
 				if max := 1 * time.Second; tempDelay > max {
 					tempDelay = max
 				}
-				srv.logf("gemini: Accept error: %v; retrying in %v", err, tempDelay)
+				srv.logError("accept error", "err", err, "retry", tempDelay)
 				time.Sleep(tempDelay)
 				continue
 			}
@@ -286,7 +710,61 @@ func (srv *Server) serve(ctx context.Context, l net.Listener) error {
 	}
 }
 
-func (srv *Server) trackConn(conn *net.Conn, cancel context.CancelFunc, external bool) bool {
+var (
+	// serverContextKey is the context key for the Server that
+	// is serving a request.
+	serverContextKey = &contextKey{"gemini-server"}
+
+	// listenerAddrContextKey is the context key for the address
+	// of the listener on which a connection was accepted.
+	listenerAddrContextKey = &contextKey{"listener-addr"}
+
+	// localAddrContextKey is the context key for the local address
+	// of the connection on which a request was received.
+	localAddrContextKey = &contextKey{"local-addr"}
+)
+
+// ServerFromContext returns the Server that is serving the request
+// associated with ctx, or nil if there is none.
+func ServerFromContext(ctx context.Context) *Server {
+	srv, _ := ctx.Value(serverContextKey).(*Server)
+	return srv
+}
+
+// ListenerAddrFromContext returns the address of the listener on which
+// the connection associated with ctx was accepted. It returns nil for
+// connections served with ServeConn.
+func ListenerAddrFromContext(ctx context.Context) net.Addr {
+	addr, _ := ctx.Value(listenerAddrContextKey).(net.Addr)
+	return addr
+}
+
+// LocalAddrFromContext returns the local address of the connection on
+// which the request associated with ctx was received, or nil if it is
+// unknown.
+func LocalAddrFromContext(ctx context.Context) net.Addr {
+	addr, _ := ctx.Value(localAddrContextKey).(net.Addr)
+	return addr
+}
+
+// An activeConn represents a connection that is being served.
+type activeConn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	conn   net.Conn
+	w      *responseWriter
+}
+
+// close cancels the connection's context and closes the connection,
+// interrupting any pending reads and writes.
+func (c *activeConn) close() {
+	c.cancel()
+	if c.w.preventHijack() {
+		c.conn.Close()
+	}
+}
+
+func (srv *Server) trackConn(conn *net.Conn, c *activeConn, external bool) bool {
 	srv.mu.Lock()
 	defer srv.mu.Unlock()
 	// Reject the connection under the following conditions:
@@ -296,9 +774,9 @@ func (srv *Server) trackConn(conn *net.Conn, cancel context.CancelFunc, external
 		return false
 	}
 	if srv.conns == nil {
-		srv.conns = make(map[*net.Conn]context.CancelFunc)
+		srv.conns = make(map[*net.Conn]*activeConn)
 	}
-	srv.conns[conn] = cancel
+	srv.conns[conn] = c
 	return true
 }
 
@@ -308,26 +786,91 @@ func (srv *Server) deleteConn(conn *net.Conn) {
 	delete(srv.conns, conn)
 }
 
+// untrackConnsLocked stops tracking the connections for which f returns
+// true and returns them. The caller is responsible for closing them.
+func (srv *Server) untrackConnsLocked(f func(*activeConn) bool) []*activeConn {
+	var conns []*activeConn
+	for conn, c := range srv.conns {
+		if f(c) {
+			conns = append(conns, c)
+			delete(srv.conns, conn)
+		}
+	}
+	return conns
+}
+
+// closeExpiredConns closes the connections whose context has expired.
+func (srv *Server) closeExpiredConns() {
+	srv.mu.Lock()
+	conns := srv.untrackConnsLocked(func(c *activeConn) bool {
+		return c.ctx.Err() != nil
+	})
+	srv.tryCloseDoneLocked()
+	srv.mu.Unlock()
+
+	for _, c := range conns {
+		c.close()
+	}
+}
+
 // ServeConn serves a Gemini response over the provided connection.
 // It closes the connection when the response has been completed.
+// Like Serve, ServeConn does not perform a TLS handshake unless conn is
+// a *tls.Conn, so it can serve in-process connections such as those
+// returned by net.Pipe.
 // If the provided context expires before the response has completed,
-// ServeConn closes the connection and returns the context's error.
+// ServeConn closes the connection, waits for the handler to return and
+// returns the context's error.
 func (srv *Server) ServeConn(ctx context.Context, conn net.Conn) error {
 	return srv.serveConn(ctx, conn, true)
 }
 
-func (srv *Server) serveConn(ctx context.Context, conn net.Conn, external bool) error {
-	defer conn.Close()
-
-	ctx, cancel := context.WithCancel(ctx)
+func (srv *Server) serveConn(parent context.Context, conn net.Conn, external bool) error {
+	ctx, cancel := context.WithCancel(parent)
 	defer cancel()
+	ctx = context.WithValue(ctx, serverContextKey, srv)
+	ctx = context.WithValue(ctx, localAddrContextKey, conn.LocalAddr())
 
-	if !srv.trackConn(&conn, cancel, external) {
+	// The handler context is also canceled when reading
+	// the request or writing the response fails.
+	hctx, hcancel := context.WithCancel(ctx)
+	done := hctx.Done()
+	cw := &contextWriter{
+		ctx:    hctx,
+		done:   done,
+		cancel: hcancel,
+		wc:     conn,
+	}
+	r := &contextReader{
+		ctx:    hctx,
+		done:   done,
+		cancel: hcancel,
+		rc:     conn,
+	}
+	w := newResponseWriter(cw)
+	w.conn = conn
+	w.warn = srv.logWarn
+	w.emptyStatus = srv.EmptyResponseStatus
+	w.emptyMeta = srv.EmptyResponseMeta
+
+	c := &activeConn{ctx, cancel, conn, w}
+	if !srv.trackConn(&conn, c, external) {
+		conn.Close()
 		return context.Canceled
 	}
 	defer srv.tryCloseDone()
 	defer srv.deleteConn(&conn)
 
+	srv.setState(conn, StateNew)
+	defer func() {
+		if w.isHijacked() {
+			srv.setState(conn, StateHijacked)
+			return
+		}
+		conn.Close()
+		srv.setState(conn, StateClosed)
+	}()
+
 	if d := srv.ReadTimeout; d != 0 {
 		conn.SetReadDeadline(time.Now().Add(d))
 	}
@@ -335,54 +878,217 @@ func (srv *Server) serveConn(ctx context.Context, conn net.Conn, external bool)
 		conn.SetWriteDeadline(time.Now().Add(d))
 	}
 
-	errch := make(chan error, 1)
-	go func() {
-		errch <- srv.goServeConn(ctx, conn)
-	}()
+	// Connections accepted by Serve are closed by Serve when their
+	// context expires. Connections passed to ServeConn are watched
+	// here, unless their context can never expire.
+	if external && parent.Done() != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.close()
+			case <-stop:
+			}
+		}()
+	}
 
-	select {
-	case <-ctx.Done():
+	err := srv.handleConn(hctx, hcancel, conn, r, w)
+	if ctx.Err() != nil {
 		return ctx.Err()
-	case err := <-errch:
-		return err
 	}
+	return err
 }
 
-func (srv *Server) goServeConn(ctx context.Context, conn net.Conn) error {
-	ctx, cancel := context.WithCancel(ctx)
-	done := ctx.Done()
-	cw := &contextWriter{
-		ctx:    ctx,
-		done:   done,
-		cancel: cancel,
-		wc:     conn,
-	}
-	r := &contextReader{
-		ctx:    ctx,
-		done:   done,
-		cancel: cancel,
-		rc:     conn,
-	}
+func (srv *Server) handleConn(ctx context.Context, cancel context.CancelFunc, conn net.Conn, r io.Reader, w *responseWriter) error {
+	defer w.release()
 
-	w := newResponseWriter(cw)
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		srv.setState(conn, StateHandshaking)
+		if err := tlsConn.Handshake(); err != nil {
+			srv.logWarn("TLS handshake error", "remote", conn.RemoteAddr(), "err", err)
+			return err
+		}
+	}
+	srv.setState(conn, StateActive)
 
 	req, err := ReadRequest(r)
+	if err == nil && srv.StrictValidation {
+		err = validateStrict(req)
+	}
 	if err != nil {
-		w.WriteHeader(StatusBadRequest, "Bad request")
+		w.WriteHeader(failureHeader(srv.BadRequestStatus, srv.BadRequestMeta, StatusBadRequest))
 		return w.Flush()
 	}
 	req.conn = conn
 
+	if err := srv.verifyClientCertificate(req); err != nil {
+		w.WriteHeader(StatusCertificateNotValid, certificateErrorMeta(err))
+		return w.Flush()
+	}
+
+	if !srv.AllowProxying && srv.isProxyRequest(req) {
+		w.WriteHeader(StatusProxyRequestRefused, "Proxy request refused")
+		return w.Flush()
+	}
+
 	h := srv.Handler
 	if h == nil {
-		w.WriteHeader(StatusNotFound, "Not found")
+		w.WriteHeader(failureHeader(srv.UnhandledStatus, srv.UnhandledMeta, StatusNotFound))
 		return w.Flush()
 	}
 
-	h.ServeGemini(ctx, w, req)
+	if req.Body == nil {
+		// Cancel the handler context if the client goes away while
+		// the response is being streamed. Titan request bodies are
+		// read by the handler.
+		w.checkClient = func() {
+			if clientGone(conn) {
+				cancel()
+			}
+		}
+	}
+
+	srv.serveGemini(ctx, h, w, req)
+	if w.isHijacked() {
+		return nil
+	}
+	if !w.Written() {
+		w.WriteHeader(w.emptyHeader())
+	}
 	return w.Flush()
 }
 
+// aLongTimeAgo is a non-zero time, far in the past, used to interrupt
+// pending reads and writes.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// clientProbeTimeout is the time for which clientGone waits for data
+// from the client.
+const clientProbeTimeout = 100 * time.Microsecond
+
+// clientGone reports whether the client has reset the connection or sent
+// unexpected data after the request, waiting at most clientProbeTimeout.
+// A client that closed its side of the connection after sending the
+// request may still be reading the response, so io.EOF is not considered
+// a disconnect; writing to a client that closed the connection fails
+// instead. Any data sent by the client is discarded.
+func clientGone(conn net.Conn) bool {
+	conn.SetReadDeadline(time.Now().Add(clientProbeTimeout))
+	// The request has been read, so the read deadline no longer applies
+	defer conn.SetReadDeadline(time.Time{})
+	var b [1]byte
+	n, err := conn.Read(b[:])
+	if n > 0 {
+		return true
+	}
+	if err == nil || err == io.EOF {
+		return false
+	}
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return false
+	}
+	return true
+}
+
+// isProxyRequest reports whether the request is for a URL that is not
+// served by the server.
+func (srv *Server) isProxyRequest(r *Request) bool {
+	if r.URL.Scheme != "gemini" && r.URL.Scheme != "titan" {
+		return true
+	}
+	host := strings.ToLower(r.URL.Hostname())
+	if len(srv.Hosts) == 0 {
+		name := r.ServerName()
+		return name != "" && !strings.EqualFold(name, host)
+	}
+	wildcard, _ := getWildcard(host)
+	for _, h := range srv.Hosts {
+		// IPv6 addresses may be written in brackets
+		h = strings.ToLower(strings.TrimSuffix(strings.TrimPrefix(h, "["), "]"))
+		if h == host || (wildcard != "" && h == wildcard) {
+			return false
+		}
+	}
+	return true
+}
+
+// failureHeader returns the status code and meta to send for a
+// configurable failure response. If status is zero, def and its text
+// are returned. If meta is empty, the text for status is used.
+func failureHeader(status Status, meta string, def Status) (Status, string) {
+	if status == 0 {
+		return def, def.String()
+	}
+	if meta == "" {
+		meta = status.String()
+	}
+	return status, meta
+}
+
+// serveGemini calls h.ServeGemini, recovering from any panics.
+// If the handler panics, the panic and its stack trace are logged
+// and a temporary failure is sent if no header has been written yet.
+func (srv *Server) serveGemini(ctx context.Context, h Handler, w ResponseWriter, r *Request) {
+	start := time.Now()
+	defer func() {
+		if err := recover(); err != nil {
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			srv.logError("panic serving request", "remote", r.conn.RemoteAddr(), "url", r.URL, "err", err, "stack", string(buf))
+			w.WriteHeader(StatusTemporaryFailure, "Temporary failure")
+		}
+		if d := srv.SlowRequestThreshold; d != 0 {
+			if elapsed := time.Since(start); elapsed > d {
+				srv.logWarn("slow request", "remote", r.conn.RemoteAddr(), "url", r.URL, "duration", elapsed)
+			}
+		}
+	}()
+	h.ServeGemini(ctx, w, r)
+}
+
+func (srv *Server) setState(conn net.Conn, state ConnState) {
+	if hook := srv.ConnState; hook != nil {
+		hook(conn, state)
+	}
+}
+
+// Logger is the interface used by a Server for structured logging.
+// Each method logs a message with a list of alternating keys and values.
+// It is satisfied by *slog.Logger.
+type Logger interface {
+	Error(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+}
+
+func (srv *Server) logError(msg string, args ...interface{}) {
+	if srv.Logger != nil {
+		srv.Logger.Error(msg, args...)
+		return
+	}
+	srv.logf("%s", formatLog(msg, args))
+}
+
+func (srv *Server) logWarn(msg string, args ...interface{}) {
+	if srv.Logger != nil {
+		srv.Logger.Warn(msg, args...)
+		return
+	}
+	srv.logf("%s", formatLog(msg, args))
+}
+
+// formatLog formats a structured log message for use with ErrorLog.
+func formatLog(msg string, args []interface{}) string {
+	var b strings.Builder
+	b.WriteString("gemini: ")
+	b.WriteString(msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	return b.String()
+}
+
 func (srv *Server) logf(format string, args ...interface{}) {
 	if srv.ErrorLog != nil {
 		srv.ErrorLog.Printf(format, args...)
@@ -0,0 +1,888 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"git.sr.ht/~adnano/go-gemini/certificate"
+)
+
+func TestServerConnState(t *testing.T) {
+	var mu sync.Mutex
+	var states []ConnState
+	srv := &Server{
+		Handler: StatusHandler(StatusSuccess, "text/gemini"),
+		ConnState: func(conn net.Conn, state ConnState) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, state)
+		},
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte("gemini://example.com\r\n"))
+		ioutil.ReadAll(client)
+		client.Close()
+	}()
+	if err := srv.ServeConn(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []ConnState{StateNew, StateActive, StateClosed}
+	if !reflect.DeepEqual(states, want) {
+		t.Errorf("expected states %v, got %v", want, states)
+	}
+}
+
+func TestServerHijack(t *testing.T) {
+	var state ConnState
+	hijacked := make(chan net.Conn, 1)
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.WriteHeader(StatusSuccess, "text/plain")
+			conn, err := w.(Hijacker).Hijack()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := w.Write([]byte("body")); err != ErrHijacked {
+				t.Errorf("expected ErrHijacked from Write, got %v", err)
+			}
+			if _, err := w.(Hijacker).Hijack(); err != ErrHijacked {
+				t.Errorf("expected ErrHijacked from Hijack, got %v", err)
+			}
+			hijacked <- conn
+		}),
+		ConnState: func(conn net.Conn, s ConnState) {
+			state = s
+		},
+	}
+
+	client, server := net.Pipe()
+	resp := make(chan []byte, 1)
+	go func() {
+		client.Write([]byte("gemini://example.com\r\n"))
+		b, _ := ioutil.ReadAll(client)
+		client.Close()
+		resp <- b
+	}()
+	if err := srv.ServeConn(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+	if state != StateHijacked {
+		t.Errorf("expected state %v, got %v", StateHijacked, state)
+	}
+
+	// The connection remains open after ServeConn returns
+	conn := <-hijacked
+	conn.Write([]byte("raw data"))
+	conn.Close()
+
+	const want = "20 text/plain\r\nraw data"
+	if got := string(<-resp); got != want {
+		t.Errorf("expected response %q, got %q", want, got)
+	}
+}
+
+func TestServerClientDisconnect(t *testing.T) {
+	canceled := make(chan struct{})
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.WriteHeader(StatusSuccess, "text/plain")
+			timeout := time.After(5 * time.Second)
+			for {
+				select {
+				case <-ctx.Done():
+					close(canceled)
+					return
+				case <-timeout:
+					t.Error("handler context was not canceled")
+					return
+				default:
+				}
+				w.Write([]byte("data\n"))
+				w.Flush()
+			}
+		}),
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte("gemini://example.com\r\n"))
+		b := make([]byte, len("20 text/plain\r\n"))
+		client.Read(b)
+		client.Close()
+	}()
+	srv.ServeConn(context.Background(), server)
+	select {
+	case <-canceled:
+	default:
+		t.Error("expected handler context to be canceled")
+	}
+}
+
+func TestServerClientUnexpectedData(t *testing.T) {
+	canceled := make(chan struct{})
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.WriteHeader(StatusSuccess, "text/plain")
+			timeout := time.After(5 * time.Second)
+			for {
+				w.Flush()
+				select {
+				case <-ctx.Done():
+					close(canceled)
+					return
+				case <-timeout:
+					t.Error("handler context was not canceled")
+					return
+				case <-time.After(time.Millisecond):
+				}
+			}
+		}),
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte("gemini://example.com\r\n"))
+		go ioutil.ReadAll(client)
+		client.Write([]byte("unexpected"))
+	}()
+	srv.ServeConn(context.Background(), server)
+	client.Close()
+	select {
+	case <-canceled:
+	default:
+		t.Error("expected handler context to be canceled")
+	}
+}
+
+func TestServerClientHalfClose(t *testing.T) {
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.WriteHeader(StatusSuccess, "text/plain")
+			w.Flush()
+			// Give the client time to close its side of the connection
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte("hello"))
+			w.Flush()
+			if ctx.Err() != nil {
+				t.Errorf("expected handler context not to be canceled, got %v", ctx.Err())
+			}
+			w.Write([]byte(", world"))
+		}),
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(context.Background(), l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("gemini://example.com\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "20 text/plain\r\nhello, world"; string(b) != want {
+		t.Errorf("expected response %q, got %q", want, b)
+	}
+}
+
+func TestResponseWriterClose(t *testing.T) {
+	returned := make(chan struct{})
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			defer close(returned)
+			w.Write([]byte("hello"))
+			if err := w.Close(); err != nil {
+				t.Error(err)
+			}
+			if _, err := w.Write([]byte("world")); err != ErrResponseClosed {
+				t.Errorf("expected ErrResponseClosed, got %v", err)
+			}
+		}),
+	}
+
+	client, server := net.Pipe()
+	resp := make(chan []byte, 1)
+	go func() {
+		client.Write([]byte("gemini://example.com\r\n"))
+		b, _ := ioutil.ReadAll(client)
+		client.Close()
+		resp <- b
+	}()
+	srv.ServeConn(context.Background(), server)
+	<-returned
+
+	const want = "20 text/gemini\r\nhello"
+	if got := string(<-resp); got != want {
+		t.Errorf("expected response %q, got %q", want, got)
+	}
+}
+
+func TestClientCertificateVerifier(t *testing.T) {
+	verify := ClientCertificateVerifier(nil)
+
+	valid, err := certificate.Create(certificate.CreateOptions{
+		Duration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(valid.Leaf); err != nil {
+		t.Errorf("expected valid certificate, got %v", err)
+	}
+
+	expired, err := certificate.Create(certificate.CreateOptions{
+		Duration: -time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify(expired.Leaf); err == nil {
+		t.Errorf("expected error for expired certificate")
+	}
+
+	verify = ClientCertificateVerifier(x509.NewCertPool())
+	if err := verify(valid.Leaf); err == nil {
+		t.Errorf("expected error for unknown certificate authority")
+	}
+}
+
+func TestServerVerifyClientCertificate(t *testing.T) {
+	serverCert, err := certificate.Create(certificate.CreateOptions{
+		DNSNames: []string{"example.com"},
+		Duration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := certificate.Create(certificate.CreateOptions{
+		Duration: -time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	called := false
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			called = true
+		}),
+		VerifyClientCertificate: ClientCertificateVerifier(nil),
+	}
+	client, server := net.Pipe()
+	resp := make(chan []byte, 1)
+	go func() {
+		conn := tls.Client(client, &tls.Config{
+			InsecureSkipVerify: true,
+			Certificates:       []tls.Certificate{expired},
+		})
+		conn.Write([]byte("gemini://example.com/\r\n"))
+		b, _ := ioutil.ReadAll(conn)
+		conn.Close()
+		resp <- b
+	}()
+	srv.ServeConn(context.Background(), tls.Server(server, &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequestClientCert,
+	}))
+	if got, want := string(<-resp), "62 Certificate not valid: expired\r\n"; got != want {
+		t.Errorf("expected response %q, got %q", want, got)
+	}
+	if called {
+		t.Error("expected the handler not to be called")
+	}
+}
+
+func TestCertificateErrorMeta(t *testing.T) {
+	meta := certificateErrorMeta(errors.New("bad\r\nline"))
+	if want := "Certificate not valid: bad  line"; meta != want {
+		t.Errorf("expected meta %q, got %q", want, meta)
+	}
+
+	// The prefix is 23 bytes long, so that a 1024 byte limit
+	// falls in the middle of the 2-byte characters
+	meta = certificateErrorMeta(errors.New(strings.Repeat("é", 600)))
+	if len(meta) > 1024 || !utf8.ValidString(meta) {
+		t.Errorf("expected valid UTF-8 meta of at most 1024 bytes, got %d bytes %q", len(meta), meta)
+	}
+	if want := 1023; len(meta) != want {
+		t.Errorf("expected meta of %d bytes, got %d", want, len(meta))
+	}
+}
+
+type logBuffer struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *logBuffer) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.logs = append(l.logs, fmt.Sprintf(format, v...))
+}
+
+func TestServerRecoverPanic(t *testing.T) {
+	errorLog := &logBuffer{}
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			panic("oops")
+		}),
+		ErrorLog: errorLog,
+	}
+
+	client, server := net.Pipe()
+	resp := make(chan []byte, 1)
+	go func() {
+		client.Write([]byte("gemini://example.com\r\n"))
+		b, _ := ioutil.ReadAll(client)
+		client.Close()
+		resp <- b
+	}()
+	if err := srv.ServeConn(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+
+	const want = "40 Temporary failure\r\n"
+	if got := string(<-resp); got != want {
+		t.Errorf("expected response %q, got %q", want, got)
+	}
+
+	errorLog.mu.Lock()
+	defer errorLog.mu.Unlock()
+	if len(errorLog.logs) != 1 || !strings.Contains(errorLog.logs[0], "oops") {
+		t.Errorf("expected panic to be logged, got %q", errorLog.logs)
+	}
+}
+
+// testLogger records structured log messages.
+type testLogger struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (l *testLogger) log(level, msg string, args []interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s := level + " " + msg
+	for i := 0; i+1 < len(args); i += 2 {
+		s += fmt.Sprintf(" %v", args[i])
+	}
+	l.logs = append(l.logs, s)
+}
+
+func (l *testLogger) Error(msg string, args ...interface{}) { l.log("ERROR", msg, args) }
+func (l *testLogger) Warn(msg string, args ...interface{})  { l.log("WARN", msg, args) }
+
+func TestServerLogger(t *testing.T) {
+	handler := HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		switch r.URL.Path {
+		case "/panic":
+			panic("oops")
+		case "/slow":
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	})
+	tests := []struct {
+		Path      string
+		Threshold time.Duration
+		Logs      []string
+	}{
+		{"/", 0, nil},
+		{"/slow", 0, nil},
+		{"/", time.Second, nil},
+		{"/slow", time.Millisecond, []string{"WARN slow request remote url duration"}},
+		{"/panic", 0, []string{"ERROR panic serving request remote url err stack"}},
+	}
+	for _, test := range tests {
+		logger := &testLogger{}
+		errorLog := &logBuffer{}
+		srv := &Server{
+			Handler:              handler,
+			Logger:               logger,
+			ErrorLog:             errorLog,
+			SlowRequestThreshold: test.Threshold,
+		}
+		client, server := net.Pipe()
+		go func() {
+			client.Write([]byte("gemini://example.com" + test.Path + "\r\n"))
+			ioutil.ReadAll(client)
+			client.Close()
+		}()
+		srv.ServeConn(context.Background(), server)
+		if !reflect.DeepEqual(logger.logs, test.Logs) {
+			t.Errorf("%s (threshold %v): expected logs %q, got %q", test.Path, test.Threshold, test.Logs, logger.logs)
+		}
+		if len(errorLog.logs) != 0 {
+			t.Errorf("%s: expected ErrorLog not to be used with Logger, got %q", test.Path, errorLog.logs)
+		}
+	}
+}
+
+func TestServerLogHandshakeError(t *testing.T) {
+	// Handshake errors are logged to ErrorLog by default
+	errorLog := &logBuffer{}
+	srv := &Server{Handler: &nopHandler{}, ErrorLog: errorLog}
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte("gemini://example.com/\r\n"))
+		ioutil.ReadAll(client)
+		client.Close()
+	}()
+	if err := srv.ServeConn(context.Background(), tls.Server(server, &tls.Config{})); err == nil {
+		t.Error("expected a handshake error")
+	}
+	errorLog.mu.Lock()
+	defer errorLog.mu.Unlock()
+	if len(errorLog.logs) != 1 || !strings.HasPrefix(errorLog.logs[0], "gemini: TLS handshake error remote=") {
+		t.Errorf("expected the handshake error to be logged, got %q", errorLog.logs)
+	}
+}
+
+func TestServerFailureResponses(t *testing.T) {
+	empty := HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {})
+	closed := HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.Close()
+	})
+	tests := []struct {
+		Server   *Server
+		Request  string
+		Response string
+	}{
+		{&Server{}, "bad\n", "59 Bad request\r\n"},
+		{&Server{BadRequestStatus: StatusPermanentFailure}, "bad\n", "50 Permanent failure\r\n"},
+		{&Server{}, "gemini://example.com\r\n", "51 Not found\r\n"},
+		{&Server{UnhandledStatus: StatusGone, UnhandledMeta: "Nothing here"}, "gemini://example.com\r\n", "52 Nothing here\r\n"},
+		{&Server{Handler: empty}, "gemini://example.com\r\n", "40 Temporary failure\r\n"},
+		{&Server{Handler: empty, EmptyResponseStatus: StatusNotFound}, "gemini://example.com\r\n", "51 Not found\r\n"},
+		{&Server{Handler: closed}, "gemini://example.com\r\n", "40 Temporary failure\r\n"},
+		{&Server{Handler: closed, EmptyResponseStatus: StatusGone, EmptyResponseMeta: "Closed"}, "gemini://example.com\r\n", "52 Closed\r\n"},
+	}
+
+	for _, test := range tests {
+		client, server := net.Pipe()
+		resp := make(chan []byte, 1)
+		go func() {
+			client.Write([]byte(test.Request))
+			b, _ := ioutil.ReadAll(client)
+			client.Close()
+			resp <- b
+		}()
+		test.Server.ServeConn(context.Background(), server)
+		if got := string(<-resp); got != test.Response {
+			t.Errorf("%q: expected response %q, got %q", test.Request, test.Response, got)
+		}
+	}
+}
+
+func TestServerStrictValidation(t *testing.T) {
+	ok := HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	})
+	tests := []struct {
+		Request string
+		Valid   bool
+	}{
+		{"gemini://example.com/\r\n", true},
+		{"gemini://example.com/#fragment\r\n", false},
+		{"gemini://example.com/#\r\n", false},
+		{"gemini://user@example.com/\r\n", false},
+		{"gemini://example.com/\xff\r\n", false},
+		{"//example.com/\r\n", false},
+	}
+
+	for _, strict := range []bool{false, true} {
+		srv := &Server{Handler: ok, StrictValidation: strict, AllowProxying: true}
+		for _, test := range tests {
+			client, server := net.Pipe()
+			resp := make(chan []byte, 1)
+			go func() {
+				client.Write([]byte(test.Request))
+				b, _ := ioutil.ReadAll(client)
+				client.Close()
+				resp <- b
+			}()
+			srv.ServeConn(context.Background(), server)
+			want := "20 text/gemini\r\n"
+			if strict && !test.Valid {
+				want = "59 Bad request\r\n"
+			}
+			if got := string(<-resp); got != want {
+				t.Errorf("strict = %t, %q: expected response %q, got %q", strict, test.Request, want, got)
+			}
+		}
+	}
+}
+
+func TestServerProxyRequests(t *testing.T) {
+	ok := HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusSuccess, "text/gemini")
+	})
+	hosts := []string{"example.com", "*.example.org"}
+	tests := []struct {
+		Server   *Server
+		Request  string
+		Response string
+	}{
+		{&Server{Handler: ok}, "gemini://example.net\r\n", "20 text/gemini\r\n"},
+		{&Server{Handler: ok}, "https://example.net\r\n", "53 Proxy request refused\r\n"},
+		{&Server{Handler: ok, Hosts: hosts}, "gemini://EXAMPLE.com:1965/\r\n", "20 text/gemini\r\n"},
+		{&Server{Handler: ok, Hosts: hosts}, "gemini://www.example.org/\r\n", "20 text/gemini\r\n"},
+		{&Server{Handler: ok, Hosts: hosts}, "gemini://example.net/\r\n", "53 Proxy request refused\r\n"},
+		{&Server{Handler: ok, Hosts: hosts, AllowProxying: true}, "gemini://example.net/\r\n", "20 text/gemini\r\n"},
+	}
+
+	for _, test := range tests {
+		client, server := net.Pipe()
+		resp := make(chan []byte, 1)
+		go func() {
+			client.Write([]byte(test.Request))
+			b, _ := ioutil.ReadAll(client)
+			client.Close()
+			resp <- b
+		}()
+		test.Server.ServeConn(context.Background(), server)
+		if got := string(<-resp); got != test.Response {
+			t.Errorf("%q: expected response %q, got %q", test.Request, test.Response, got)
+		}
+	}
+}
+
+func TestServerServePlaintext(t *testing.T) {
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			if r.TLS() != nil {
+				t.Error("expected no TLS connection state")
+			}
+			w.Write([]byte("hello"))
+		}),
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Serve(ctx, l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("gemini://example.com\r\n"))
+	b, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "20 text/gemini\r\nhello"; string(b) != want {
+		t.Errorf("expected response %q, got %q", want, b)
+	}
+}
+
+func TestServerShutdownGracePeriod(t *testing.T) {
+	started := make(chan struct{})
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			close(started)
+			<-ctx.Done()
+		}),
+		ShutdownGracePeriod: 10 * time.Millisecond,
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(context.Background(), l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("gemini://example.com\r\n"))
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "41 Server unavailable\r\n"; string(b) != want {
+		t.Errorf("expected response %q, got %q", want, b)
+	}
+}
+
+func TestServerShutdownBlockedWrite(t *testing.T) {
+	started := make(chan struct{})
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			close(started)
+			b := make([]byte, 64*1024)
+			for {
+				if _, err := w.Write(b); err != nil {
+					return
+				}
+			}
+		}),
+		ShutdownGracePeriod: 50 * time.Millisecond,
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(context.Background(), l)
+
+	// The client never reads the response
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("gemini://example.com\r\n"))
+	<-started
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerContextCanceled(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{})
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			close(started)
+			<-ctx.Done()
+			close(canceled)
+		}),
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errch := make(chan error, 1)
+	go func() {
+		errch <- srv.Serve(ctx, l)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("gemini://example.com\r\n"))
+	<-started
+
+	cancel()
+	if err := <-errch; err != context.Canceled {
+		t.Errorf("expected error %v, got %v", context.Canceled, err)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler context was not canceled")
+	}
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerContextValues(t *testing.T) {
+	type values struct {
+		srv          *Server
+		listenerAddr net.Addr
+		localAddr    net.Addr
+	}
+	got := make(chan values, 1)
+	srv := &Server{}
+	srv.Handler = HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		got <- values{
+			ServerFromContext(ctx),
+			ListenerAddrFromContext(ctx),
+			LocalAddrFromContext(ctx),
+		}
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(context.Background(), l)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("gemini://example.com\r\n"))
+
+	v := <-got
+	if v.srv != srv {
+		t.Errorf("expected server %p, got %p", srv, v.srv)
+	}
+	if v.listenerAddr == nil || v.listenerAddr.String() != l.Addr().String() {
+		t.Errorf("expected listener address %s, got %v", l.Addr(), v.listenerAddr)
+	}
+	if v.localAddr == nil || v.localAddr.String() != conn.RemoteAddr().String() {
+		t.Errorf("expected local address %s, got %v", conn.RemoteAddr(), v.localAddr)
+	}
+}
+
+func TestServerListenerFiles(t *testing.T) {
+	srv := &Server{}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	errch := make(chan error, 1)
+	go func() {
+		errch <- srv.ServeTLS(context.Background(), l)
+	}()
+
+	var files []*os.File
+	for i := 0; i < 100 && len(files) == 0; i++ {
+		time.Sleep(time.Millisecond)
+		files, err = srv.ListenerFiles()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 listener file, got %d", len(files))
+	}
+	defer files[0].Close()
+
+	inherited, err := net.FileListener(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inherited.Close()
+	if inherited.Addr().String() != l.Addr().String() {
+		t.Errorf("expected address %s, got %s", l.Addr(), inherited.Addr())
+	}
+
+	srv.Close()
+	<-errch
+}
+
+func TestServerRegisterOnShutdown(t *testing.T) {
+	srv := &Server{}
+	called := make(chan struct{})
+	srv.RegisterOnShutdown(func() {
+		close(called)
+	})
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-called:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected shutdown hook to be called")
+	}
+}
+
+func TestServerHandle(t *testing.T) {
+	srv := &Server{
+		Certificates: &certificate.Store{},
+	}
+	srv.HandleFunc("example.com:1965/", func(ctx context.Context, w ResponseWriter, r *Request) {})
+	srv.Handle("/path", NotFoundHandler())
+
+	if _, ok := srv.Handler.(*Mux); !ok {
+		t.Fatalf("expected Handler to be a *Mux, got %T", srv.Handler)
+	}
+	if _, err := srv.Certificates.Get("example.com"); err != nil {
+		t.Errorf("expected example.com to be registered: %v", err)
+	}
+	if _, err := srv.Certificates.Get("example.org"); err == nil {
+		t.Errorf("expected example.org not to be registered")
+	}
+}
+
+func TestServerRegisterMuxScopes(t *testing.T) {
+	mux := &Mux{}
+	mux.HandleFunc("example.com/", func(ctx context.Context, w ResponseWriter, r *Request) {})
+	srv := &Server{
+		Handler:      mux,
+		Certificates: &certificate.Store{},
+	}
+	srv.registerCertificateScopes()
+	if _, err := srv.Certificates.Get("example.com"); err != nil {
+		t.Errorf("expected example.com to be registered: %v", err)
+	}
+}
+
+// benchConn is a net.Conn that reads a request and discards the response.
+type benchConn struct {
+	net.Conn
+	r *strings.Reader
+}
+
+func (c *benchConn) Read(b []byte) (int, error)         { return c.r.Read(b) }
+func (c *benchConn) Write(b []byte) (int, error)        { return len(b), nil }
+func (c *benchConn) Close() error                       { return nil }
+func (c *benchConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *benchConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *benchConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func BenchmarkServeConn(b *testing.B) {
+	const raw = "gemini://example.com/\r\n"
+	srv := &Server{
+		Handler: HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+			w.Write([]byte("# Hello, world!\n"))
+		}),
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		conn := &benchConn{r: strings.NewReader(raw)}
+		for pb.Next() {
+			conn.r.Reset(raw)
+			if err := srv.ServeConn(context.Background(), conn); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,284 @@
+// Package spartan implements a Spartan server that serves Gemini handlers.
+//
+// Spartan is a plaintext protocol similar to Gemini. The Server in this
+// package translates Spartan requests into Gemini requests for the
+// "gemini" URL scheme, so that a capsule can serve both protocols from
+// the same gemini.Handler, such as a gemini.Mux. Gemini response status
+// codes are translated into their Spartan equivalents.
+//
+// Data sent with a Spartan request is passed to the handler as the
+// URL query, so that handlers requesting input with
+// "10 Input" work with Spartan links of the form "=: /path".
+package spartan
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+// MaxDataSize is the maximum size of the data accepted with a request.
+const MaxDataSize = 1024
+
+var errInvalidRequest = errors.New("spartan: invalid request")
+
+// A Server defines parameters for running a Spartan server.
+type Server struct {
+	// Addr optionally specifies the TCP address for the server to listen on,
+	// in the form "host:port". If empty, ":300" (port 300) is used.
+	Addr string
+
+	// The Handler to invoke.
+	Handler gemini.Handler
+
+	// ReadTimeout is the maximum duration for reading the entire
+	// request. A ReadTimeout of zero means no timeout.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the maximum duration before timing out
+	// writes of the response. A WriteTimeout of zero means no timeout.
+	WriteTimeout time.Duration
+
+	// ErrorLog specifies an optional logger for errors accepting
+	// connections. If nil, logging is done via the log package's
+	// standard logger.
+	ErrorLog interface {
+		Printf(format string, v ...interface{})
+	}
+}
+
+// ListenAndServe listens on the TCP network address srv.Addr and then
+// calls Serve to handle requests on incoming connections.
+//
+// ListenAndServe always returns a non-nil error.
+func (srv *Server) ListenAndServe(ctx context.Context) error {
+	addr := srv.Addr
+	if addr == "" {
+		addr = ":300"
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return srv.Serve(ctx, l)
+}
+
+// Serve accepts incoming connections on the Listener l, creating a new
+// service goroutine for each. If the provided context expires, Serve
+// closes l and returns the context's error.
+//
+// Serve always closes l and returns a non-nil error.
+func (srv *Server) Serve(ctx context.Context, l net.Listener) error {
+	defer l.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			l.Close()
+		case <-done:
+		}
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				srv.logf("spartan: Accept error: %v", err)
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go srv.ServeConn(ctx, conn)
+	}
+}
+
+// ServeConn serves a Spartan response over the provided connection.
+// It closes the connection when the response has been completed.
+func (srv *Server) ServeConn(ctx context.Context, conn net.Conn) error {
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if d := srv.ReadTimeout; d != 0 {
+		conn.SetReadDeadline(time.Now().Add(d))
+	}
+	if d := srv.WriteTimeout; d != 0 {
+		conn.SetWriteDeadline(time.Now().Add(d))
+	}
+
+	w := &responseWriter{bw: bufio.NewWriter(conn), conn: conn}
+	req, err := ReadRequest(conn)
+	if err != nil {
+		w.writeStatus(4, "Bad request")
+		return w.Flush()
+	}
+	w.url = req.URL
+
+	h := srv.Handler
+	if h == nil {
+		w.WriteHeader(gemini.StatusNotFound, "Not found")
+		return w.Flush()
+	}
+	h.ServeGemini(ctx, w, req)
+	return w.Flush()
+}
+
+// ReadRequest reads a Spartan request from r and translates it into a
+// Gemini request for the "gemini" URL scheme. Request data is stored
+// in the URL query.
+func ReadRequest(r io.Reader) (*gemini.Request, error) {
+	br := bufio.NewReaderSize(io.LimitReader(r, 1026+MaxDataSize), 1026)
+	line, err := br.ReadString('\n')
+	if err != nil || !strings.HasSuffix(line, "\r\n") {
+		return nil, errInvalidRequest
+	}
+	parts := strings.Split(strings.TrimSuffix(line, "\r\n"), " ")
+	if len(parts) != 3 || parts[0] == "" || !strings.HasPrefix(parts[1], "/") {
+		return nil, errInvalidRequest
+	}
+	size, err := strconv.Atoi(parts[2])
+	if err != nil || size < 0 || size > MaxDataSize {
+		return nil, errInvalidRequest
+	}
+
+	u, err := url.Parse("gemini://" + parts[0] + parts[1])
+	if err != nil {
+		return nil, errInvalidRequest
+	}
+	if size > 0 {
+		data := make([]byte, size)
+		if _, err := io.ReadFull(br, data); err != nil {
+			return nil, errInvalidRequest
+		}
+		u.RawQuery = gemini.QueryEscape(string(data))
+	}
+	return &gemini.Request{URL: u}, nil
+}
+
+// responseWriter translates Gemini responses into Spartan responses.
+type responseWriter struct {
+	bw          *bufio.Writer
+	conn        net.Conn
+	url         *url.URL
+	mediatype   string
+	status      gemini.Status
+	wroteHeader bool
+	bodyAllowed bool
+	closed      bool
+}
+
+func (w *responseWriter) SetMediaType(mediatype string) {
+	w.mediatype = mediatype
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		meta := w.mediatype
+		if meta == "" {
+			meta = "text/gemini"
+		}
+		w.WriteHeader(gemini.StatusSuccess, meta)
+	}
+	if w.closed {
+		return 0, gemini.ErrResponseClosed
+	}
+	if !w.bodyAllowed {
+		return 0, &gemini.BodyNotAllowedError{Status: w.status}
+	}
+	return w.bw.Write(b)
+}
+
+// WriteHeader writes the Spartan equivalent of the provided Gemini
+// status code and meta.
+func (w *responseWriter) WriteHeader(status gemini.Status, meta string) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = status
+	switch status.Class() {
+	case gemini.StatusClassSuccess:
+		w.writeStatus(2, meta)
+	case gemini.StatusClassRedirect:
+		// Spartan redirects must be absolute paths on the same host
+		u, err := url.Parse(meta)
+		if err != nil || u.Path == "" || u.Path[0] != '/' ||
+			u.Scheme != "" && u.Scheme != w.url.Scheme ||
+			u.Host != "" && u.Host != w.url.Host {
+			w.writeStatus(5, "Invalid redirect")
+			return
+		}
+		target := u.EscapedPath()
+		if u.RawQuery != "" {
+			target += "?" + u.RawQuery
+		}
+		w.writeStatus(3, target)
+	case gemini.StatusClassTemporaryFailure:
+		w.writeStatus(5, meta)
+	default:
+		// Input, permanent failures and certificate errors are
+		// client errors in Spartan.
+		w.writeStatus(4, meta)
+	}
+}
+
+func (w *responseWriter) writeStatus(status int, meta string) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.bodyAllowed = status == 2
+	w.bw.WriteString(strconv.Itoa(status))
+	w.bw.WriteByte(' ')
+	w.bw.WriteString(meta)
+	w.bw.WriteString("\r\n")
+}
+
+func (w *responseWriter) Written() bool {
+	return w.wroteHeader
+}
+
+func (w *responseWriter) Flush() error {
+	if w.closed {
+		return nil
+	}
+	if !w.wroteHeader {
+		w.writeStatus(5, "Server error")
+	}
+	return w.bw.Flush()
+}
+
+func (w *responseWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	err := w.Flush()
+	w.closed = true
+	if cerr := w.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (srv *Server) logf(format string, args ...interface{}) {
+	if srv.ErrorLog != nil {
+		srv.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
+}
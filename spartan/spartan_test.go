@@ -0,0 +1,129 @@
+package spartan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+
+	"git.sr.ht/~adnano/go-gemini"
+)
+
+func TestReadRequest(t *testing.T) {
+	tests := []struct {
+		Raw   string
+		URL   string
+		Query string
+		Err   bool
+	}{
+		{Raw: "example.com / 0\r\n", URL: "gemini://example.com/"},
+		{Raw: "example.com:3000 /a%20b/c.gmi 0\r\n", URL: "gemini://example.com:3000/a%20b/c.gmi"},
+		{Raw: "example.com /search 11\r\nhello world", URL: "gemini://example.com/search?hello%20world", Query: "hello world"},
+		{Raw: "example.com /form 5\r\na&b=c", URL: "gemini://example.com/form?a&b=c", Query: "a&b=c"},
+		{Raw: "example.com /short 5\r\nabc", Err: true},
+		{Raw: "example.com / 0\n", Err: true},
+		{Raw: "example.com / \r\n", Err: true},
+		{Raw: "example.com / -1\r\n", Err: true},
+		{Raw: fmt.Sprintf("example.com / %d\r\n", MaxDataSize+1), Err: true},
+		{Raw: "example.com relative 0\r\n", Err: true},
+		{Raw: " / 0\r\n", Err: true},
+		{Raw: "example.com / 0 extra\r\n", Err: true},
+	}
+	for _, test := range tests {
+		req, err := ReadRequest(strings.NewReader(test.Raw))
+		if test.Err {
+			if err == nil {
+				t.Errorf("%q: expected error, got %v", test.Raw, req.URL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Raw, err)
+			continue
+		}
+		if req.URL.String() != test.URL {
+			t.Errorf("%q: expected URL %q, got %q", test.Raw, test.URL, req.URL)
+		}
+		query, err := gemini.QueryUnescape(req.URL.RawQuery)
+		if err != nil {
+			t.Errorf("%q: invalid query: %v", test.Raw, err)
+		}
+		if query != test.Query {
+			t.Errorf("%q: expected query %q, got %q", test.Raw, test.Query, query)
+		}
+	}
+}
+
+// serve sends the raw request to srv over an in-memory connection and
+// returns the raw response.
+func serve(t *testing.T, srv *Server, raw string) string {
+	c1, c2 := net.Pipe()
+	go srv.ServeConn(context.Background(), c2)
+	go func() {
+		io.WriteString(c1, raw)
+	}()
+	resp, err := ioutil.ReadAll(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(resp)
+}
+
+func TestServerStatus(t *testing.T) {
+	tests := []struct {
+		Status   gemini.Status
+		Meta     string
+		Response string
+	}{
+		{gemini.StatusSuccess, "text/plain", "2 text/plain\r\nbody"},
+		{gemini.StatusInput, "Query", "4 Query\r\n"},
+		{gemini.StatusRedirect, "/new%20page?q", "3 /new%20page?q\r\n"},
+		{gemini.StatusPermanentRedirect, "gemini://example.com/moved", "3 /moved\r\n"},
+		{gemini.StatusPermanentRedirect, "gemini://example.org/moved", "5 Invalid redirect\r\n"},
+		{gemini.StatusPermanentRedirect, "//example.org/moved", "5 Invalid redirect\r\n"},
+		{gemini.StatusPermanentRedirect, "https://example.com/moved", "5 Invalid redirect\r\n"},
+		{gemini.StatusRedirect, "relative", "5 Invalid redirect\r\n"},
+		{gemini.StatusTemporaryFailure, "Try again", "5 Try again\r\n"},
+		{gemini.StatusSlowDown, "30", "5 30\r\n"},
+		{gemini.StatusNotFound, "Not found", "4 Not found\r\n"},
+		{gemini.StatusCertificateRequired, "Certificate required", "4 Certificate required\r\n"},
+	}
+	for _, test := range tests {
+		srv := &Server{
+			Handler: gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+				w.WriteHeader(test.Status, test.Meta)
+				io.WriteString(w, "body")
+			}),
+		}
+		if got := serve(t, srv, "example.com / 0\r\n"); got != test.Response {
+			t.Errorf("%d %s: expected response %q, got %q", test.Status, test.Meta, test.Response, got)
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv := &Server{
+		Handler: gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {
+			fmt.Fprintf(w, "%s %s", r.URL.Path, r.URL.RawQuery)
+		}),
+	}
+	if got, want := serve(t, srv, "example.com /echo 2\r\nhi"), "2 text/gemini\r\n/echo hi"; got != want {
+		t.Errorf("expected response %q, got %q", want, got)
+	}
+	if got, want := serve(t, srv, "invalid\r\n"), "4 Bad request\r\n"; got != want {
+		t.Errorf("expected response %q, got %q", want, got)
+	}
+
+	// Handlers that do not respond produce a server error
+	srv.Handler = gemini.HandlerFunc(func(ctx context.Context, w gemini.ResponseWriter, r *gemini.Request) {})
+	if got, want := serve(t, srv, "example.com / 0\r\n"), "5 Server error\r\n"; got != want {
+		t.Errorf("expected response %q, got %q", want, got)
+	}
+	srv.Handler = nil
+	if got, want := serve(t, srv, "example.com / 0\r\n"), "4 Not found\r\n"; got != want {
+		t.Errorf("expected response %q, got %q", want, got)
+	}
+}
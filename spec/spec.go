@@ -0,0 +1,97 @@
+// Package spec provides test vectors for the Gemini wire format.
+//
+// The vectors describe how valid and invalid requests and response
+// headers are parsed. They are used by the tests of package gemini and
+// can be used to check that other implementations parse the wire format
+// in the same way:
+//
+//	for _, v := range spec.Requests() {
+//		req, err := parseRequest(v.Raw)
+//		if v.Valid != (err == nil) {
+//			// report failure
+//		}
+//	}
+//
+// The vectors do not depend on package gemini.
+package spec
+
+import "strings"
+
+// maxURL is a URL of the maximum length of 1024 bytes.
+var maxURL = "gemini://example.net/" + strings.Repeat("x", 1024-len("gemini://example.net/"))
+
+// A Request is a test vector for a Gemini request.
+type Request struct {
+	// Name describes the vector.
+	Name string
+
+	// Raw is the request as sent over the wire.
+	Raw string
+
+	// Valid reports whether the request is valid.
+	Valid bool
+
+	// URL is the requested URL, in the form returned by url.URL.String.
+	// It is empty for invalid requests.
+	URL string
+}
+
+// A Response is a test vector for a Gemini response.
+type Response struct {
+	// Name describes the vector.
+	Name string
+
+	// Raw is the response as sent over the wire.
+	Raw string
+
+	// Valid reports whether the response header is valid.
+	Valid bool
+
+	// Status and Meta are the status code and meta of the response.
+	// They are zero for invalid responses.
+	Status int
+	Meta   string
+
+	// Body is the response body. It is empty for invalid responses.
+	Body string
+}
+
+var requests = []Request{
+	{Name: "simple", Raw: "gemini://example.com\r\n", Valid: true, URL: "gemini://example.com"},
+	{Name: "path and query", Raw: "gemini://example.com/path/?query\r\n", Valid: true, URL: "gemini://example.com/path/?query"},
+	{Name: "other scheme", Raw: "http://example.org/path/?query#fragment\r\n", Valid: true, URL: "http://example.org/path/?query#fragment"},
+	{Name: "maximum length", Raw: maxURL + "\r\n", Valid: true, URL: maxURL},
+	{Name: "empty", Raw: "\r\n"},
+	{Name: "missing CR", Raw: "gemini://example.com\n"},
+	{Name: "missing CRLF", Raw: "gemini://example.com"},
+	{Name: "too long", Raw: maxURL + "x\r\n"},
+	{Name: "too long without CRLF", Raw: maxURL + "xxxxxx"},
+}
+
+var responses = []Response{
+	{Name: "success", Raw: "20 text/gemini\r\nHello, world!\nWelcome to my capsule.", Valid: true, Status: 20, Meta: "text/gemini", Body: "Hello, world!\nWelcome to my capsule."},
+	{Name: "input", Raw: "10 Search query\r\n", Valid: true, Status: 10, Meta: "Search query"},
+	{Name: "redirect", Raw: "30 /redirect\r\n", Valid: true, Status: 30, Meta: "/redirect"},
+	{Name: "maximum meta length", Raw: "30 " + maxURL + "\r\n", Valid: true, Status: 30, Meta: maxURL},
+	{Name: "unknown status", Raw: "99 Unknown status code\r\n", Valid: true, Status: 99, Meta: "Unknown status code"},
+	{Name: "meta too long", Raw: "30 " + maxURL + "xxxx\r\n"},
+	{Name: "empty header", Raw: "\r\n"},
+	{Name: "bare LF", Raw: "\n"},
+	{Name: "one digit status", Raw: "1 Bad response\r\n"},
+	{Name: "empty", Raw: ""},
+	{Name: "missing CRLF", Raw: "10 Search query"},
+	{Name: "missing CR", Raw: "20 text/gemini\nHello, world!"},
+	{Name: "missing LF", Raw: "20 text/gemini\rHello, world!"},
+	{Name: "trailing CR", Raw: "20 text/gemini\r"},
+	{Name: "garbage", Raw: "abcdefghijklmnopqrstuvwxyz"},
+}
+
+// Requests returns the request test vectors.
+func Requests() []Request {
+	return append([]Request(nil), requests...)
+}
+
+// Responses returns the response test vectors.
+func Responses() []Response {
+	return append([]Response(nil), responses...)
+}
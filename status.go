@@ -25,15 +25,64 @@ const (
 	StatusCertificateNotValid      Status = 62
 )
 
-// Class returns the status class for the status code.
-// 1x becomes 10, 2x becomes 20, and so on.
-func (s Status) Class() Status {
-	return (s / 10) * 10
+// StatusClass represents the class of a Gemini status code, given by
+// its first digit.
+type StatusClass int
+
+// Gemini status code classes.
+const (
+	StatusClassInput               StatusClass = 1
+	StatusClassSuccess             StatusClass = 2
+	StatusClassRedirect            StatusClass = 3
+	StatusClassTemporaryFailure    StatusClass = 4
+	StatusClassPermanentFailure    StatusClass = 5
+	StatusClassCertificateRequired StatusClass = 6
+)
+
+// String returns a text for the status code class.
+// It returns the empty string if the class is unknown.
+func (c StatusClass) String() string {
+	switch c {
+	case StatusClassInput:
+		return "Input"
+	case StatusClassSuccess:
+		return "Success"
+	case StatusClassRedirect:
+		return "Redirect"
+	case StatusClassTemporaryFailure:
+		return "Temporary failure"
+	case StatusClassPermanentFailure:
+		return "Permanent failure"
+	case StatusClassCertificateRequired:
+		return "Certificate required"
+	}
+	return ""
 }
 
-// String returns a text for the status code.
-// It returns the empty string if the status code is unknown.
+// Class returns the class of the status code.
+// 1x becomes StatusClassInput, 2x becomes StatusClassSuccess, and so on.
+func (s Status) Class() StatusClass {
+	return StatusClass(s / 10)
+}
+
+// Success reports whether the status code is a success status code (2x).
+func (s Status) Success() bool {
+	return s.Class() == StatusClassSuccess
+}
+
+// Redirect reports whether the status code is a redirect status code (3x).
+func (s Status) Redirect() bool {
+	return s.Class() == StatusClassRedirect
+}
+
+// String returns a text for the status code. It is the same as Text.
 func (s Status) String() string {
+	return s.Text()
+}
+
+// Text returns a text for the status code.
+// It returns the empty string if the status code is unknown.
+func (s Status) Text() string {
 	switch s {
 	case StatusInput:
 		return "Input"
@@ -0,0 +1,33 @@
+package gemini
+
+import "testing"
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct {
+		Status   Status
+		Class    StatusClass
+		Success  bool
+		Redirect bool
+	}{
+		{StatusInput, StatusClassInput, false, false},
+		{StatusSuccess, StatusClassSuccess, true, false},
+		{StatusPermanentRedirect, StatusClassRedirect, false, true},
+		{StatusSlowDown, StatusClassTemporaryFailure, false, false},
+		{StatusBadRequest, StatusClassPermanentFailure, false, false},
+		{StatusCertificateNotValid, StatusClassCertificateRequired, false, false},
+	}
+	for _, test := range tests {
+		if class := test.Status.Class(); class != test.Class {
+			t.Errorf("%d: expected class %d, got %d", test.Status, test.Class, class)
+		}
+		if test.Status.Success() != test.Success {
+			t.Errorf("%d: expected Success() = %t", test.Status, test.Success)
+		}
+		if test.Status.Redirect() != test.Redirect {
+			t.Errorf("%d: expected Redirect() = %t", test.Status, test.Redirect)
+		}
+	}
+	if text := StatusGone.Text(); text != "Gone" {
+		t.Errorf("expected text %q, got %q", "Gone", text)
+	}
+}
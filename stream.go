@@ -0,0 +1,104 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"time"
+)
+
+// Backoff durations used by Client.Stream when reconnecting.
+const (
+	minStreamBackoff = 1 * time.Second
+	maxStreamBackoff = 1 * time.Minute
+)
+
+// StreamError is returned by Client.Stream when the server responds
+// with a status code other than success.
+type StreamError struct {
+	Status Status
+	Meta   string
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("gemini: stream failed with status %d %s", e.Status, e.Meta)
+}
+
+// Stream requests the given URL and parses the response body as Gemini
+// text as it arrives, calling onLine with each parsed line. This is
+// useful for consuming streams of Gemini text that do not end, such as
+// live feeds or chat logs.
+//
+// If the connection fails or the server ends the response, Stream
+// reconnects with exponential backoff and continues parsing the new
+// response. Note that the server may resend lines that were already
+// delivered.
+//
+// Stream returns when the context expires, when onLine returns a non-nil
+// error, or when the server responds with a status code other than
+// success or a media type other than "text/gemini". It returns the
+// context's error, the error returned by onLine, or a *StreamError
+// respectively.
+func (c *Client) Stream(ctx context.Context, url string, onLine func(Line) error) error {
+	req, err := NewRequest(url)
+	if err != nil {
+		return err
+	}
+
+	backoff := minStreamBackoff
+	for {
+		connected, err := c.stream(ctx, req, onLine)
+		if err != nil {
+			return err
+		}
+		if connected {
+			backoff = minStreamBackoff
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > maxStreamBackoff {
+			backoff = maxStreamBackoff
+		}
+	}
+}
+
+// stream performs a single streaming request. It reports whether a
+// connection was established and returns a non-nil error only if
+// streaming should not be retried.
+func (c *Client) stream(ctx context.Context, req *Request, onLine func(Line) error) (bool, error) {
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx.Err()
+		}
+		// Retry
+		return false, nil
+	}
+	defer resp.Body.Close()
+
+	if !resp.Status.Success() {
+		return true, &StreamError{resp.Status, resp.Meta}
+	}
+	if mediatype, _, err := mime.ParseMediaType(resp.Meta); err != nil || mediatype != "text/gemini" {
+		return true, &StreamError{resp.Status, resp.Meta}
+	}
+
+	var handlerErr error
+	parseLines(resp.Body, func(line Line, offset int64) error {
+		handlerErr = onLine(line)
+		return handlerErr
+	})
+	if handlerErr != nil {
+		return true, handlerErr
+	}
+	if ctx.Err() != nil {
+		return true, ctx.Err()
+	}
+	return true, nil
+}
@@ -0,0 +1,84 @@
+package gemini
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/url"
+	"text/template"
+)
+
+// TextHandler returns a request handler that responds to each request
+// with the provided Gemini text.
+func TextHandler(text string) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		w.SetMediaType("text/gemini")
+		io.WriteString(w, text)
+	})
+}
+
+// TemplateData is the data passed to templates executed by
+// TemplateHandler.
+type TemplateData struct {
+	// Request is the request being served.
+	Request *Request
+
+	// URL is the request URL.
+	URL *url.URL
+
+	// Query is the unescaped URL query, that is, the user input
+	// provided with the request, if any.
+	Query string
+
+	// CommonName is the common name of the client certificate, if any.
+	CommonName string
+
+	// Fingerprint is the SHA-256 fingerprint of the client certificate
+	// in lowercase hexadecimal, if any. See Fingerprint.
+	Fingerprint string
+}
+
+// TemplateHandler returns a request handler that responds to each request
+// with the Gemini text produced by executing tmpl with the request's
+// TemplateData.
+//
+// The template is executed before the response header is written, so
+// that a template error results in a "40 Temporary failure" response
+// rather than a partial document. The error is logged by the server
+// serving the request, if any.
+func TemplateHandler(tmpl *template.Template) Handler {
+	return HandlerFunc(func(ctx context.Context, w ResponseWriter, r *Request) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, NewTemplateData(r)); err != nil {
+			if srv := ServerFromContext(ctx); srv != nil {
+				srv.logError("template error", "url", r.URL, "err", err)
+			}
+			w.WriteHeader(StatusTemporaryFailure, "Temporary failure")
+			return
+		}
+		w.SetMediaType("text/gemini")
+		w.Write(buf.Bytes())
+	})
+}
+
+// NewTemplateData returns the TemplateData for the provided request.
+// It is useful for handlers that execute templates themselves.
+func NewTemplateData(r *Request) *TemplateData {
+	data := &TemplateData{
+		Request: r,
+		URL:     r.URL,
+	}
+	if r.URL != nil {
+		// Queries that are not properly escaped are passed as-is
+		data.Query = r.URL.RawQuery
+		if query, err := QueryUnescape(r.URL.RawQuery); err == nil {
+			data.Query = query
+		}
+	}
+	if tls := r.TLS(); tls != nil && len(tls.PeerCertificates) > 0 {
+		cert := tls.PeerCertificates[0]
+		data.CommonName = cert.Subject.CommonName
+		data.Fingerprint = Fingerprint(cert)
+	}
+	return data
+}
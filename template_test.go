@@ -0,0 +1,54 @@
+package gemini
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"text/template"
+)
+
+func TestTextHandler(t *testing.T) {
+	req, err := NewRequest("gemini://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := &recorder{}
+	TextHandler("# Hello\n").ServeGemini(context.Background(), rw, req)
+	if rw.Status != StatusSuccess || rw.Meta != "text/gemini" || rw.Body.String() != "# Hello\n" {
+		t.Errorf("unexpected response %d %q %q", rw.Status, rw.Meta, rw.Body.String())
+	}
+}
+
+func TestTemplateHandler(t *testing.T) {
+	tmpl := template.Must(template.New("").Parse(
+		"{{.URL.Path}}\n{{.Query}}\n{{with .CommonName}}Hello, {{.}}{{else}}Hello{{end}}\n"))
+	h := TemplateHandler(tmpl)
+
+	req, err := NewRequest("gemini://example.com/page?hello%20world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := &recorder{}
+	h.ServeGemini(context.Background(), rw, req)
+	if want := "/page\nhello world\nHello\n"; rw.Status != StatusSuccess || rw.Body.String() != want {
+		t.Errorf("expected %q, got %d %q", want, rw.Status, rw.Body.String())
+	}
+
+	cert := &x509.Certificate{Raw: []byte("certificate"), Subject: pkix.Name{CommonName: "user"}}
+	req.tls = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	rw = &recorder{}
+	h.ServeGemini(context.Background(), rw, req)
+	if want := "/page\nhello world\nHello, user\n"; rw.Body.String() != want {
+		t.Errorf("expected %q, got %q", want, rw.Body.String())
+	}
+
+	// Template errors result in a temporary failure without a body
+	h = TemplateHandler(template.Must(template.New("").Parse("partial{{.Missing}}")))
+	rw = &recorder{}
+	h.ServeGemini(context.Background(), rw, req)
+	if rw.Status != StatusTemporaryFailure || rw.Body.Len() != 0 {
+		t.Errorf("expected temporary failure, got %d %q", rw.Status, rw.Body.String())
+	}
+}
@@ -2,6 +2,8 @@ package gemini
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -89,77 +91,146 @@ func (l LineText) line()                {}
 type Text []Line
 
 // ParseText parses Gemini text from the provided io.Reader.
+// It is equivalent to ParseOptions{}.ParseText(r).
 func ParseText(r io.Reader) (Text, error) {
+	return ParseOptions{}.ParseText(r)
+}
+
+// ParseLines parses Gemini text from the provided io.Reader.
+// It calls handler with each line that it parses.
+// Errors reading r and lines that are too long are returned as a
+// *ParseError. See ParseOptions.
+func ParseLines(r io.Reader, handler func(Line)) error {
+	return parseLines(r, func(line Line, offset int64) error {
+		handler(line)
+		return nil
+	})
+}
+
+// ParseLinesFunc parses Gemini text from the provided io.Reader, calling
+// handler with each line that it parses. It stops parsing and returns the
+// error if handler returns a non-nil error, or the context's error if the
+// context is done before a line is parsed. Errors reading r and lines that
+// are too long are returned as a *ParseError.
+//
+// The context is checked between lines, so a Read call that blocks is not
+// interrupted. To abort such a call, close the reader, such as the Body of
+// a Response, when the context is done.
+func ParseLinesFunc(ctx context.Context, r io.Reader, handler func(Line) error) error {
+	return parseLines(r, func(line Line, offset int64) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return handler(line)
+	})
+}
+
+// defaultMaxLineLength is the maximum line length used by ParseOptions
+// and Tokenizer when MaxLineLength is zero.
+const defaultMaxLineLength = bufio.MaxScanTokenSize
+
+// ErrLineTooLong is wrapped by the *ParseError returned when parsing Gemini
+// text containing a line longer than the maximum line length.
+var ErrLineTooLong = errors.New("gemini: line too long")
+
+// ParseError is returned when Gemini text cannot be parsed, either because
+// the underlying io.Reader returned an error or because a line is too long.
+type ParseError struct {
+	// Line is the number of the line being parsed, starting at 1.
+	Line int
+
+	// Err is the underlying error, such as ErrLineTooLong.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v (line %d)", e.Err, e.Line)
+}
+
+// Unwrap returns the underlying error.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ParseOptions configures the parsing of Gemini text.
+// The zero value parses Gemini text in the same way as ParseLines.
+type ParseOptions struct {
+	// MaxLineLength is the maximum length of a line in bytes, not
+	// including the line ending. Parsing stops at the first longer line
+	// with a *ParseError wrapping ErrLineTooLong.
+	// If zero, a maximum of 64 KiB is used.
+	MaxLineLength int
+}
+
+// ParseText parses Gemini text from the provided io.Reader using the
+// options. If an error occurs, it returns the lines parsed so far along
+// with the error.
+func (o ParseOptions) ParseText(r io.Reader) (Text, error) {
 	var t Text
-	err := ParseLines(r, func(line Line) {
+	err := o.ParseLines(r, func(line Line, num int) error {
 		t = append(t, line)
+		return nil
 	})
 	return t, err
 }
 
-// ParseLines parses Gemini text from the provided io.Reader.
-// It calls handler with each line that it parses.
-func ParseLines(r io.Reader, handler func(Line)) error {
-	const spacetab = " \t"
-	var pre bool
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		var line Line
-		text := scanner.Text()
-		if strings.HasPrefix(text, "```") {
-			pre = !pre
-			text = text[3:]
-			line = LinePreformattingToggle(text)
-		} else if pre {
-			line = LinePreformattedText(text)
-		} else if strings.HasPrefix(text, "=>") {
-			text = text[2:]
-			text = strings.TrimLeft(text, spacetab)
-			split := strings.IndexAny(text, spacetab)
-			if split == -1 {
-				// text is a URL
-				line = LineLink{URL: text}
-			} else {
-				url := text[:split]
-				name := text[split:]
-				name = strings.TrimLeft(name, spacetab)
-				line = LineLink{url, name}
-			}
-		} else if strings.HasPrefix(text, "*") {
-			text = text[1:]
-			text = strings.TrimLeft(text, spacetab)
-			line = LineListItem(text)
-		} else if strings.HasPrefix(text, "###") {
-			text = text[3:]
-			text = strings.TrimLeft(text, spacetab)
-			line = LineHeading3(text)
-		} else if strings.HasPrefix(text, "##") {
-			text = text[2:]
-			text = strings.TrimLeft(text, spacetab)
-			line = LineHeading2(text)
-		} else if strings.HasPrefix(text, "#") {
-			text = text[1:]
-			text = strings.TrimLeft(text, spacetab)
-			line = LineHeading1(text)
-		} else if strings.HasPrefix(text, ">") {
-			text = text[1:]
-			text = strings.TrimLeft(text, spacetab)
-			line = LineQuote(text)
-		} else {
-			line = LineText(text)
+// ParseLines parses Gemini text from the provided io.Reader using the
+// options. It calls handler with each line that it parses and its line
+// number, starting at 1, which is useful for reporting problems in the text.
+//
+// ParseLines stops parsing and returns the error if handler returns a
+// non-nil error. Errors reading r and lines that are too long are returned
+// as a *ParseError.
+func (o ParseOptions) ParseLines(r io.Reader, handler func(line Line, num int) error) error {
+	return o.parse(r, func(line Line, offset int64, num int) error {
+		return handler(line, num)
+	})
+}
+
+// parseLines is like ParseLines, except that it also provides handler with
+// the byte offset of the start of each line, and it stops parsing and
+// returns the error if handler returns a non-nil error.
+func parseLines(r io.Reader, handler func(line Line, offset int64) error) error {
+	return ParseOptions{}.parse(r, func(line Line, offset int64, num int) error {
+		return handler(line, offset)
+	})
+}
+
+// parse parses Gemini text, providing handler with each line, the byte
+// offset of its start, and its line number.
+func (o ParseOptions) parse(r io.Reader, handler func(line Line, offset int64, num int) error) error {
+	t := o.NewTokenizer(r)
+	for t.Next() {
+		if err := handler(t.Line(), t.Offset(), t.LineNumber()); err != nil {
+			return err
 		}
-		handler(line)
 	}
-
-	return scanner.Err()
+	return t.Err()
 }
 
 // String writes the Gemini text response to a string and returns it.
 func (t Text) String() string {
 	var b strings.Builder
+	t.WriteTo(&b)
+	return b.String()
+}
+
+// WriteTo writes the Gemini text response to w one line at a time,
+// without formatting the whole response in memory first. It implements
+// io.WriterTo, so that a Text can be copied directly to a ResponseWriter
+// with io.Copy. Since a Text is a slice of lines, a long response can
+// also be written in parts by writing subslices of it in order.
+func (t Text) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	var buf []byte
 	for _, l := range t {
-		b.WriteString(l.String())
-		b.WriteByte('\n')
+		buf = append(buf[:0], l.String()...)
+		buf = append(buf, '\n')
+		m, err := w.Write(buf)
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
 	}
-	return b.String()
+	return n, nil
 }
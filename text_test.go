@@ -0,0 +1,169 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseOptionsLineNumbers(t *testing.T) {
+	const text = "# Title\r\n\n=> gemini://example.com\n```\npre"
+	var nums []int
+	err := ParseOptions{}.ParseLines(strings.NewReader(text), func(line Line, num int) error {
+		nums = append(nums, num)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{1, 2, 3, 4, 5}
+	if len(nums) != len(want) {
+		t.Fatalf("expected line numbers %v, got %v", want, nums)
+	}
+	for i := range want {
+		if nums[i] != want[i] {
+			t.Fatalf("expected line numbers %v, got %v", want, nums)
+		}
+	}
+}
+
+func TestParseOptionsMaxLineLength(t *testing.T) {
+	tests := []struct {
+		Text  string
+		Max   int
+		Lines int
+		Line  int // line number of the error, or 0
+	}{
+		{"1234\r\n1234\n1234", 4, 3, 0},
+		{"1234\n12345\n1", 4, 1, 2},
+		{"1\n2\n" + strings.Repeat("x", 100), 10, 2, 3},
+		{strings.Repeat("x", 100), 0, 1, 0},
+	}
+	for _, test := range tests {
+		text, err := ParseOptions{MaxLineLength: test.Max}.ParseText(strings.NewReader(test.Text))
+		if len(text) != test.Lines {
+			t.Errorf("%q: expected %d lines, got %d", test.Text, test.Lines, len(text))
+		}
+		if test.Line == 0 {
+			if err != nil {
+				t.Errorf("%q: unexpected error: %v", test.Text, err)
+			}
+			continue
+		}
+		var perr *ParseError
+		if !errors.As(err, &perr) || !errors.Is(err, ErrLineTooLong) {
+			t.Errorf("%q: expected ErrLineTooLong, got %v", test.Text, err)
+			continue
+		}
+		if perr.Line != test.Line {
+			t.Errorf("%q: expected error on line %d, got %d", test.Text, test.Line, perr.Line)
+		}
+	}
+
+	// The default limit applies to ParseLines
+	err := ParseLines(strings.NewReader(strings.Repeat("x", defaultMaxLineLength+1)), func(Line) {})
+	if !errors.Is(err, ErrLineTooLong) {
+		t.Errorf("expected ErrLineTooLong, got %v", err)
+	}
+}
+
+func TestParseLinesReadError(t *testing.T) {
+	errRead := errors.New("read error")
+	r := &errReader{strings.NewReader("a\nb\n"), errRead}
+	var n int
+	err := ParseLines(r, func(Line) { n++ })
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Err != errRead {
+		t.Fatalf("expected ParseError wrapping %v, got %v", errRead, err)
+	}
+	if n != 2 || perr.Line != 3 {
+		t.Errorf("expected error on line 3 after 2 lines, got line %d after %d lines", perr.Line, n)
+	}
+}
+
+// errReader returns err in place of the errors, including io.EOF,
+// returned by r.
+type errReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		err = r.err
+	}
+	return n, err
+}
+
+func TestTextWriteTo(t *testing.T) {
+	text := Text{
+		LineHeading1("Title"),
+		LineLink{"gemini://example.com", "Example"},
+		LineText(""),
+		LineListItem("item"),
+	}
+	const want = "# Title\n=> gemini://example.com Example\n\n* item\n"
+
+	var b strings.Builder
+	n, err := text.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want || n != int64(len(want)) {
+		t.Errorf("expected %q (%d bytes), got %q (%d bytes)", want, len(want), got, n)
+	}
+	if got := text.String(); got != want {
+		t.Errorf("expected String %q, got %q", want, got)
+	}
+
+	// Writing subslices in order produces the same output
+	b.Reset()
+	text[:2].WriteTo(&b)
+	text[2:].WriteTo(&b)
+	if got := b.String(); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+
+	// Errors are returned with the number of bytes written
+	rw := &recorder{}
+	rw.Close()
+	if n, err := text.WriteTo(rw); err == nil || n != 0 {
+		t.Errorf("expected error after 0 bytes, got %d, %v", n, err)
+	}
+}
+
+func TestParseLinesFunc(t *testing.T) {
+	errStop := errors.New("stop")
+	var n int
+	err := ParseLinesFunc(context.Background(), strings.NewReader("a\nb\nc\n"), func(line Line) error {
+		n++
+		if n == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || n != 2 {
+		t.Errorf("expected error %v after 2 lines, got %v after %d lines", errStop, err, n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n = 0
+	err = ParseLinesFunc(ctx, strings.NewReader("a\nb\nc\n"), func(line Line) error {
+		n++
+		cancel()
+		return nil
+	})
+	if err != context.Canceled || n != 1 {
+		t.Errorf("expected error %v after 1 line, got %v after %d lines", context.Canceled, err, n)
+	}
+
+	err = ParseLinesFunc(context.Background(), &errReader{strings.NewReader("a"), errStop}, func(Line) error {
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("expected read error %v, got %v", errStop, err)
+	}
+}
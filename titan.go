@@ -0,0 +1,75 @@
+package gemini
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// TitanParameters holds the parameters of a Titan upload request.
+//
+// Titan is a companion protocol to Gemini for uploading content.
+// Titan requests use the "titan" URL scheme and carry their parameters
+// in the URL path, for example
+// "titan://example.com/page.gmi;mime=text/gemini;size=42;token=secret",
+// followed by a body of the given size. Mux only dispatches Titan
+// requests to handlers registered with HandleTitan.
+type TitanParameters struct {
+	// Size is the size of the request body in bytes.
+	Size int64
+
+	// MediaType is the media type of the request body.
+	// If the client did not specify a media type, it is "text/gemini".
+	MediaType string
+
+	// Token is the optional authentication token provided by the client.
+	Token string
+}
+
+// parseTitanURL removes the Titan parameters from the path of u
+// and returns them.
+func parseTitanURL(u *url.URL) (*TitanParameters, error) {
+	escaped := u.EscapedPath()
+	i := strings.IndexByte(escaped, ';')
+	if i == -1 {
+		return nil, ErrInvalidRequest
+	}
+
+	params := &TitanParameters{
+		Size:      -1,
+		MediaType: defaultMediaType,
+	}
+	for _, param := range strings.Split(escaped[i+1:], ";") {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, ErrInvalidRequest
+		}
+		value, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return nil, ErrInvalidRequest
+		}
+		switch kv[0] {
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return nil, ErrInvalidRequest
+			}
+			params.Size = size
+		case "mime":
+			params.MediaType = value
+		case "token":
+			params.Token = value
+		}
+	}
+	if params.Size < 0 {
+		return nil, ErrInvalidRequest
+	}
+
+	path, err := url.PathUnescape(escaped[:i])
+	if err != nil {
+		return nil, ErrInvalidRequest
+	}
+	u.Path = path
+	u.RawPath = escaped[:i]
+	return params, nil
+}
@@ -0,0 +1,141 @@
+package gemini
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TOCEntry is an entry of a table of contents, corresponding to a heading.
+type TOCEntry struct {
+	// Level is the level of the heading, from 1 to 3.
+	Level int
+
+	// Title is the text of the heading.
+	Title string
+
+	// Line is the line number of the heading, starting at 1.
+	Line int
+
+	// Anchor is a fragment identifier for the heading, derived from its
+	// title. Anchors are unique within a table of contents.
+	Anchor string
+
+	// Children are the entries for the headings of lower levels that
+	// follow the heading, up to the next heading of the same or a higher
+	// level.
+	Children []TOCEntry
+}
+
+// TOC is a table of contents.
+type TOC []TOCEntry
+
+// TableOfContents returns the table of contents of the provided Gemini
+// text. Headings are nested below the closest preceding heading of a
+// higher level, so that a third-level heading directly following a
+// first-level heading is one of its children. Empty headings are omitted.
+func TableOfContents(t Text) TOC {
+	var flat []TOCEntry
+	anchors := make(anchorSet)
+	for i, line := range t {
+		level := headingLevel(line)
+		if level == 0 {
+			continue
+		}
+		title := headingTitle(line, level)
+		if title == "" {
+			continue
+		}
+		flat = append(flat, TOCEntry{
+			Level:  level,
+			Title:  title,
+			Line:   i + 1,
+			Anchor: anchors.add(title),
+		})
+	}
+	return nestTOC(flat)
+}
+
+// nestTOC nests the entries of a flat table of contents.
+func nestTOC(flat []TOCEntry) TOC {
+	var toc TOC
+	for i := 0; i < len(flat); {
+		entry := flat[i]
+		j := i + 1
+		for j < len(flat) && flat[j].Level > entry.Level {
+			j++
+		}
+		entry.Children = nestTOC(flat[i+1 : j])
+		toc = append(toc, entry)
+		i = j
+	}
+	return toc
+}
+
+// headingTitle returns the text of the heading of the provided level.
+func headingTitle(line Line, level int) string {
+	return strings.TrimSpace(line.String()[level:])
+}
+
+// anchorSet generates unique anchors for headings. It maps each anchor
+// in use to the next numeric suffix to try for it.
+type anchorSet map[string]int
+
+// add returns a unique anchor for the heading title, adding a numeric
+// suffix to anchors that are already in use.
+func (a anchorSet) add(title string) string {
+	base := headingAnchor(title)
+	anchor := base
+	for n := a[base]; a[anchor] > 0; n++ {
+		anchor = base + "-" + strconv.Itoa(n)
+		a[base] = n + 1
+	}
+	a[anchor] = 1
+	return anchor
+}
+
+// headingAnchor returns the fragment identifier for a heading title: the
+// lowercase letters and digits of the title, with runs of other
+// characters replaced by hyphens.
+func headingAnchor(title string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range title {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(unicode.ToLower(r))
+		} else {
+			hyphen = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// Text renders the table of contents as Gemini text, with a link line
+// for each entry. The URL of each link is the fragment "#" followed by
+// the anchor of the entry, which clients that support heading anchors
+// can use to scroll to the heading. Since Gemini text has no nested
+// lists, the names of the links are numbered by section, such as
+// "1.2. Title".
+func (toc TOC) Text() Text {
+	var t Text
+	toc.appendText(&t, "")
+	return t
+}
+
+func (toc TOC) appendText(t *Text, prefix string) {
+	for i, entry := range toc {
+		number := prefix + strconv.Itoa(i+1) + "."
+		*t = append(*t, LineLink{
+			URL:  "#" + entry.Anchor,
+			Name: number + " " + entry.Title,
+		})
+		TOC(entry.Children).appendText(t, number)
+	}
+}
@@ -0,0 +1,80 @@
+package gemini
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTableOfContents(t *testing.T) {
+	text := "# Title\n" +
+		"Text\n" +
+		"## Getting started\n" +
+		"### Install\n" +
+		"## Usage\n" +
+		"### Install\n" +
+		"#\n" +
+		"# Appendix: FAQ?\n" +
+		"### Skipped\n" +
+		"```\n" +
+		"# Not a heading\n" +
+		"```\n"
+
+	doc, err := ParseText(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := TOC{
+		{Level: 1, Title: "Title", Line: 1, Anchor: "title", Children: []TOCEntry{
+			{Level: 2, Title: "Getting started", Line: 3, Anchor: "getting-started", Children: []TOCEntry{
+				{Level: 3, Title: "Install", Line: 4, Anchor: "install"},
+			}},
+			{Level: 2, Title: "Usage", Line: 5, Anchor: "usage", Children: []TOCEntry{
+				{Level: 3, Title: "Install", Line: 6, Anchor: "install-1"},
+			}},
+		}},
+		{Level: 1, Title: "Appendix: FAQ?", Line: 8, Anchor: "appendix-faq", Children: []TOCEntry{
+			{Level: 3, Title: "Skipped", Line: 9, Anchor: "skipped"},
+		}},
+	}
+	toc := TableOfContents(doc)
+	if !reflect.DeepEqual(toc, want) {
+		t.Errorf("expected %+v, got %+v", want, toc)
+	}
+
+	const wantText = "=> #title 1. Title\n" +
+		"=> #getting-started 1.1. Getting started\n" +
+		"=> #install 1.1.1. Install\n" +
+		"=> #usage 1.2. Usage\n" +
+		"=> #install-1 1.2.1. Install\n" +
+		"=> #appendix-faq 2. Appendix: FAQ?\n" +
+		"=> #skipped 2.1. Skipped\n"
+	if got := toc.Text().String(); got != wantText {
+		t.Errorf("expected text %q, got %q", wantText, got)
+	}
+}
+
+func TestTableOfContentsAnchors(t *testing.T) {
+	// Suffixed anchors must not collide with other headings
+	tests := []struct {
+		Text    string
+		Anchors []string
+	}{
+		{"# A\n# A\n# A 1\n", []string{"a", "a-1", "a-1-1"}},
+		{"# A 1\n# A\n# A\n# A\n", []string{"a-1", "a", "a-2", "a-3"}},
+		{"# A\n# A-1\n# A\n# A\n", []string{"a", "a-1", "a-2", "a-3"}},
+	}
+	for _, test := range tests {
+		doc, err := ParseText(strings.NewReader(test.Text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var anchors []string
+		for _, entry := range TableOfContents(doc) {
+			anchors = append(anchors, entry.Anchor)
+		}
+		if !reflect.DeepEqual(anchors, test.Anchors) {
+			t.Errorf("%q: expected anchors %q, got %q", test.Text, test.Anchors, anchors)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package gemini
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// LineKind is the kind of a line of Gemini text.
+type LineKind int
+
+// Line kinds.
+const (
+	KindText LineKind = iota
+	KindLink
+	KindPreformattingToggle
+	KindPreformattedText
+	KindHeading1
+	KindHeading2
+	KindHeading3
+	KindListItem
+	KindQuote
+)
+
+// Tokenizer splits Gemini text into lines. Unlike ParseLines, it does not
+// allocate a Line for each line: the text of the current line is returned
+// as a byte slice into a buffer that is reused by the next call to Next.
+// It is useful for programs that parse large amounts of Gemini text, such
+// as search engine indexers.
+//
+//	t := gemini.NewTokenizer(r)
+//	for t.Next() {
+//		if t.Kind() == gemini.KindLink {
+//			index(t.URL(), t.Text())
+//		}
+//	}
+//	if err := t.Err(); err != nil {
+//		// handle error
+//	}
+type Tokenizer struct {
+	scanner *bufio.Scanner
+	max     int
+	pre     bool
+	start   int64
+	next    int64
+	num     int
+	kind    LineKind
+	text    []byte
+	url     []byte
+	raw     []byte
+	err     error
+}
+
+// NewTokenizer returns a new Tokenizer that reads Gemini text from r.
+// It is equivalent to ParseOptions{}.NewTokenizer(r).
+func NewTokenizer(r io.Reader) *Tokenizer {
+	return ParseOptions{}.NewTokenizer(r)
+}
+
+// NewTokenizer returns a new Tokenizer that reads Gemini text from r
+// using the options.
+func (o ParseOptions) NewTokenizer(r io.Reader) *Tokenizer {
+	max := o.MaxLineLength
+	if max <= 0 {
+		max = defaultMaxLineLength
+	}
+	t := &Tokenizer{
+		scanner: bufio.NewScanner(r),
+		max:     max,
+	}
+	// Leave room for the line ending
+	t.scanner.Buffer(nil, max+2)
+	t.scanner.Split(t.split)
+	return t
+}
+
+// split splits lines like bufio.ScanLines, except that tokens include
+// the line ending so that the raw text of each line is available. It also
+// keeps track of the offset of the start of each line.
+func (t *Tokenizer) split(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	var token []byte
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		token = data[:i+1]
+	} else if atEOF {
+		token = data
+	} else {
+		// Request more data
+		return 0, nil, nil
+	}
+	t.start = t.next
+	t.next += int64(len(token))
+	return len(token), token, nil
+}
+
+// Next advances the tokenizer to the next line, which is then available
+// through the Kind, Text and URL methods. It returns false when there are
+// no more lines, either by reaching the end of the input or an error.
+// After Next returns false, Err returns the error, if any.
+func (t *Tokenizer) Next() bool {
+	if t.err != nil {
+		return false
+	}
+	if !t.scanner.Scan() {
+		if err := t.scanner.Err(); err != nil {
+			if err == bufio.ErrTooLong {
+				err = ErrLineTooLong
+			}
+			t.err = &ParseError{Line: t.num + 1, Err: err}
+		}
+		t.kind, t.text, t.url, t.raw = KindText, nil, nil, nil
+		return false
+	}
+	t.num++
+	t.raw = t.scanner.Bytes()
+	text := bytes.TrimSuffix(t.raw, []byte("\n"))
+	text = bytes.TrimSuffix(text, []byte("\r"))
+	if len(text) > t.max {
+		t.err = &ParseError{Line: t.num, Err: ErrLineTooLong}
+		t.kind, t.text, t.url, t.raw = KindText, nil, nil, nil
+		return false
+	}
+	t.kind, t.text, t.url = t.tokenize(text)
+	return true
+}
+
+// tokenize returns the kind, text and URL of the line.
+func (t *Tokenizer) tokenize(text []byte) (LineKind, []byte, []byte) {
+	const spacetab = " \t"
+	if bytes.HasPrefix(text, []byte("```")) {
+		t.pre = !t.pre
+		return KindPreformattingToggle, text[3:], nil
+	} else if t.pre {
+		return KindPreformattedText, text, nil
+	} else if bytes.HasPrefix(text, []byte("=>")) {
+		text = text[2:]
+		text = bytes.TrimLeft(text, spacetab)
+		split := bytes.IndexAny(text, spacetab)
+		if split == -1 {
+			// text is a URL
+			return KindLink, nil, text
+		}
+		url := text[:split]
+		name := text[split:]
+		name = bytes.TrimLeft(name, spacetab)
+		return KindLink, name, url
+	} else if bytes.HasPrefix(text, []byte("*")) {
+		return KindListItem, bytes.TrimLeft(text[1:], spacetab), nil
+	} else if bytes.HasPrefix(text, []byte("###")) {
+		return KindHeading3, bytes.TrimLeft(text[3:], spacetab), nil
+	} else if bytes.HasPrefix(text, []byte("##")) {
+		return KindHeading2, bytes.TrimLeft(text[2:], spacetab), nil
+	} else if bytes.HasPrefix(text, []byte("#")) {
+		return KindHeading1, bytes.TrimLeft(text[1:], spacetab), nil
+	} else if bytes.HasPrefix(text, []byte(">")) {
+		return KindQuote, bytes.TrimLeft(text[1:], spacetab), nil
+	}
+	return KindText, text, nil
+}
+
+// Kind returns the kind of the current line.
+func (t *Tokenizer) Kind() LineKind {
+	return t.kind
+}
+
+// Text returns the text of the current line, without its line prefix:
+// the name of a link, the text of a heading, list item or quote, the alt
+// text of a preformatting toggle, or the whole line otherwise.
+// The slice is only valid until the next call to Next.
+func (t *Tokenizer) Text() []byte {
+	return t.text
+}
+
+// URL returns the URL of the current line if it is a link, or nil.
+// The slice is only valid until the next call to Next.
+func (t *Tokenizer) URL() []byte {
+	return t.url
+}
+
+// Raw returns the raw text of the current line, including its line
+// ending, if any. Concatenating the raw text of each line reproduces the
+// input exactly. The slice is only valid until the next call to Next.
+func (t *Tokenizer) Raw() []byte {
+	return t.raw
+}
+
+// Line returns the current line as a Line. Unlike the other methods, it
+// allocates, and the returned Line remains valid after calls to Next.
+func (t *Tokenizer) Line() Line {
+	text := string(t.text)
+	switch t.kind {
+	case KindLink:
+		return LineLink{URL: string(t.url), Name: text}
+	case KindPreformattingToggle:
+		return LinePreformattingToggle(text)
+	case KindPreformattedText:
+		return LinePreformattedText(text)
+	case KindHeading1:
+		return LineHeading1(text)
+	case KindHeading2:
+		return LineHeading2(text)
+	case KindHeading3:
+		return LineHeading3(text)
+	case KindListItem:
+		return LineListItem(text)
+	case KindQuote:
+		return LineQuote(text)
+	}
+	return LineText(text)
+}
+
+// LineNumber returns the number of the current line, starting at 1.
+func (t *Tokenizer) LineNumber() int {
+	return t.num
+}
+
+// Offset returns the byte offset of the start of the current line.
+func (t *Tokenizer) Offset() int64 {
+	return t.start
+}
+
+// Err returns the first error encountered by the tokenizer, if any.
+// Errors reading the input and lines that are too long are returned as a
+// *ParseError.
+func (t *Tokenizer) Err() error {
+	return t.err
+}
@@ -0,0 +1,83 @@
+package gemini
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenizer(t *testing.T) {
+	const text = "# Title\r\n=> gemini://example.com Example\n=>/about\n* item\n> quote\n```alt\n# pre\n```\ntext"
+	type token struct {
+		Kind LineKind
+		Text string
+		URL  string
+	}
+	want := []token{
+		{KindHeading1, "Title", ""},
+		{KindLink, "Example", "gemini://example.com"},
+		{KindLink, "", "/about"},
+		{KindListItem, "item", ""},
+		{KindQuote, "quote", ""},
+		{KindPreformattingToggle, "alt", ""},
+		{KindPreformattedText, "# pre", ""},
+		{KindPreformattingToggle, "", ""},
+		{KindText, "text", ""},
+	}
+
+	parsed, err := ParseText(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok := NewTokenizer(strings.NewReader(text))
+	var i int
+	for tok.Next() {
+		if i >= len(want) {
+			t.Fatalf("expected %d lines, got more", len(want))
+		}
+		got := token{tok.Kind(), string(tok.Text()), string(tok.URL())}
+		if got != want[i] {
+			t.Errorf("line %d: expected %+v, got %+v", i+1, want[i], got)
+		}
+		if tok.LineNumber() != i+1 {
+			t.Errorf("line %d: got line number %d", i+1, tok.LineNumber())
+		}
+		if line := tok.Line(); line != parsed[i] {
+			t.Errorf("line %d: expected Line %#v, got %#v", i+1, parsed[i], line)
+		}
+		i++
+	}
+	if err := tok.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if i != len(want) {
+		t.Errorf("expected %d lines, got %d", len(want), i)
+	}
+}
+
+func TestTokenizerAllocs(t *testing.T) {
+	text := strings.Repeat("# Title\n=> gemini://example.com Example\n* item\ntext\n", 100)
+	tok := NewTokenizer(strings.NewReader(text))
+	// Fill the buffer before measuring
+	tok.Next()
+	allocs := testing.AllocsPerRun(100, func() {
+		if !tok.Next() {
+			t.Fatal("unexpected end of input")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations per line, got %v", allocs)
+	}
+}
+
+func BenchmarkTokenizer(b *testing.B) {
+	text := strings.Repeat("# Title\n=> gemini://example.com Example\n* item\ntext\n", 1000)
+	r := strings.NewReader(text)
+	b.SetBytes(int64(len(text)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.Reset(text)
+		tok := NewTokenizer(r)
+		for tok.Next() {
+		}
+	}
+}
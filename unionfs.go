@@ -0,0 +1,136 @@
+// +build go1.16
+
+package gemini
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+)
+
+// UnionFS returns a file system that merges the provided file systems,
+// in the manner of an overlay. Files are opened from the first file
+// system that contains them, so that earlier file systems take precedence
+// over later ones. Directories are merged: a directory lists the entries
+// of the directories with the same name in all of the file systems, and
+// entries from earlier file systems shadow entries with the same name in
+// later ones, including the contents of shadowed directories.
+//
+// For example, to serve a theme on top of generated content:
+//
+//     fsys := gemini.UnionFS(os.DirFS("theme"), os.DirFS("public"))
+//     gemini.FileServer(fsys)
+func UnionFS(fsyss ...fs.FS) fs.FS {
+	return unionFS(fsyss)
+}
+
+type unionFS []fs.FS
+
+func (u unionFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	for i, fsys := range u {
+		f, err := fsys.Open(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			if shadowed(fsys, name) {
+				break
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if !stat.IsDir() {
+			return f, nil
+		}
+		return &unionDir{File: f, name: name, lower: u[i+1:]}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// shadowed reports whether a parent of the named file is a file other
+// than a directory in fsys, which shadows the file in later file systems.
+func shadowed(fsys fs.FS, name string) bool {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		stat, err := fs.Stat(fsys, dir)
+		if err == nil {
+			return !stat.IsDir()
+		}
+	}
+	return false
+}
+
+// unionDir is a directory in a unionFS.
+type unionDir struct {
+	fs.File         // the directory in the first file system containing it
+	name    string  // the name of the directory
+	lower   []fs.FS // the file systems after the first
+	entries []fs.DirEntry
+	read    bool // whether entries has been read
+}
+
+func (d *unionDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		if err := d.readEntries(); err != nil {
+			return nil, err
+		}
+	}
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+// readEntries reads the merged entries of the directory.
+func (d *unionDir) readEntries() error {
+	dir, ok := d.File.(fs.ReadDirFile)
+	if !ok {
+		return &fs.PathError{Op: "readdir", Path: d.name, Err: errors.New("not implemented")}
+	}
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		seen[entry.Name()] = true
+	}
+	for _, fsys := range d.lower {
+		lower, err := fs.ReadDir(fsys, d.name)
+		if err != nil {
+			// Missing directories and files shadowed by the
+			// directory are skipped
+			continue
+		}
+		for _, entry := range lower {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	d.entries = entries
+	d.read = true
+	return nil
+}
@@ -0,0 +1,53 @@
+// +build go1.16
+
+package gemini
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestUnionFS(t *testing.T) {
+	upper := fstest.MapFS{
+		"index.gmi":     {Data: []byte("upper")},
+		"style/a.txt":   {Data: []byte("upper")},
+		"shadowed":      {Data: []byte("file")},
+		"upper/new.txt": {Data: []byte("upper")},
+	}
+	lower := fstest.MapFS{
+		"index.gmi":       {Data: []byte("lower")},
+		"style/b.txt":     {Data: []byte("lower")},
+		"shadowed/c.txt":  {Data: []byte("lower")},
+		"lower/notes.gmi": {Data: []byte("lower")},
+	}
+	fsys := UnionFS(upper, lower)
+
+	if err := fstest.TestFS(fsys, "index.gmi", "style/a.txt", "style/b.txt", "shadowed", "upper/new.txt", "lower/notes.gmi"); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := fs.ReadFile(fsys, "index.gmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "upper" {
+		t.Errorf("expected file from upper file system, got %q", b)
+	}
+	if _, err := fs.Stat(fsys, "shadowed/c.txt"); err == nil {
+		t.Errorf("expected file in shadowed directory to be hidden")
+	}
+
+	entries, err := fs.ReadDir(fsys, "style")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "a.txt" || entries[1].Name() != "b.txt" {
+		t.Errorf("expected merged directory, got %v", entries)
+	}
+
+	w := serveFS(t, FileServer(fsys), "gemini://example.com/style/")
+	if want := "=> a.txt a.txt\n=> b.txt b.txt\n"; w.Body.String() != want {
+		t.Errorf("expected listing %q, got %q", want, w.Body.String())
+	}
+}